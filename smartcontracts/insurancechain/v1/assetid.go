@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Asset ID Generation - Identifiers and timestamps derived from the transaction
+// ============================================================================================================================
+
+// maxIDCollisions - number of suffixed alternatives tried before giving up on an asset ID
+const maxIDCollisions = 100
+
+// getTxTime - Get the transaction timestamp, which is identical on all endorsing peers
+func getTxTime(stub shim.ChaincodeStubInterface) (time.Time, error) {
+	txTimestamp, err := stub.GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to get transaction timestamp: %s", err.Error())
+	}
+
+	txTime, err := ptypes.Timestamp(txTimestamp)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Invalid transaction timestamp: %s", err.Error())
+	}
+	return txTime, nil
+}
+
+// newAssetID - Create an ID for a new asset of the given class from the transaction ID and timestamp
+//
+// The ID has the form <unix seconds>-<hash>, where the hash covers the transaction ID, the asset class and the
+// discriminator. Use an empty discriminator when the transaction creates a single asset of the class, otherwise
+// something unique within the transaction. If the ID is already taken in state a numeric suffix is added.
+func newAssetID(stub shim.ChaincodeStubInterface, assetClass string, discriminator string) (string, error) {
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.Sum256([]byte(stub.GetTxID() + "|" + assetClass + "|" + discriminator))
+	baseID := fmt.Sprintf("%d-%s", txTime.Unix(), hex.EncodeToString(hash[:4]))
+
+	// === Check for collisions with existing assets
+	assetID := baseID
+	for i := 1; i <= maxIDCollisions; i++ {
+		assetAsBytes, err := stub.GetState(fmt.Sprintf("%s#%s", assetClass, assetID))
+		if err != nil {
+			return "", fmt.Errorf("Failed to check asset ID: %s", err.Error())
+		} else if assetAsBytes == nil {
+			return assetID, nil
+		}
+		assetID = fmt.Sprintf("%s-%d", baseID, i)
+	}
+
+	return "", fmt.Errorf("Unable to find a free ID for %s after %d attempts", assetClass, maxIDCollisions)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Access Control Definitions - Client identities mapped to participants
+// ============================================================================================================================
+
+// participantAttribute - certificate attribute with the participant reference of an identity, e.g. base.Insurer#AXA Insurance
+const participantAttribute = "participant"
+
+// adminAttribute - certificate attribute marking an identity as administrator of its organisation when set to true
+const adminAttribute = "admin"
+
+// Pseudo participant classes of the access table
+const (
+	adminRole   = "admin" // identities with the admin attribute
+	anyIdentity = "*"     // any identity of the channel
+)
+
+// participantMSPIndex - composite key of the MSP a participant is bound to, with the attributes [class, participant ID]
+const participantMSPIndex = "participant~msp"
+
+// participantClasses - classes of participants an identity can act as
+var participantClasses = map[string]bool{
+	"base.Registrant":        true,
+	"base.Insurer":           true,
+	"base.EmergencyServices": true,
+	"base.RepairShop":        true,
+}
+
+// functionAccess - participant classes which may invoke a function, functions missing here can't be invoked at all
+var functionAccess = map[string][]string{
+	"setupAssets":               {adminRole},
+	"registerRegistrant":        {adminRole},
+	"forgetRegistrant":          {adminRole, "base.Registrant"},
+	"registerInsurer":           {adminRole},
+	"registerEmergencyServices": {adminRole},
+	"registerRepairShop":        {adminRole},
+	"updateRepairShop":          {adminRole, "base.RepairShop"},
+	"registerVehicle":           {adminRole, "base.Registrant"},
+	"transferVehicle":           {adminRole, "base.Registrant"},
+	"acceptClaim":               {"base.Insurer"},
+	"declineClaim":              {"base.Insurer"},
+	"resolveClaim":              {"base.Insurer"},
+	"calculatePayout":           {"base.Insurer"},
+	"proposeLiability":          {"base.Insurer"},
+	"agreeLiability":            {"base.Insurer"},
+	"disputeLiability":          {"base.Insurer"},
+	"runNetting":                {adminRole},
+	"confirmSettlement":         {"base.Insurer"},
+	"createRepairOrder":         {"base.RepairShop"},
+	"startRepair":               {"base.RepairShop"},
+	"reportActualCosts":         {"base.RepairShop"},
+	"fileSupplement":            {"base.RepairShop"},
+	"decideSupplement":          {"base.Insurer"},
+	"completeRepair":            {"base.RepairShop"},
+	"invoiceRepair":             {"base.RepairShop"},
+	"renewPolicy":               {"base.Insurer"},
+	"cancelPolicy":              {"base.Insurer"},
+	"endorsePolicy":             {"base.Insurer"},
+	"readAssetData":             {anyIdentity},
+	"queryAssets":               {anyIdentity},
+	"getPoliciesForVehicle":     {anyIdentity},
+	"getClaimsForPolicy":        {anyIdentity},
+	"getQuotesForRequest":       {anyIdentity},
+	"getRequestsForAccident":    {anyIdentity},
+	"getReportsForVehicle":      {anyIdentity},
+	"getStatementsForAccident":  {anyIdentity},
+	"getAssetHistory":           {anyIdentity},
+	"reindexAssets":             {adminRole},
+	"reportAccident":            {adminRole, "base.Registrant", "base.EmergencyServices", "base.Insurer"},
+	"updateReport":              {"base.EmergencyServices"},
+	"claimReport":               {"base.EmergencyServices"},
+	"addWitnessStatement":       {"base.EmergencyServices"},
+	"closeReport":               {"base.EmergencyServices"},
+	"requestQuote":              {"base.Registrant", "base.Insurer"},
+	"offerQuote":                {"base.RepairShop"},
+	"commitQuote":               {"base.RepairShop"},
+	"revealQuote":               {"base.RepairShop"},
+	"awardSealedQuote":          {"base.Registrant", "base.Insurer"},
+	"acceptQuote":               {"base.Registrant", "base.Insurer"},
+	"rejectQuote":               {"base.Registrant", "base.Insurer"},
+	"issuePolicy":               {"base.Insurer"},
+	"sendClaim":                 {"base.Registrant", "base.Insurer"},
+
+	// migrations of existing assets after upgrading the chaincode
+	"migrateRegistrantPersonalData": {adminRole},
+}
+
+// Caller - client identity invoking the chaincode and the participant it acts as
+type Caller struct {
+	MSPID            string
+	ID               string
+	Admin            bool
+	ParticipantClass string // empty if the identity doesn't act as a participant
+	ParticipantID    string
+	ParticipantRef   string // participant class name + # + participant ID
+}
+
+// authorize - Resolve the caller of a function and check its participant class may invoke the function
+func authorize(stub shim.ChaincodeStubInterface, function string) (*Caller, error) {
+	allowed, found := functionAccess[function]
+	if !found {
+		return nil, fmt.Errorf("Received unknown invoke function name - '%s'", function)
+	}
+
+	caller, err := getCaller(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, participantClass := range allowed {
+		if participantClass == anyIdentity ||
+			(participantClass == adminRole && caller.Admin) ||
+			(participantClass == caller.ParticipantClass && caller.ParticipantClass != "") {
+			return caller, nil
+		}
+	}
+
+	callerName := caller.ParticipantRef
+	if callerName == "" {
+		callerName = caller.MSPID + " identity without participant"
+	}
+	return nil, fmt.Errorf("Function %s may only be invoked by %s, not by %s", function, strings.Join(allowed, ", "), callerName)
+}
+
+// getCaller - Map the submitting client identity to a participant using its MSP ID and certificate attributes
+func getCaller(stub shim.ChaincodeStubInterface) (*Caller, error) {
+	identity, err := cid.New(stub)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get client identity: %s", err.Error())
+	}
+
+	caller := &Caller{}
+	if caller.MSPID, err = identity.GetMSPID(); err != nil {
+		return nil, fmt.Errorf("Failed to get MSP ID of client identity: %s", err.Error())
+	}
+	if caller.ID, err = identity.GetID(); err != nil {
+		return nil, fmt.Errorf("Failed to get ID of client identity: %s", err.Error())
+	}
+
+	adminValue, found, err := identity.GetAttributeValue(adminAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get %s attribute: %s", adminAttribute, err.Error())
+	}
+	caller.Admin = found && adminValue == "true"
+
+	// === Identities without participant attribute can only use functions open to admins or anyone
+	participantRef, found, err := identity.GetAttributeValue(participantAttribute)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get %s attribute: %s", participantAttribute, err.Error())
+	} else if !found || participantRef == "" {
+		return caller, nil
+	}
+
+	refParts := strings.SplitN(participantRef, "#", 2)
+	if len(refParts) != 2 || !participantClasses[refParts[0]] || refParts[1] == "" {
+		return nil, fmt.Errorf("Attribute %s must be a participant class name + # + ID, got %s", participantAttribute, participantRef)
+	}
+
+	// === Check if participant exists and belongs to the organisation of the identity
+	participantAsBytes, err := stub.GetState(participantRef)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get participant: %s", err.Error())
+	} else if participantAsBytes == nil {
+		return nil, fmt.Errorf("Participant of client identity doesn't exists: %s", participantRef)
+	}
+
+	participantMSPID, err := getParticipantMSP(stub, refParts[0], refParts[1])
+	if err != nil {
+		return nil, err
+	} else if participantMSPID != caller.MSPID {
+		return nil, fmt.Errorf("Participant %s doesn't belong to organisation %s", participantRef, caller.MSPID)
+	}
+
+	caller.ParticipantClass = refParts[0]
+	caller.ParticipantID = refParts[1]
+	caller.ParticipantRef = participantRef
+	return caller, nil
+}
+
+// bindParticipant - Bind a participant to the MSP of the organisation registering it
+func bindParticipant(stub shim.ChaincodeStubInterface, participantClass string, participantID string, mspID string) error {
+	bindingKey, err := stub.CreateCompositeKey(participantMSPIndex, []string{participantClass, participantID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(bindingKey, []byte(mspID))
+}
+
+// getParticipantMSP - Get the MSP a participant is bound to
+func getParticipantMSP(stub shim.ChaincodeStubInterface, participantClass string, participantID string) (string, error) {
+	bindingKey, err := stub.CreateCompositeKey(participantMSPIndex, []string{participantClass, participantID})
+	if err != nil {
+		return "", err
+	}
+	mspIDAsBytes, err := stub.GetState(bindingKey)
+	if err != nil {
+		return "", fmt.Errorf("Failed to get organisation of participant: %s", err.Error())
+	} else if mspIDAsBytes == nil {
+		return "", fmt.Errorf("Participant isn't bound to an organisation: %s#%s", participantClass, participantID)
+	}
+	return string(mspIDAsBytes), nil
+}
+
+// isPolicyParty - Check if the caller is the holder or the insurer of a policy
+func (c *Caller) isPolicyParty(insurancePolicy *InsurancePolicy) bool {
+	return c.ParticipantRef != "" && (c.ParticipantRef == insurancePolicy.PolicyHolder || c.ParticipantRef == insurancePolicy.IssuedBy)
+}
@@ -0,0 +1,78 @@
+package main
+
+// ============================================================================================================================
+// Country Boundary Dataset - Simplified borders of the countries in the coverage of policies
+// ============================================================================================================================
+
+// The polygons are hand simplified approximations of the real borders, which keeps the chaincode small and the lookup
+// deterministic on all peers. Land borders follow the major rivers, lakes and parallels, coastlines are drawn offshore
+// so coastal locations are inside. Locations close to a land border may be assigned to the wrong country. Points are
+// longitude, latitude in WGS 84. To cover more territories append countries with their ISO 3166-1 alpha-2 code, the
+// polygons of neighbouring countries must share their border points. Only countries of the dataset can be part of the
+// territory of a policy, and accidents outside its polygons fail the territory rule, see checkPolicyCoverage.
+
+// countryBoundaries - simplified outline rings per country
+var countryBoundaries = []countryBoundary{
+	{"US", [][]geoPoint{
+		// Contiguous United States
+		{
+			{-124.75, 48.50}, {-123.25, 48.25}, {-123.20, 48.70}, {-123.00, 49.00}, {-95.15, 49.00},
+			{-95.15, 49.38}, {-94.80, 49.30}, {-94.60, 48.70}, {-93.20, 48.60}, {-89.60, 48.00},
+			{-88.40, 48.30}, {-84.90, 46.90}, {-84.40, 46.50}, {-83.60, 46.10}, {-82.40, 45.30},
+			{-82.50, 43.00}, {-83.10, 42.10}, {-82.70, 41.70}, {-81.00, 42.30}, {-79.00, 42.90},
+			{-79.20, 43.50}, {-76.50, 43.60}, {-76.30, 44.20}, {-74.70, 45.00}, {-71.50, 45.00},
+			{-70.80, 45.40}, {-70.00, 46.70}, {-69.20, 47.45}, {-68.20, 47.35}, {-67.80, 47.10},
+			{-67.80, 45.70}, {-67.00, 44.90}, {-66.90, 44.60}, {-69.50, 43.40}, {-69.80, 41.20},
+			{-71.50, 40.90}, {-73.80, 40.30}, {-74.00, 39.30}, {-75.30, 35.10}, {-77.50, 33.70},
+			{-80.50, 31.80}, {-80.00, 27.00}, {-79.90, 25.20}, {-81.00, 24.40}, {-82.20, 24.40},
+			{-82.90, 27.50}, {-84.00, 29.60}, {-86.50, 30.20}, {-89.00, 30.10}, {-89.20, 28.80},
+			{-91.00, 28.90}, {-94.00, 29.40}, {-97.20, 26.00}, {-97.15, 25.95}, {-99.50, 27.50},
+			{-100.90, 29.30}, {-102.40, 29.80}, {-103.20, 28.98}, {-104.50, 29.60}, {-106.45, 31.73},
+			{-106.53, 31.78}, {-108.20, 31.78}, {-108.20, 31.33}, {-111.07, 31.33}, {-114.80, 32.50},
+			{-114.70, 32.72}, {-117.12, 32.53}, {-117.40, 32.60}, {-118.60, 33.60}, {-120.70, 34.40},
+			{-122.00, 36.50}, {-123.20, 37.90}, {-124.50, 40.30}, {-124.70, 42.80}, {-124.20, 46.20},
+			{-124.80, 47.90},
+		},
+		// Alaska
+		{
+			{-141.00, 69.65}, {-156.80, 71.50}, {-166.50, 68.90}, {-168.20, 65.60}, {-166.00, 61.50},
+			{-165.00, 54.50}, {-162.00, 54.80}, {-152.00, 57.20}, {-146.00, 59.80}, {-140.00, 59.50},
+			{-137.50, 58.30}, {-134.50, 56.50}, {-132.00, 54.70}, {-130.60, 54.70}, {-130.00, 55.90},
+			{-131.00, 56.50}, {-133.50, 58.50}, {-135.50, 59.80}, {-137.50, 59.00}, {-139.00, 60.00},
+			{-141.00, 60.30},
+		},
+		// Hawaii
+		{
+			{-160.50, 18.80}, {-154.60, 18.80}, {-154.60, 22.40}, {-160.50, 22.40},
+		},
+	}},
+	{"CA", [][]geoPoint{
+		{
+			{-141.00, 69.65}, {-141.00, 60.30}, {-139.00, 60.00}, {-137.50, 59.00}, {-135.50, 59.80},
+			{-133.50, 58.50}, {-131.00, 56.50}, {-130.00, 55.90}, {-130.60, 54.70}, {-133.50, 54.20},
+			{-131.50, 51.50}, {-128.50, 50.50}, {-126.00, 48.80}, {-124.75, 48.50}, {-123.25, 48.25},
+			{-123.20, 48.70}, {-123.00, 49.00}, {-95.15, 49.00}, {-95.15, 49.38}, {-94.80, 49.30},
+			{-94.60, 48.70}, {-93.20, 48.60}, {-89.60, 48.00}, {-88.40, 48.30}, {-84.90, 46.90},
+			{-84.40, 46.50}, {-83.60, 46.10}, {-82.40, 45.30}, {-82.50, 43.00}, {-83.10, 42.10},
+			{-82.70, 41.70}, {-81.00, 42.30}, {-79.00, 42.90}, {-79.20, 43.50}, {-76.50, 43.60},
+			{-76.30, 44.20}, {-74.70, 45.00}, {-71.50, 45.00}, {-70.80, 45.40}, {-70.00, 46.70},
+			{-69.20, 47.45}, {-68.20, 47.35}, {-67.80, 47.10}, {-67.80, 45.70}, {-67.00, 44.90},
+			{-66.90, 44.60}, {-66.00, 43.00}, {-59.00, 43.50}, {-52.00, 46.50}, {-52.00, 52.00},
+			{-55.00, 53.50}, {-62.00, 58.00}, {-63.00, 67.00}, {-73.00, 78.50}, {-60.00, 82.50},
+			{-70.00, 83.20}, {-95.00, 82.00}, {-125.00, 77.00}, {-141.00, 70.00},
+		},
+	}},
+	{"MX", [][]geoPoint{
+		{
+			{-117.12, 32.53}, {-114.70, 32.72}, {-114.80, 32.50}, {-111.07, 31.33}, {-108.20, 31.33},
+			{-108.20, 31.78}, {-106.53, 31.78}, {-106.45, 31.73}, {-104.50, 29.60}, {-103.20, 28.98},
+			{-102.40, 29.80}, {-100.90, 29.30}, {-99.50, 27.50}, {-97.15, 25.95}, {-96.50, 24.00},
+			{-95.00, 18.50}, {-91.00, 18.80}, {-90.50, 21.50}, {-86.50, 21.80}, {-86.70, 20.00},
+			{-87.30, 18.50}, {-88.30, 18.48}, {-89.15, 17.95}, {-89.15, 17.82}, {-90.98, 17.82},
+			{-90.98, 17.25}, {-91.40, 17.25}, {-90.45, 16.07}, {-91.73, 16.07}, {-92.20, 14.53},
+			{-92.50, 14.20}, {-96.00, 15.50}, {-100.00, 16.60}, {-105.70, 20.00}, {-106.00, 23.00},
+			{-109.50, 22.80}, {-110.50, 23.20}, {-112.50, 24.50}, {-115.00, 27.80}, {-116.50, 30.50},
+			{-117.30, 32.50},
+		},
+	}},
+}
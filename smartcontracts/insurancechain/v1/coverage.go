@@ -0,0 +1,303 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Coverage Model Definitions - Coverage types, deductibles and limits of insurance policies
+// ============================================================================================================================
+
+// coverageTypes - types of coverage a policy can have
+var coverageTypes = []string{"THIRD_PARTY_LIABILITY", "COLLISION", "COMPREHENSIVE", "GLASS"}
+
+// defaultCoverageType - coverage a claim against the defendant's policy is paid from when none is given
+const defaultCoverageType = "THIRD_PARTY_LIABILITY"
+
+// legacyCoverage - Get the coverage of policies issued before the coverage model
+//
+// Their claims were paid the full repair quote total, so they get an unlimited third party liability coverage without
+// deductible in the currency amounts were stored in then. The coverage is saved with the next update of the policy.
+func legacyCoverage() []CoverageConcept {
+	return []CoverageConcept{{"insurance.Coverage", defaultCoverageType, Money{0, defaultCurrency}, Money{0, defaultCurrency}, Money{0, defaultCurrency}, Money{0, defaultCurrency}}}
+}
+
+// UnmarshalJSON - Unmarshal an insurance policy, policies stored before the coverage model have the territory as coverage
+func (p *InsurancePolicy) UnmarshalJSON(data []byte) error {
+	type policyAlias InsurancePolicy
+	var value struct {
+		policyAlias
+		Coverage json.RawMessage `json:"coverage"`
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	*p = InsurancePolicy(value.policyAlias)
+
+	if len(value.Coverage) == 0 || string(value.Coverage) == "null" {
+		p.Coverage = legacyCoverage()
+		return nil
+	}
+	if err := json.Unmarshal(value.Coverage, &p.Coverage); err == nil {
+		return nil
+	}
+
+	// === Legacy policy, coverage is a list of country codes
+	var territory []string
+	if err := json.Unmarshal(value.Coverage, &territory); err != nil {
+		return fmt.Errorf("Coverage must be a list of coverages or country codes: %s", err.Error())
+	}
+	p.Coverage = legacyCoverage()
+	if len(p.Territory) == 0 {
+		p.Territory = territory
+	}
+	return nil
+}
+
+// parseCoverages - Unmarshal the coverages of a policy in the given currency and check their deductibles and limits
+//
+// Amounts can be given as Money objects or plain JSON numbers, which are taken in the given currency. A missing or zero
+// limit means the coverage is unlimited.
+func parseCoverages(coveragesAsBytes []byte, currency string) ([]CoverageConcept, error) {
+	var input []struct {
+		Type           string          `json:"type"`
+		Deductible     json.RawMessage `json:"deductible"`
+		PerEventLimit  json.RawMessage `json:"perEventLimit"`
+		AggregateLimit json.RawMessage `json:"aggregateLimit"`
+	}
+	if err := json.Unmarshal(coveragesAsBytes, &input); err != nil {
+		return nil, err
+	}
+	if len(input) == 0 {
+		return nil, fmt.Errorf("At least one coverage is required")
+	}
+
+	coverages := make([]CoverageConcept, len(input))
+	for i, item := range input {
+		coverageType := strings.ToUpper(item.Type)
+		if !isCoverageType(coverageType) {
+			return nil, fmt.Errorf("Coverage %d must be of type %s", i+1, strings.Join(coverageTypes, ", "))
+		}
+		for _, coverage := range coverages[:i] {
+			if coverage.Type == coverageType {
+				return nil, fmt.Errorf("Coverage %s is given more than once", coverageType)
+			}
+		}
+
+		// === Parse amounts, all in the currency of the policy
+		var amounts [3]Money
+		for j, raw := range []json.RawMessage{item.Deductible, item.PerEventLimit, item.AggregateLimit} {
+			amount, err := parseMoneyJSON(raw, currency, false)
+			if err != nil {
+				return nil, fmt.Errorf("Coverage %s: %s", coverageType, err.Error())
+			}
+			if amount.Currency != currency {
+				return nil, fmt.Errorf("Coverage %s must be in %s, got %s", coverageType, currency, amount.Currency)
+			}
+			if amount.MinorUnits < 0 {
+				return nil, fmt.Errorf("Coverage %s has a negative amount: %s", coverageType, amount)
+			}
+			amounts[j] = amount
+		}
+
+		deductible, perEventLimit, aggregateLimit := amounts[0], amounts[1], amounts[2]
+		if !perEventLimit.IsZero() && deductible.MinorUnits >= perEventLimit.MinorUnits {
+			return nil, fmt.Errorf("Coverage %s deductible %s must be below the per-event limit %s", coverageType, deductible, perEventLimit)
+		}
+		if !aggregateLimit.IsZero() && !perEventLimit.IsZero() && aggregateLimit.MinorUnits < perEventLimit.MinorUnits {
+			return nil, fmt.Errorf("Coverage %s aggregate limit %s must not be below the per-event limit %s", coverageType, aggregateLimit, perEventLimit)
+		}
+
+		coverages[i] = CoverageConcept{"insurance.Coverage", coverageType, deductible, perEventLimit, aggregateLimit, Money{0, currency}}
+	}
+
+	return coverages, nil
+}
+
+// isCoverageType - Check if a coverage type is known
+func isCoverageType(coverageType string) bool {
+	for _, knownType := range coverageTypes {
+		if knownType == coverageType {
+			return true
+		}
+	}
+	return false
+}
+
+// findCoverage - Get the coverage of a type of a policy
+func findCoverage(insurancePolicy *InsurancePolicy, coverageType string) (*CoverageConcept, error) {
+	for i := range insurancePolicy.Coverage {
+		if insurancePolicy.Coverage[i].Type == coverageType {
+			return &insurancePolicy.Coverage[i], nil
+		}
+	}
+	return nil, fmt.Errorf("Insurance policy %s has no %s coverage", insurancePolicy.PolicyID, coverageType)
+}
+
+// paidCoverage - Get the coverage of a type of a policy keeping the amount paid from it
+//
+// That is the current coverage or, when an endorsement removed it, the last one replaced by an endorsement. Claims for
+// accidents before the removal are still paid from it.
+func paidCoverage(insurancePolicy *InsurancePolicy, coverageType string) (*CoverageConcept, error) {
+	if coverage, err := findCoverage(insurancePolicy, coverageType); err == nil {
+		return coverage, nil
+	}
+	for i := len(insurancePolicy.Endorsements) - 1; i >= 0; i-- {
+		previousCoverage := insurancePolicy.Endorsements[i].PreviousCoverage
+		for j := range previousCoverage {
+			if previousCoverage[j].Type == coverageType {
+				return &previousCoverage[j], nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Insurance policy %s has no %s coverage", insurancePolicy.PolicyID, coverageType)
+}
+
+// applyCoverage - Apply the defendant's fault, the deductible, per-event limit and remaining aggregate limit of a coverage to
+// a claimed amount
+func applyCoverage(coverage *CoverageConcept, claimedAmount Money, defendantFault Percentage) (*PayoutConcept, error) {
+	if claimedAmount.Currency != coverage.Deductible.Currency {
+		return nil, fmt.Errorf("Claimed amount in %s can't be paid from %s coverage in %s", claimedAmount.Currency, coverage.Type, coverage.Deductible.Currency)
+	}
+	liableAmount, err := claimedAmount.Percent(defendantFault)
+	if err != nil {
+		return nil, err
+	}
+
+	// === Deduct the deductible, never below zero
+	deductible := coverage.Deductible
+	if deductible.MinorUnits > liableAmount.MinorUnits {
+		deductible = liableAmount
+	}
+	payoutAmount, err := liableAmount.Sub(deductible)
+	if err != nil {
+		return nil, err
+	}
+
+	// === Cap at the per-event limit and what is left of the aggregate limit
+	var limitApplied string
+	if !coverage.PerEventLimit.IsZero() && payoutAmount.MinorUnits > coverage.PerEventLimit.MinorUnits {
+		payoutAmount = coverage.PerEventLimit
+		limitApplied = "PER_EVENT"
+	}
+	if !coverage.AggregateLimit.IsZero() {
+		remaining, err := coverage.AggregateLimit.Sub(coverage.PaidTotal)
+		if err != nil {
+			return nil, err
+		}
+		if remaining.MinorUnits < 0 {
+			remaining.MinorUnits = 0
+		}
+		if payoutAmount.MinorUnits > remaining.MinorUnits {
+			payoutAmount = remaining
+			limitApplied = "AGGREGATE"
+		}
+	}
+
+	return &PayoutConcept{"insurance.Payout", coverage.Type, claimedAmount, deductible, limitApplied, payoutAmount, defendantFault, liableAmount}, nil
+}
+
+// payoutForClaim - Calculate the payout of a claim from the coverage of the defendant's policy
+func (t *InsuranceChaincode) payoutForClaim(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim) (*PayoutConcept, *InsurancePolicy, error) {
+	// === Get the policy paying the claim
+	policyAsBytes, err := stub.GetState(insuranceClaim.Defendant)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get insurance policy: %s", err.Error())
+	} else if policyAsBytes == nil {
+		return nil, nil, fmt.Errorf("Insurance policy of defendant doesn't exists: %s", insuranceClaim.Defendant)
+	}
+
+	insurancePolicy := &InsurancePolicy{}
+	if err = json.Unmarshal(policyAsBytes, insurancePolicy); err != nil {
+		return nil, nil, fmt.Errorf("Failed to unmarshal insurance policy: %s", err.Error())
+	}
+
+	// === Get the repair quote total of the claim
+	repairTotal, err := getClaimRepairTotal(stub, insuranceClaim)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// === The agreed or last proposed fault applies, claims without a proposal are paid in full
+	defendantFault := Percentage(100 * percentageScale)
+	if insuranceClaim.Liability != nil && insuranceClaim.Liability.Round > 0 {
+		defendantFault = insuranceClaim.Liability.DefendantFault
+	}
+
+	// === Claims sent before the coverage model are paid from third party liability
+	coverageType := insuranceClaim.CoverageType
+	if coverageType == "" {
+		coverageType = defaultCoverageType
+	}
+
+	// === Apply the deductible and limits of the coverage at the time of the accident to the amount paid so far, a later
+	// endorsement may have changed or removed the coverage
+	policyTerms := *insurancePolicy
+	if len(insurancePolicy.Endorsements) > 0 {
+		reportAsBytes, err := stub.GetState(insuranceClaim.AccidentReport)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Failed to get accident report: %s", err.Error())
+		} else if reportAsBytes == nil {
+			return nil, nil, fmt.Errorf("Accident report of claim doesn't exists: %s", insuranceClaim.AccidentReport)
+		}
+
+		accidentReport := AccidentReport{}
+		if err = json.Unmarshal(reportAsBytes, &accidentReport); err != nil {
+			return nil, nil, fmt.Errorf("Failed to unmarshal accident report: %s", err.Error())
+		}
+		policyTerms = insurancePolicy.asOf(accidentReport.OccuredAt)
+	}
+	termsCoverage, err := findCoverage(&policyTerms, coverageType)
+	if err != nil {
+		return nil, nil, err
+	}
+	paid, err := paidCoverage(insurancePolicy, coverageType)
+	if err != nil {
+		return nil, nil, err
+	}
+	coverage := *termsCoverage
+	coverage.PaidTotal = paid.PaidTotal
+
+	payout, err := applyCoverage(&coverage, repairTotal, defendantFault)
+	if err != nil {
+		return nil, nil, err
+	}
+	return payout, insurancePolicy, nil
+}
+
+// calculatePayout - Calculate the payout of a claim without accepting it
+func (t *InsuranceChaincode) calculatePayout(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer is the caller
+	// 0=claimId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, args[0], caller.ParticipantRef, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	payout, _, err := t.payoutForClaim(stub, insuranceClaim)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	payoutJSONasBytes, err := json.Marshal(payout)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(payoutJSONasBytes)
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestApplyCoverage(t *testing.T) {
+	usd := func(minorUnits int64) Money { return Money{minorUnits, "USD"} }
+	tests := []struct {
+		name       string
+		coverage   CoverageConcept
+		claimed    Money
+		fault      Percentage
+		wantLiable Money
+		wantDeduct Money
+		wantLimit  string
+		wantPayout Money
+		wantErr    bool
+	}{
+		{"no deductible or limits", CoverageConcept{Type: "COLLISION", Deductible: usd(0)}, usd(13060), 100 * percentageScale, usd(13060), usd(0), "", usd(13060), false},
+		{"deductible", CoverageConcept{Type: "COLLISION", Deductible: usd(50000)}, usd(130000), 100 * percentageScale, usd(130000), usd(50000), "", usd(80000), false},
+		{"deductible above claim", CoverageConcept{Type: "COLLISION", Deductible: usd(50000)}, usd(13060), 100 * percentageScale, usd(13060), usd(13060), "", usd(0), false},
+		{"fault before deductible", CoverageConcept{Type: "COLLISION", Deductible: usd(10000)}, usd(100000), 75 * percentageScale, usd(75000), usd(10000), "", usd(65000), false},
+		{"fault rounds half away from zero", CoverageConcept{Type: "COLLISION", Deductible: usd(0)}, usd(1001), 50 * percentageScale, usd(501), usd(0), "", usd(501), false},
+		{"no fault", CoverageConcept{Type: "COLLISION", Deductible: usd(10000)}, usd(100000), 0, usd(0), usd(0), "", usd(0), false},
+		{"per-event limit", CoverageConcept{Type: "COLLISION", Deductible: usd(50000), PerEventLimit: usd(5000000)}, usd(9000000), 100 * percentageScale, usd(9000000), usd(50000), "PER_EVENT", usd(5000000), false},
+		{"at per-event limit", CoverageConcept{Type: "COLLISION", Deductible: usd(50000), PerEventLimit: usd(5000000)}, usd(5050000), 100 * percentageScale, usd(5050000), usd(50000), "", usd(5000000), false},
+		{"remaining aggregate limit", CoverageConcept{Type: "COLLISION", Deductible: usd(0), PerEventLimit: usd(5000000), AggregateLimit: usd(8000000), PaidTotal: usd(6000000)}, usd(3000000), 100 * percentageScale, usd(3000000), usd(0), "AGGREGATE", usd(2000000), false},
+		{"aggregate limit below per-event cap", CoverageConcept{Type: "COLLISION", Deductible: usd(0), PerEventLimit: usd(5000000), AggregateLimit: usd(8000000), PaidTotal: usd(6000000)}, usd(9000000), 100 * percentageScale, usd(9000000), usd(0), "AGGREGATE", usd(2000000), false},
+		{"aggregate limit exhausted", CoverageConcept{Type: "COLLISION", Deductible: usd(0), AggregateLimit: usd(8000000), PaidTotal: usd(9000000)}, usd(100), 100 * percentageScale, usd(100), usd(0), "AGGREGATE", usd(0), false},
+		{"other currency", CoverageConcept{Type: "COLLISION", Deductible: usd(0)}, Money{100, "EUR"}, 100 * percentageScale, Money{}, Money{}, "", Money{}, true},
+	}
+
+	for _, test := range tests {
+		payout, err := applyCoverage(&test.coverage, test.claimed, test.fault)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: applyCoverage error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if payout.LiableAmount != test.wantLiable || payout.Deductible != test.wantDeduct || payout.LimitApplied != test.wantLimit || payout.PayoutAmount != test.wantPayout {
+			t.Errorf("%s: applyCoverage = liable %s, deductible %s, limit %q, payout %s, want %s, %s, %q, %s", test.name,
+				payout.LiableAmount, payout.Deductible, payout.LimitApplied, payout.PayoutAmount, test.wantLiable, test.wantDeduct, test.wantLimit, test.wantPayout)
+		}
+	}
+}
+
+func TestParseCoverages(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		currency string
+		want     []CoverageConcept
+		wantErr  bool
+	}{
+		{"plain numbers in policy currency", `[{"type":"collision","deductible":500,"perEventLimit":50000}]`, "USD",
+			[]CoverageConcept{{"insurance.Coverage", "COLLISION", Money{50000, "USD"}, Money{5000000, "USD"}, Money{0, "USD"}, Money{0, "USD"}}}, false},
+		{"money objects", `[{"type":"GLASS","deductible":{"amount":"100","currency":"EUR"}}]`, "EUR",
+			[]CoverageConcept{{"insurance.Coverage", "GLASS", Money{10000, "EUR"}, Money{0, "EUR"}, Money{0, "EUR"}, Money{0, "EUR"}}}, false},
+		{"unknown type", `[{"type":"THEFT"}]`, "USD", nil, true},
+		{"duplicate type", `[{"type":"GLASS"},{"type":"glass"}]`, "USD", nil, true},
+		{"other currency", `[{"type":"GLASS","deductible":{"amount":"100","currency":"EUR"}}]`, "USD", nil, true},
+		{"negative deductible", `[{"type":"GLASS","deductible":-1}]`, "USD", nil, true},
+		{"deductible at per-event limit", `[{"type":"GLASS","deductible":500,"perEventLimit":500}]`, "USD", nil, true},
+		{"aggregate below per-event limit", `[{"type":"GLASS","perEventLimit":500,"aggregateLimit":400}]`, "USD", nil, true},
+		{"more decimals than the currency", `[{"type":"GLASS","deductible":0.001}]`, "USD", nil, true},
+		{"no coverage", `[]`, "USD", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseCoverages([]byte(test.input), test.currency)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: parseCoverages error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if len(got) != len(test.want) {
+			t.Errorf("%s: parseCoverages = %+v, want %+v", test.name, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%s: coverage %d = %+v, want %+v", test.name, i+1, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+func TestCalculatePayout(t *testing.T) {
+	coverages := []CoverageConcept{
+		{"insurance.Coverage", "THIRD_PARTY_LIABILITY", Money{0, "USD"}, Money{100000000, "USD"}, Money{0, "USD"}, Money{0, "USD"}},
+		{"insurance.Coverage", "COLLISION", Money{50000, "USD"}, Money{5000000, "USD"}, Money{8000000, "USD"}, Money{6000000, "USD"}},
+	}
+
+	tests := []struct {
+		name         string
+		insurer      string
+		coverageType string
+		fault        *Percentage // agreed or proposed fault of the defendant, none before the liability assessment
+		repairTotal  Money
+		wantPayout   string
+		wantLimit    string
+		wantErr      bool
+	}{
+		{"legacy claim paid from liability", "AXA Insurance", "", nil, Money{13060, "USD"}, "130.60 USD", "", false},
+		{"claimant insurer may calculate", "Allsecur Insurance", "", nil, Money{13060, "USD"}, "130.60 USD", "", false},
+		{"collision deductible and fault", "AXA Insurance", "COLLISION", percentage(75), Money{100000, "USD"}, "250.00 USD", "", false},
+		{"collision aggregate limit", "AXA Insurance", "COLLISION", nil, Money{4000000, "USD"}, "20000.00 USD", "AGGREGATE", false},
+		{"coverage missing on policy", "AXA Insurance", "GLASS", nil, Money{13060, "USD"}, "", "", true},
+		{"insurer of neither side", "State Farm", "", nil, Money{13060, "USD"}, "", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			insuranceClaim := &InsuranceClaim{Class: "insurance.InsuranceClaim", ClaimID: "1534181000", Status: "NEW", Claimant: "insurance.InsurancePolicy#USA-AX203-3459802",
+				Defendant: "insurance.InsurancePolicy#USA-AS204-1042919", CostOfRepair: "vehiclerepair.RepairQuote#1534180999", CoverageType: test.coverageType}
+			if test.fault != nil {
+				insuranceClaim.Liability = &LiabilityConcept{Class: "insurance.Liability", Round: 1, DefendantFault: *test.fault}
+			}
+			cc, stub := newTestStub(t, map[string]interface{}{
+				"insurance.InsurancePolicy#USA-AS204-1042919": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AS204-1042919", IssuedBy: "base.Insurer#AXA Insurance", Coverage: coverages},
+				"insurance.InsurancePolicy#USA-AX203-3459802": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AX203-3459802", IssuedBy: "base.Insurer#Allsecur Insurance", Coverage: coverages},
+				"vehiclerepair.RepairQuote#1534180999":        &RepairQuote{Class: "vehiclerepair.RepairQuote", QuoteID: "1534180999", Total: test.repairTotal},
+				"insurance.InsuranceClaim#1534181000":         insuranceClaim,
+			})
+
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.calculatePayout(stub, testCaller("base.Insurer#"+test.insurer), []string{"1534181000"})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("calculatePayout status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			payout := PayoutConcept{}
+			if err := json.Unmarshal(response.Payload, &payout); err != nil {
+				t.Fatal(err)
+			}
+			if payout.PayoutAmount.String() != test.wantPayout || payout.LimitApplied != test.wantLimit {
+				t.Errorf("calculatePayout = %s limit %q, want %s limit %q", payout.PayoutAmount, payout.LimitApplied, test.wantPayout, test.wantLimit)
+			}
+		})
+	}
+}
+
+// percentage - Get a whole percentage
+func percentage(percent int64) *Percentage {
+	p := Percentage(percent * percentageScale)
+	return &p
+}
+
+// legacyPolicyJSON - insurance policy as stored before the coverage model, the coverage holds the territory
+const legacyPolicyJSON = `{"$class":"insurance.InsurancePolicy","policyId":"USA-AS204-1042919","autorisedBy":"State of New Jersey",
+"validFrom":"2018-08-01T00:00:00Z","validTo":"2020-08-01T00:00:00Z","registeredVehicle":"base.Vehicle#1HTZR0007JH586991",
+"countryCode":"USA","insurerCode":"AS204","policyNumber":1042919,"vehicleCategory":"AF","vehicleMake":"Toyota",
+"coverage":["US","CA"],"policyHolder":"base.Registrant#170632064","issuedBy":"base.Insurer#AXA Insurance"}`
+
+func TestUnmarshalLegacyPolicy(t *testing.T) {
+	insurancePolicy := InsurancePolicy{}
+	if err := json.Unmarshal([]byte(legacyPolicyJSON), &insurancePolicy); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(insurancePolicy.Territory, []string{"US", "CA"}) {
+		t.Errorf("territory = %v, want [US CA]", insurancePolicy.Territory)
+	}
+	coverage, err := findCoverage(&insurancePolicy, defaultCoverageType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zero := Money{0, defaultCurrency}
+	if coverage.Deductible != zero || coverage.PerEventLimit != zero || coverage.AggregateLimit != zero {
+		t.Errorf("legacy coverage = %+v, want unlimited without deductible", coverage)
+	}
+	if _, err = findCoverage(&insurancePolicy, "COLLISION"); err == nil {
+		t.Error("legacy policy has COLLISION coverage")
+	}
+}
+
+func TestAcceptClaimOnLegacyPolicy(t *testing.T) {
+	cc, stub := newTestStub(t, map[string]interface{}{
+		"insurance.InsurancePolicy#USA-AS204-1042919": json.RawMessage(legacyPolicyJSON),
+		"insurance.InsurancePolicy#USA-AX203-3459802": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AX203-3459802", IssuedBy: "base.Insurer#Allsecur Insurance"},
+		"vehiclerepair.RepairQuote#1534180999":        json.RawMessage(`{"$class":"vehiclerepair.RepairQuote","quoteId":"1534180999","total":130.60000610351562}`),
+		"insurance.InsuranceClaim#1534181000": &InsuranceClaim{Class: "insurance.InsuranceClaim", ClaimID: "1534181000", Status: "NEW", Claimant: "insurance.InsurancePolicy#USA-AX203-3459802",
+			Defendant: "insurance.InsurancePolicy#USA-AS204-1042919", CostOfRepair: "vehiclerepair.RepairQuote#1534180999"},
+	})
+
+	response := stub.call(t, testTxTime, func() pb.Response {
+		return cc.acceptClaim(stub, testCaller("base.Insurer#AXA Insurance"), []string{"1534181000"})
+	})
+	if response.Status != shim.OK {
+		t.Fatalf("acceptClaim: %s", response.Message)
+	}
+
+	insuranceClaim := InsuranceClaim{}
+	stub.get(t, "insurance.InsuranceClaim#1534181000", &insuranceClaim)
+	if insuranceClaim.Status != "ACCEPTED" || insuranceClaim.Payout == nil || insuranceClaim.Payout.PayoutAmount != (Money{13060, "USD"}) {
+		t.Errorf("claim status %s payout %+v, want ACCEPTED with 130.60 USD", insuranceClaim.Status, insuranceClaim.Payout)
+	}
+
+	// === The legacy coverage is saved with the paid total
+	var stored struct {
+		Coverage  []CoverageConcept `json:"coverage"`
+		Territory []string          `json:"territory"`
+	}
+	if err := json.Unmarshal(stub.State["insurance.InsurancePolicy#USA-AS204-1042919"], &stored); err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Coverage) != 1 || stored.Coverage[0].Type != defaultCoverageType || stored.Coverage[0].PaidTotal != (Money{13060, "USD"}) {
+		t.Errorf("stored coverage = %+v, want %s with 130.60 USD paid", stored.Coverage, defaultCoverageType)
+	}
+	if !reflect.DeepEqual(stored.Territory, []string{"US", "CA"}) {
+		t.Errorf("stored territory = %v, want [US CA]", stored.Territory)
+	}
+}
@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Dispatch Definitions - Nearest emergency services for new accidents
+// ============================================================================================================================
+
+// geohashAlphabet - base32 alphabet of geohashes
+const geohashAlphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+// earthRadiusMeters - mean radius of the earth used for haversine distances
+const earthRadiusMeters = 6371008.8
+
+// dispatchCandidates - number of emergency services ranked for a new accident
+const dispatchCandidates = 3
+
+// dispatchPrecisions - geohash lengths of the ers~geohash index, searched from the finest cells of about 5x5 km to the
+// coarsest of about 156x156 km until enough emergency services are found
+var dispatchPrecisions = []int{5, 4, 3, 2}
+
+// DispatchCandidateConcept - emergency services ranked by distance to an accident
+type DispatchCandidateConcept struct {
+	Class          string `json:"$class"`         // accident.DispatchCandidate
+	ERS            string `json:"ers"`            // Emergency Services class name + # + tradeName
+	DistanceMeters int64  `json:"distanceMeters"` // haversine distance, rounded to meters
+}
+
+// encodeGeohash - Get the geohash of a location with the given number of characters
+func encodeGeohash(latitude float64, longitude float64, precision int) string {
+	latRange := [2]float64{-90, 90}
+	lonRange := [2]float64{-180, 180}
+	geohash := make([]byte, 0, precision)
+
+	// Bits alternate between longitude and latitude, starting with longitude
+	even := true
+	bit, char := 0, 0
+	for len(geohash) < precision {
+		if even {
+			mid := (lonRange[0] + lonRange[1]) / 2
+			if longitude >= mid {
+				char = char<<1 | 1
+				lonRange[0] = mid
+			} else {
+				char = char << 1
+				lonRange[1] = mid
+			}
+		} else {
+			mid := (latRange[0] + latRange[1]) / 2
+			if latitude >= mid {
+				char = char<<1 | 1
+				latRange[0] = mid
+			} else {
+				char = char << 1
+				latRange[1] = mid
+			}
+		}
+		even = !even
+
+		if bit++; bit == 5 {
+			geohash = append(geohash, geohashAlphabet[char])
+			bit, char = 0, 0
+		}
+	}
+	return string(geohash)
+}
+
+// geohashCellSize - Get the height and width in degrees of the geohash cells with the given number of characters
+func geohashCellSize(precision int) (float64, float64) {
+	bits := 5 * precision
+	lonBits := (bits + 1) / 2
+	latBits := bits / 2
+	return 180 / math.Pow(2, float64(latBits)), 360 / math.Pow(2, float64(lonBits))
+}
+
+// geohashNeighbourhood - Get the geohash cell of a location and its eight surrounding cells
+func geohashNeighbourhood(latitude float64, longitude float64, precision int) []string {
+	cellLat, cellLon := geohashCellSize(precision)
+	seen := make(map[string]bool)
+	var cells []string
+
+	for dy := -1; dy <= 1; dy++ {
+		lat := latitude + float64(dy)*cellLat
+		if lat > 90 || lat < -90 {
+			continue // no cells beyond the poles
+		}
+		for dx := -1; dx <= 1; dx++ {
+			lon := longitude + float64(dx)*cellLon
+			if lon >= 180 {
+				lon -= 360
+			} else if lon < -180 {
+				lon += 360
+			}
+			cell := encodeGeohash(lat, lon, precision)
+			if !seen[cell] {
+				seen[cell] = true
+				cells = append(cells, cell)
+			}
+		}
+	}
+	return cells
+}
+
+// ersGeohashKeys - Get the related IDs of a location in the ers~geohash index, one cell per precision
+func ersGeohashKeys(location LocationConcept) []string {
+	var keys []string
+	for _, precision := range dispatchPrecisions {
+		keys = append(keys, encodeGeohash(location.Latitude, location.Longitude, precision))
+	}
+	return keys
+}
+
+// haversineMeters - Get the great-circle distance between two locations
+func haversineMeters(from LocationConcept, to LocationConcept) float64 {
+	lat1 := from.Latitude * math.Pi / 180
+	lat2 := to.Latitude * math.Pi / 180
+	dLat := (to.Latitude - from.Latitude) * math.Pi / 180
+	dLon := (to.Longitude - from.Longitude) * math.Pi / 180
+
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// emergencyServicesAround - Get the emergency services in the geohash cell of a location and its surrounding cells
+func emergencyServicesAround(stub shim.ChaincodeStubInterface, location LocationConcept, precision int) ([]DispatchCandidateConcept, error) {
+	candidates := []DispatchCandidateConcept{}
+	seen := make(map[string]bool)
+
+	for _, cell := range geohashNeighbourhood(location.Latitude, location.Longitude, precision) {
+		ersRecords, err := getIndexedAssets(stub, cell, ersGeohashIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, ersRecord := range ersRecords {
+			if seen[ersRecord.Key] {
+				continue
+			}
+			seen[ersRecord.Key] = true
+
+			ers := EmergencyServices{}
+			if err = json.Unmarshal(ersRecord.Record, &ers); err != nil {
+				return nil, fmt.Errorf("Failed to unmarshal emergency services %s: %s", ersRecord.Key, err.Error())
+			}
+			distance := int64(math.Round(haversineMeters(location, ers.Location)))
+			candidates = append(candidates, DispatchCandidateConcept{"accident.DispatchCandidate", ersRecord.Key, distance})
+		}
+	}
+	return candidates, nil
+}
+
+// nearestEmergencyServices - Rank the registered emergency services nearest to a location
+//
+// The geohash cells around the location are searched from fine to coarse until enough emergency services are found, so
+// only the index entries of nearby units are read. The cells around a location reach at least one cell size in every
+// direction, but the units found may be farther than that, so the search is widened by one more precision to catch
+// nearer units just outside the cells. When the coarsest precision is reached before enough units are found, units
+// beyond its cells are left out and the ranking is approximate.
+func nearestEmergencyServices(stub shim.ChaincodeStubInterface, location LocationConcept) ([]DispatchCandidateConcept, error) {
+	var candidates []DispatchCandidateConcept
+	var err error
+
+	for i, precision := range dispatchPrecisions {
+		candidates, err = emergencyServicesAround(stub, location, precision)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(candidates) >= dispatchCandidates {
+			if i+1 < len(dispatchPrecisions) {
+				candidates, err = emergencyServicesAround(stub, location, dispatchPrecisions[i+1])
+				if err != nil {
+					return nil, err
+				}
+			}
+			break
+		}
+	}
+
+	// === Nearest first, equal distances in order of the reference to keep the ranking deterministic
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].DistanceMeters != candidates[j].DistanceMeters {
+			return candidates[i].DistanceMeters < candidates[j].DistanceMeters
+		}
+		return candidates[i].ERS < candidates[j].ERS
+	})
+	if len(candidates) > dispatchCandidates {
+		candidates = candidates[:dispatchCandidates]
+	}
+	return candidates, nil
+}
+
+// claimReport - Claim a new accident report by the calling emergency services
+func (t *InsuranceChaincode) claimReport(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the responding ERS is the caller
+	// 0=accidentId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	accidentID := args[0]
+
+	// === Check if AccidentReport asset exists
+	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
+	reportAsBytes, err := stub.GetState(accidentRef)
+	if err != nil {
+		return shim.Error("Failed to get accident report: " + err.Error())
+	} else if reportAsBytes == nil {
+		return shim.Error("This accident report doesn't exists: " + accidentRef)
+	}
+
+	// === Unmarshal the report to an object
+	accidentReport := &AccidentReport{}
+	if err = json.Unmarshal(reportAsBytes, accidentReport); err != nil {
+		return shim.Error("Failed to unmarshal accident report: " + err.Error())
+	}
+
+	// === Only reports nobody responds to yet can be claimed
+	if accidentReport.RespondingERS != "" {
+		return shim.Error("Emergency Services already responding: " + accidentReport.RespondingERS)
+	}
+	if err = t.transitionReport(accidentReport, "RESPONDING"); err != nil {
+		return shim.Error(err.Error())
+	}
+	accidentReport.RespondingERS = caller.ParticipantRef
+
+	// === Any emergency services may respond, the reason tells if it was dispatched
+	reason := fmt.Sprintf("Emergency Services (%s) claimed accident, not among the dispatch candidates", caller.ParticipantID)
+	for rank, candidate := range accidentReport.DispatchCandidates {
+		if candidate.ERS == caller.ParticipantRef {
+			reason = fmt.Sprintf("Emergency Services (%s) claimed accident as dispatch candidate %d at %d meters", caller.ParticipantID, rank+1, candidate.DistanceMeters)
+			break
+		}
+	}
+
+	return t.saveReportUpdate(stub, accidentID, accidentReport, []string{reason}, []string{"ERS_ASSIGNED"})
+}
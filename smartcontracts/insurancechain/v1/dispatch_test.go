@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestEncodeGeohash(t *testing.T) {
+	tests := []struct {
+		latitude  float64
+		longitude float64
+		precision int
+		want      string
+	}{
+		{57.64911, 10.40744, 11, "u4pruydqqvj"},
+		{42.605, -5.603, 5, "ezs42"},
+		{0, 0, 1, "s"},
+		{-90, -180, 2, "00"},
+		{89.99, 179.99, 2, "zz"},
+	}
+
+	for _, test := range tests {
+		if got := encodeGeohash(test.latitude, test.longitude, test.precision); got != test.want {
+			t.Errorf("encodeGeohash(%f, %f, %d) = %s, want %s", test.latitude, test.longitude, test.precision, got, test.want)
+		}
+	}
+}
+
+func TestGeohashNeighbourhood(t *testing.T) {
+	tests := []struct {
+		name      string
+		latitude  float64
+		longitude float64
+		precision int
+		wantCells int
+		wantAlso  []geoPoint // locations whose cells must be in the neighbourhood
+	}{
+		{"inland", 40.849496, -73.936206, 5, 9, nil},
+		{"east of antimeridian", 10, 179.99, 2, 9, []geoPoint{{-179.99, 10}}},
+		{"west of antimeridian", 10, -179.99, 2, 9, []geoPoint{{179.99, 10}}},
+		{"north pole", 89.99, 10, 2, 6, nil},
+		{"south pole", -89.99, 10, 2, 6, nil},
+	}
+
+	for _, test := range tests {
+		cells := geohashNeighbourhood(test.latitude, test.longitude, test.precision)
+		if len(cells) != test.wantCells {
+			t.Errorf("%s: %d cells %v, want %d", test.name, len(cells), cells, test.wantCells)
+		}
+
+		found := make(map[string]bool)
+		for _, cell := range cells {
+			if len(cell) != test.precision || found[cell] {
+				t.Errorf("%s: invalid or duplicate cell %s", test.name, cell)
+			}
+			found[cell] = true
+		}
+		wantAlso := append(test.wantAlso, geoPoint{test.longitude, test.latitude})
+		for _, point := range wantAlso {
+			if cell := encodeGeohash(point.Latitude, point.Longitude, test.precision); !found[cell] {
+				t.Errorf("%s: cell %s of (%f, %f) missing in %v", test.name, cell, point.Longitude, point.Latitude, cells)
+			}
+		}
+	}
+}
+
+func TestHaversineMeters(t *testing.T) {
+	tests := []struct {
+		name      string
+		from      LocationConcept
+		to        LocationConcept
+		want      float64
+		tolerance float64
+	}{
+		{"same location", LocationConcept{"", -73.936206, 40.849496, ""}, LocationConcept{"", -73.936206, 40.849496, ""}, 0, 0},
+		{"London to Paris", LocationConcept{"", -0.1278, 51.5074, ""}, LocationConcept{"", 2.3522, 48.8566, ""}, 343560, 500},
+		{"quarter of the equator", LocationConcept{"", 0, 0, ""}, LocationConcept{"", 90, 0, ""}, math.Pi / 2 * earthRadiusMeters, 1},
+		{"across the antimeridian", LocationConcept{"", 179.5, 0, ""}, LocationConcept{"", -179.5, 0, ""}, math.Pi / 180 * earthRadiusMeters, 1},
+		{"antipodes", LocationConcept{"", 0, 0, ""}, LocationConcept{"", 180, 0, ""}, math.Pi * earthRadiusMeters, 1},
+	}
+
+	for _, test := range tests {
+		if got := haversineMeters(test.from, test.to); math.Abs(got-test.want) > test.tolerance {
+			t.Errorf("%s: haversineMeters = %f, want %f", test.name, got, test.want)
+		}
+		if got, back := haversineMeters(test.from, test.to), haversineMeters(test.to, test.from); math.Abs(got-back) > 1e-6 {
+			t.Errorf("%s: haversineMeters isn't symmetric, %f and %f", test.name, got, back)
+		}
+	}
+}
+
+// putEmergencyServices - Store emergency services with their geohash index entries
+func putEmergencyServices(t *testing.T, stub shim.ChaincodeStubInterface, tradeName string, longitude float64, latitude float64) {
+	ers := &EmergencyServices{"base.EmergencyServices", CompanyAbstract{tradeName, AddressConcept{}}, LocationConcept{"accident.Location", longitude, latitude, ""}}
+	ersJSONasBytes, err := json.Marshal(ers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stub.PutState("base.EmergencyServices#"+tradeName, ersJSONasBytes); err != nil {
+		t.Fatal(err)
+	}
+	if err = putAssetIndexes(stub, "base.EmergencyServices", tradeName, ersJSONasBytes); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNearestEmergencyServices(t *testing.T) {
+	// Location near the west edge of its finest cell, units east of it are inside its neighbourhood, units west aren't
+	cellLat, cellLon := geohashCellSize(dispatchPrecisions[0])
+	west := math.Floor((-73.9+180)/cellLon)*cellLon - 180
+	latitude := math.Floor((40.8+90)/cellLat)*cellLat - 90 + cellLat/2
+	location := LocationConcept{"accident.Location", west + 0.05*cellLon, latitude, ""}
+
+	type unit struct {
+		tradeName string
+		longitude float64
+		latitude  float64
+	}
+	tests := []struct {
+		name  string
+		units []unit
+		want  []string
+	}{
+		{"no units", nil, []string{}},
+		{"fewer units than candidates", []unit{{"Far", -71.07, 42.33}, {"Near", west + 0.5*cellLon, latitude}}, []string{"Near", "Far"}},
+		{"units beyond the coarsest cells are left out", []unit{{"Los Angeles", -118.24, 34.05}}, []string{}},
+		{"nearest first", []unit{{"C", west + 1.9*cellLon, latitude}, {"A", west + 0.5*cellLon, latitude}, {"B", west + 1.2*cellLon, latitude}, {"D", -74.5, 40.5}}, []string{"A", "B", "C"}},
+		{"equal distances by reference", []unit{{"B", west + 0.5*cellLon, latitude}, {"A", west + 0.5*cellLon, latitude}, {"C", west + 0.5*cellLon, latitude}}, []string{"A", "B", "C"}},
+		{"nearer unit just outside the first cells", []unit{{"E1", west + 1.9*cellLon, latitude}, {"E2", west + 1.9*cellLon, latitude + 0.001}, {"E3", west + 1.9*cellLon, latitude + 0.002}, {"W", west - 1.2*cellLon, latitude}}, []string{"W", "E1", "E2"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, stub := newTestStub(t, nil)
+			stub.call(t, testTxTime, func() pb.Response {
+				for _, u := range test.units {
+					putEmergencyServices(t, stub, u.tradeName, u.longitude, u.latitude)
+				}
+				return shim.Success(nil)
+			})
+
+			candidates, err := nearestEmergencyServices(stub, location)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := []string{}
+			for i, candidate := range candidates {
+				got = append(got, assetIDFromRef(candidate.ERS))
+				if i > 0 && candidate.DistanceMeters < candidates[i-1].DistanceMeters {
+					t.Errorf("candidate %d is nearer than candidate %d", i+1, i)
+				}
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("nearestEmergencyServices = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Fraud Scoring Definitions - Signals of new claims flagged for review by the special investigation unit (SIU)
+// ============================================================================================================================
+
+// Fraud rule codes
+const (
+	fraudRepeatAccidents   = "REPEAT_ACCIDENTS"          // vehicle involved in other accidents shortly before or after
+	fraudNewPolicy         = "NEW_POLICY"                // claimant policy started shortly before the accident
+	fraudQuoteAboveMedian  = "QUOTE_ABOVE_MEDIAN"        // repair quote far above the median for the make and model
+	fraudRecurringShopPair = "RECURRING_SHOP_REGISTRANT" // same repair shop and registrant in earlier claims
+)
+
+// fraudRuleWeights - score added by each triggered rule, the scores add up to 100
+var fraudRuleWeights = map[string]int{
+	fraudRepeatAccidents:   30,
+	fraudNewPolicy:         25,
+	fraudQuoteAboveMedian:  25,
+	fraudRecurringShopPair: 20,
+}
+
+// Fraud rule parameters
+const (
+	fraudRepeatWindowDays  = 90 // other accidents of the vehicle within this many days
+	fraudNewPolicyDays     = 30 // accident within this many days after the first term of the policy started
+	fraudMedianFactor      = 2  // quote total above this multiple of the median
+	fraudMedianMinSamples  = 3  // awarded quotes of the make and model needed for a median
+	fraudMedianMaxSamples  = 50 // most recent awarded quotes of the make and model the median is taken from
+	fraudReviewThreshold   = 50 // claims scoring at least this are suspicious
+	fraudPairPreviousClaim = 1  // earlier claims of the same repair shop and registrant
+)
+
+// FraudRuleConcept - triggered fraud rule type
+type FraudRuleConcept struct {
+	Class  string `json:"$class"` // insurance.FraudRule
+	Code   string `json:"code"`   // This can be REPEAT_ACCIDENTS, NEW_POLICY, QUOTE_ABOVE_MEDIAN or RECURRING_SHOP_REGISTRANT
+	Weight int    `json:"weight"`
+	Detail string `json:"detail"`
+}
+
+// FraudAssessmentConcept - fraud assessment type, scored when a claim is sent
+type FraudAssessmentConcept struct {
+	Class      string             `json:"$class"` // insurance.FraudAssessment
+	Score      int                `json:"score"`  // sum of the weights of the triggered rules, 0 to 100
+	Suspicious bool               `json:"suspicious"`
+	Rules      []FraudRuleConcept `json:"rules"`
+	AssessedAt time.Time          `json:"assessedAt"`
+	Registrant string             `json:"registrant"` // Registrant class name + # + identificationNumber, holder of the claimant policy
+	RepairShop string             `json:"repairShop"` // Repair shop class name + # + tradeName, estimator of the repair quote
+}
+
+// vehicleModelKey - Get the key of a make and model in the award~model index, empty if either is unknown
+func vehicleModelKey(vehicleMake string, vehicleModel string) string {
+	if vehicleMake == "" || vehicleModel == "" {
+		return ""
+	}
+	return strings.ToUpper(vehicleMake + "|" + vehicleModel)
+}
+
+// shopRegistrantKey - Get the related ID of a repair shop and registrant pair in the claim~pair index
+func shopRegistrantKey(shopRef string, registrantRef string) string {
+	if shopRef == "" || registrantRef == "" {
+		return ""
+	}
+	return assetIDFromRef(shopRef) + "|" + assetIDFromRef(registrantRef)
+}
+
+// assessClaimFraud - Score the fraud signals of a new claim before it is saved
+func assessClaimFraud(stub shim.ChaincodeStubInterface, accidentReport *AccidentReport, claimantPolicy *InsurancePolicy, quoteRequest *QuoteRequest, repairQuote *RepairQuote) (*FraudAssessmentConcept, error) {
+	assessedAt, err := getTxTime(stub)
+	if err != nil {
+		return nil, err
+	}
+	assessment := &FraudAssessmentConcept{"insurance.FraudAssessment", 0, false, []FraudRuleConcept{}, assessedAt, claimantPolicy.PolicyHolder, repairQuote.Estimator}
+	trigger := func(code string, detail string) {
+		assessment.Rules = append(assessment.Rules, FraudRuleConcept{"insurance.FraudRule", code, fraudRuleWeights[code], detail})
+		assessment.Score += fraudRuleWeights[code]
+	}
+
+	// === Vehicle appears in several accidents within the window
+	accidentRef := fmt.Sprintf("%s#%s", accidentReport.Class, accidentReport.AccidentID)
+	reportRecords, err := getIndexedAssets(stub, assetIDFromRef(claimantPolicy.RegisteredVehicle), reportVehicleIndex)
+	if err != nil {
+		return nil, err
+	}
+	window := time.Duration(fraudRepeatWindowDays) * 24 * time.Hour
+	otherAccidents := 0
+	for _, reportRecord := range reportRecords {
+		if reportRecord.Key == accidentRef {
+			continue
+		}
+		otherReport := AccidentReport{}
+		if err = json.Unmarshal(reportRecord.Record, &otherReport); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal accident report %s: %s", reportRecord.Key, err.Error())
+		}
+		gap := otherReport.OccuredAt.Sub(accidentReport.OccuredAt)
+		if gap <= window && gap >= -window {
+			otherAccidents++
+		}
+	}
+	if otherAccidents > 0 {
+		trigger(fraudRepeatAccidents, fmt.Sprintf("Vehicle involved in %d other accidents within %d days", otherAccidents, fraudRepeatWindowDays))
+	}
+
+	// === First term of the policy started shortly before the accident, renewals don't count
+	sincePolicyStart := accidentReport.OccuredAt.Sub(claimantPolicy.ValidFrom)
+	if claimantPolicy.PreviousTerm == "" && sincePolicyStart < time.Duration(fraudNewPolicyDays)*24*time.Hour {
+		trigger(fraudNewPolicy, fmt.Sprintf("Policy started %d days before the accident", int(sincePolicyStart.Hours()/24)))
+	}
+
+	// === Repair quote far above the median of awarded quotes for the make and model
+	median, samples, err := awardedQuoteMedian(stub, quoteRequest, repairQuote.Total.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if samples >= fraudMedianMinSamples && repairQuote.Total.MinorUnits > fraudMedianFactor*median.MinorUnits {
+		trigger(fraudQuoteAboveMedian, fmt.Sprintf("Quote total %s is above %dx the median %s of %d quotes", repairQuote.Total, fraudMedianFactor, median, samples))
+	}
+
+	// === Same repair shop and registrant in earlier claims
+	pairKey := shopRegistrantKey(assessment.RepairShop, assessment.Registrant)
+	if pairKey != "" {
+		claimIDs, err := getIndexedAssetIDs(stub, claimPairIndex, pairKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(claimIDs) >= fraudPairPreviousClaim {
+			trigger(fraudRecurringShopPair, fmt.Sprintf("Repair shop and registrant met in %d earlier claims", len(claimIDs)))
+		}
+	}
+
+	assessment.Suspicious = assessment.Score >= fraudReviewThreshold
+	return assessment, nil
+}
+
+// awardSampleKey - Get the award~model key of an awarded request, the most recent awards sort first
+func awardSampleKey(stub shim.ChaincodeStubInterface, modelKey string, requestID string, awardedAt time.Time) (string, error) {
+	recency := fmt.Sprintf("%019d", math.MaxInt64-awardedAt.UnixNano())
+	return stub.CreateCompositeKey(awardModelIndex, []string{modelKey, recency, requestID})
+}
+
+// awardRequestKey - Get the award~request key of an awarded request, its value is the key of the request's sample
+func awardRequestKey(stub shim.ChaincodeStubInterface, requestID string) (string, error) {
+	return stub.CreateCompositeKey(awardRequestIndex, []string{requestID})
+}
+
+// putAwardSample - Store the total of an awarded quote as sample of the median for the make and model, once per request
+func putAwardSample(stub shim.ChaincodeStubInterface, quoteRequest *QuoteRequest, total Money, awardedAt time.Time) error {
+	modelKey := vehicleModelKey(quoteRequest.VehicleMake, quoteRequest.VehicleModel)
+	if modelKey == "" {
+		return nil
+	}
+
+	// === The award time is part of the sample key, so the award~request entry tells if the request is sampled already
+	requestKey, err := awardRequestKey(stub, quoteRequest.RequestID)
+	if err != nil {
+		return err
+	}
+	sampledAsBytes, err := stub.GetState(requestKey)
+	if err != nil {
+		return fmt.Errorf("Failed to get award sample of quote request: %s", err.Error())
+	} else if sampledAsBytes != nil {
+		return nil
+	}
+
+	sampleKey, err := awardSampleKey(stub, modelKey, quoteRequest.RequestID, awardedAt)
+	if err != nil {
+		return err
+	}
+	totalJSONasBytes, err := json.Marshal(total)
+	if err != nil {
+		return err
+	}
+	if err = stub.PutState(sampleKey, totalJSONasBytes); err != nil {
+		return err
+	}
+	return stub.PutState(requestKey, []byte(sampleKey))
+}
+
+// reindexAwardSample - Store the sample of a quote request awarded before the award~model index existed
+//
+// The award time isn't recorded on the request, so backfilled samples count as awarded at the time of the reindex.
+// Samples stored before the award~request index existed are adopted, the oldest one is kept and the duplicates of
+// earlier reindex runs are deleted.
+func reindexAwardSample(stub shim.ChaincodeStubInterface, requestAsBytes []byte, reindexedAt time.Time) error {
+	quoteRequest := QuoteRequest{}
+	if err := json.Unmarshal(requestAsBytes, &quoteRequest); err != nil {
+		return fmt.Errorf("Failed to unmarshal quote request: %s", err.Error())
+	}
+	modelKey := vehicleModelKey(quoteRequest.VehicleMake, quoteRequest.VehicleModel)
+	if quoteRequest.AwardedQuote == "" || modelKey == "" {
+		return nil
+	}
+
+	requestKey, err := awardRequestKey(stub, quoteRequest.RequestID)
+	if err != nil {
+		return err
+	}
+	sampledAsBytes, err := stub.GetState(requestKey)
+	if err != nil {
+		return fmt.Errorf("Failed to get award sample of quote request: %s", err.Error())
+	} else if sampledAsBytes != nil {
+		return nil
+	}
+
+	// === Find earlier samples of the request, the most recent sort first
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(awardModelIndex, []string{modelKey})
+	if err != nil {
+		return fmt.Errorf("Failed to query index %s: %s", awardModelIndex, err.Error())
+	}
+	var sampleKeys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			resultsIterator.Close()
+			return err
+		}
+		_, attributes, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			resultsIterator.Close()
+			return err
+		}
+		if attributes[2] == quoteRequest.RequestID {
+			sampleKeys = append(sampleKeys, queryResponse.Key)
+		}
+	}
+	resultsIterator.Close()
+
+	if len(sampleKeys) > 0 {
+		oldest := sampleKeys[len(sampleKeys)-1]
+		for _, sampleKey := range sampleKeys[:len(sampleKeys)-1] {
+			if err = stub.DelState(sampleKey); err != nil {
+				return err
+			}
+		}
+		return stub.PutState(requestKey, []byte(oldest))
+	}
+
+	quoteAsBytes, err := stub.GetState(quoteRequest.AwardedQuote)
+	if err != nil {
+		return fmt.Errorf("Failed to get repair quote: %s", err.Error())
+	} else if quoteAsBytes == nil {
+		return nil
+	}
+	repairQuote := RepairQuote{}
+	if err = json.Unmarshal(quoteAsBytes, &repairQuote); err != nil {
+		return fmt.Errorf("Failed to unmarshal repair quote %s: %s", quoteRequest.AwardedQuote, err.Error())
+	}
+	return putAwardSample(stub, &quoteRequest, repairQuote.Total, reindexedAt)
+}
+
+// awardedQuoteMedian - Get the median total of the most recent awarded quotes of other requests for the same make and model
+//
+// Returns the median and the number of quotes it is taken from, quotes in other currencies are left out. At most
+// fraudMedianMaxSamples index entries are read, so the read set of a claim stays bounded however popular the model is.
+func awardedQuoteMedian(stub shim.ChaincodeStubInterface, quoteRequest *QuoteRequest, currency string) (Money, int, error) {
+	modelKey := vehicleModelKey(quoteRequest.VehicleMake, quoteRequest.VehicleModel)
+	if modelKey == "" {
+		return Money{0, currency}, 0, nil
+	}
+
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(awardModelIndex, []string{modelKey})
+	if err != nil {
+		return Money{}, 0, fmt.Errorf("Failed to query index %s: %s", awardModelIndex, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var totals []int64
+	for read := 0; read < fraudMedianMaxSamples && resultsIterator.HasNext(); read++ {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return Money{}, 0, err
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return Money{}, 0, err
+		}
+		if attributes[2] == quoteRequest.RequestID {
+			continue
+		}
+
+		total := Money{}
+		if err = json.Unmarshal(queryResponse.Value, &total); err != nil {
+			return Money{}, 0, fmt.Errorf("Failed to unmarshal awarded total %s: %s", queryResponse.Key, err.Error())
+		}
+		if total.Currency == currency {
+			totals = append(totals, total.MinorUnits)
+		}
+	}
+	if len(totals) == 0 {
+		return Money{0, currency}, 0, nil
+	}
+
+	sort.Slice(totals, func(i, j int) bool { return totals[i] < totals[j] })
+	middle := len(totals) / 2
+	median := totals[middle]
+	if len(totals)%2 == 0 {
+		median = (totals[middle-1] + totals[middle]) / 2
+	}
+	return Money{median, currency}, len(totals), nil
+}
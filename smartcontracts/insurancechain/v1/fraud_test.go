@@ -0,0 +1,174 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// awardSampleKeys - Get the keys of the award~model index of a make and model, the most recent awards first
+func awardSampleKeys(t *testing.T, stub *testStub, modelKey string) []string {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(awardModelIndex, []string{modelKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resultsIterator.Close()
+
+	var sampleKeys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sampleKeys = append(sampleKeys, queryResponse.Key)
+	}
+	return sampleKeys
+}
+
+func TestSendClaimFraud(t *testing.T) {
+	// Signals added to the test claim, which triggers NEW_POLICY as the claimant policy started 14 days before the accident
+	otherAccident := func(t *testing.T, stub *testStub) {
+		stub.put(t, map[string]interface{}{"accident.AccidentReport#1530000000": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1530000000",
+			OccuredAt: claimOccuredAt.AddDate(0, 0, -60), InvolvedGoods: GoodsConcept{"accident.Goods", []string{"base.Vehicle#JN6ND01S3GX194659"}}}})
+		stub.call(t, testTxTime, func() pb.Response {
+			if err := putAssetIndexes(stub, "accident.AccidentReport", "1530000000", stub.State["accident.AccidentReport#1530000000"]); err != nil {
+				t.Fatal(err)
+			}
+			return shim.Success(nil)
+		})
+	}
+	cheapAwards := func(t *testing.T, stub *testStub) {
+		stub.call(t, testTxTime, func() pb.Response {
+			for i, total := range []int64{4000, 5000, 6000} {
+				quoteRequest := &QuoteRequest{RequestID: fmt.Sprintf("15200000%02d", i), VehicleMake: "Nissan", VehicleModel: "Rogue"}
+				if err := putAwardSample(stub, quoteRequest, Money{total, "USD"}, testTxTime.Add(time.Duration(i)*time.Hour)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			return shim.Success(nil)
+		})
+	}
+	earlierClaim := func(t *testing.T, stub *testStub) {
+		stub.call(t, testTxTime, func() pb.Response {
+			pairKey := shopRegistrantKey("base.RepairShop#Joe's Garage", "base.Registrant#170632063")
+			indexKey, err := stub.CreateCompositeKey(claimPairIndex, []string{pairKey, "1520000000"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = stub.PutState(indexKey, []byte{0x00}); err != nil {
+				t.Fatal(err)
+			}
+			return shim.Success(nil)
+		})
+	}
+	renewedPolicy := func(t *testing.T, stub *testStub) {
+		insurancePolicy := InsurancePolicy{}
+		stub.get(t, "insurance.InsurancePolicy#USA-AX203-3459802", &insurancePolicy)
+		insurancePolicy.PreviousTerm = "insurance.InsurancePolicy#USA-AX203-3459801"
+		stub.put(t, map[string]interface{}{"insurance.InsurancePolicy#USA-AX203-3459802": &insurancePolicy})
+	}
+
+	tests := []struct {
+		name      string
+		signals   []func(*testing.T, *testStub)
+		wantEvent string
+		wantScore int
+		wantRules []string
+	}{
+		{"renewed policy", []func(*testing.T, *testStub){renewedPolicy}, "NewClaimEvent", 0, nil},
+		{"new policy", nil, "NewClaimEvent", 25, []string{fraudNewPolicy}},
+		{"new policy and repeat accidents", []func(*testing.T, *testStub){otherAccident}, "SuspiciousClaimEvent", 55, []string{fraudRepeatAccidents, fraudNewPolicy}},
+		{"quote above median", []func(*testing.T, *testStub){renewedPolicy, cheapAwards}, "NewClaimEvent", 25, []string{fraudQuoteAboveMedian}},
+		{"recurring pair", []func(*testing.T, *testStub){renewedPolicy, earlierClaim}, "NewClaimEvent", 20, []string{fraudRecurringShopPair}},
+		{"all signals", []func(*testing.T, *testStub){otherAccident, cheapAwards, earlierClaim}, "SuspiciousClaimEvent", 100,
+			[]string{fraudRepeatAccidents, fraudNewPolicy, fraudQuoteAboveMedian, fraudRecurringShopPair}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newClaimStub(t)
+			for _, signal := range test.signals {
+				signal(t, stub)
+			}
+
+			claimRef := sendTestClaim(t, cc, stub)
+			insuranceClaim := InsuranceClaim{}
+			stub.get(t, claimRef, &insuranceClaim)
+			var rules []string
+			for _, rule := range insuranceClaim.Fraud.Rules {
+				rules = append(rules, rule.Code)
+			}
+			if insuranceClaim.Fraud.Score != test.wantScore || !reflect.DeepEqual(rules, test.wantRules) {
+				t.Errorf("fraud assessment = score %d rules %v, want %d %v", insuranceClaim.Fraud.Score, rules, test.wantScore, test.wantRules)
+			}
+
+			// === Suspicious claims only emit the SuspiciousClaim event, it carries the claim
+			eventName, payload := stub.lastEvent(t)
+			if eventName != test.wantEvent {
+				t.Fatalf("event = %s, want %s", eventName, test.wantEvent)
+			}
+			if eventName == "SuspiciousClaimEvent" {
+				suspiciousClaim := SuspiciousClaimEvent{}
+				if err := json.Unmarshal(payload, &suspiciousClaim); err != nil {
+					t.Fatal(err)
+				}
+				if "insurance.InsuranceClaim#"+suspiciousClaim.ClaimID != claimRef || suspiciousClaim.DefendantID != "USA-AS204-1042919" ||
+					suspiciousClaim.Score != test.wantScore || !reflect.DeepEqual(suspiciousClaim.Rules, test.wantRules) {
+					t.Errorf("suspicious claim event = %+v", suspiciousClaim)
+				}
+			}
+		})
+	}
+}
+
+func TestReindexAwardSample(t *testing.T) {
+	cc, stub := newClaimStub(t)
+
+	// === Samples of reindex runs before the award~request index, keyed by the time of each run
+	stub.call(t, testTxTime, func() pb.Response {
+		for _, reindexedAt := range []time.Time{testTxTime.Add(time.Hour), testTxTime.Add(2 * time.Hour)} {
+			sampleKey, err := awardSampleKey(stub, "NISSAN|ROGUE", "1534180900", reindexedAt)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = stub.PutState(sampleKey, []byte(`{"amount":"120.00","currency":"USD"}`)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return shim.Success(nil)
+	})
+	oldestKey, err := awardSampleKey(stub, "NISSAN|ROGUE", "1534180900", testTxTime.Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// === Reindexing keeps the oldest sample and doesn't add one on later runs
+	for _, reindexedAt := range []time.Time{testTxTime.Add(3 * time.Hour), testTxTime.Add(4 * time.Hour)} {
+		response := stub.call(t, reindexedAt, func() pb.Response {
+			return cc.reindexAssets(stub, []string{})
+		})
+		if response.Status != shim.OK {
+			t.Fatalf("reindexAssets status = %d %s", response.Status, response.Message)
+		}
+		if sampleKeys := awardSampleKeys(t, stub, "NISSAN|ROGUE"); !reflect.DeepEqual(sampleKeys, []string{oldestKey}) {
+			t.Fatalf("samples after reindex at %s = %q, want only the oldest", reindexedAt, sampleKeys)
+		}
+	}
+
+	// === A request is sampled once, whenever its award is stored again
+	stub.call(t, testTxTime.Add(5*time.Hour), func() pb.Response {
+		quoteRequest := &QuoteRequest{RequestID: "1534180900", VehicleMake: "Nissan", VehicleModel: "Rogue"}
+		if err := putAwardSample(stub, quoteRequest, Money{12000, "USD"}, testTxTime.Add(5*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		return shim.Success(nil)
+	})
+	if sampleKeys := awardSampleKeys(t, stub, "NISSAN|ROGUE"); len(sampleKeys) != 1 {
+		t.Errorf("samples = %q, want 1", sampleKeys)
+	}
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// History Definitions - Audit trail of assets built from the history database
+// ============================================================================================================================
+
+// submitterIndex - composite key of the submitter of a transaction, with the attributes [tx ID]
+const submitterIndex = "submitter~tx"
+
+// readOnlyFunctions - functions which don't write state, so no submitter is recorded for them
+var readOnlyFunctions = map[string]bool{
+	"readAssetData":            true,
+	"queryAssets":              true,
+	"getPoliciesForVehicle":    true,
+	"getClaimsForPolicy":       true,
+	"getQuotesForRequest":      true,
+	"getRequestsForAccident":   true,
+	"getReportsForVehicle":     true,
+	"getStatementsForAccident": true,
+	"getAssetHistory":          true,
+	"calculatePayout":          true,
+}
+
+// diffClasses - classes for which the history contains the changes between consecutive versions
+var diffClasses = map[string]bool{
+	"accident.AccidentReport":  true,
+	"insurance.InsuranceClaim": true,
+}
+
+// Submitter - identity which submitted a transaction, the history database doesn't keep it
+type Submitter struct {
+	Class       string `json:"$class"`
+	TxID        string `json:"txId"`
+	MSPID       string `json:"mspId"`
+	ID          string `json:"id"`
+	CommonName  string `json:"commonName,omitempty"`
+	Participant string `json:"participant,omitempty"` // participant class name + # + participant ID
+}
+
+// FieldChange - change of a single field between two versions of an asset, the path is dot separated with array indexes
+type FieldChange struct {
+	Path string      `json:"path"`
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// AssetVersion - single version of an asset from the history database
+type AssetVersion struct {
+	TxID      string          `json:"txId"`
+	Timestamp time.Time       `json:"timestamp"`
+	IsDelete  bool            `json:"isDelete"`
+	Submitter *Submitter      `json:"submitter"`
+	Value     json.RawMessage `json:"value"`
+	Changes   []FieldChange   `json:"changes,omitempty"`
+}
+
+// recordSubmitter - Store the identity submitting the transaction, so the history of assets can show who changed them
+func recordSubmitter(stub shim.ChaincodeStubInterface, caller *Caller) error {
+	submitter := Submitter{"audit.Submitter", stub.GetTxID(), caller.MSPID, caller.ID, "", caller.ParticipantRef}
+	// Identities which are not X.509 based (e.g. Idemix) have no certificate
+	cert, err := cid.GetX509Certificate(stub)
+	if err == nil && cert != nil {
+		submitter.CommonName = cert.Subject.CommonName
+	}
+
+	submitterKey, err := stub.CreateCompositeKey(submitterIndex, []string{stub.GetTxID()})
+	if err != nil {
+		return err
+	}
+	submitterJSONasBytes, err := json.Marshal(submitter)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(submitterKey, submitterJSONasBytes)
+}
+
+// getSubmitter - Get the identity which submitted a transaction, nil for transactions recorded before submitters were
+func getSubmitter(stub shim.ChaincodeStubInterface, txID string) (*Submitter, error) {
+	submitterKey, err := stub.CreateCompositeKey(submitterIndex, []string{txID})
+	if err != nil {
+		return nil, err
+	}
+	submitterAsBytes, err := stub.GetState(submitterKey)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get submitter of %s: %s", txID, err.Error())
+	} else if submitterAsBytes == nil {
+		return nil, nil
+	}
+
+	var submitter Submitter
+	if err = json.Unmarshal(submitterAsBytes, &submitter); err != nil {
+		return nil, err
+	}
+	return &submitter, nil
+}
+
+// getAssetHistory - Get all versions of an asset, for claims and accident reports with the changes of each version
+func (t *InsuranceChaincode) getAssetHistory(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// simple data model arguments
+	// 0=class                  1=id
+	// accident.AccidentReport  1535132360-5f3e2a1b
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting 2")
+	}
+
+	// === Input sanitation
+	fmt.Println("- start get asset history")
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+	assetClass := args[0]
+	assetID := args[1]
+	if !assetClasses[assetClass] {
+		return shim.Error("1st argument must be a known asset class, got " + assetClass)
+	}
+
+	// === Read all versions of the asset
+	resultsIterator, err := stub.GetHistoryForKey(fmt.Sprintf("%s#%s", assetClass, assetID))
+	if err != nil {
+		return shim.Error("Failed to get asset history: " + err.Error())
+	}
+	defer resultsIterator.Close()
+
+	versions := []AssetVersion{}
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		timestamp, err := ptypes.Timestamp(modification.Timestamp)
+		if err != nil {
+			return shim.Error("Invalid timestamp of transaction " + modification.TxId + ": " + err.Error())
+		}
+		submitter, err := getSubmitter(stub, modification.TxId)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		version := AssetVersion{modification.TxId, timestamp, modification.IsDelete, submitter, nil, nil}
+		if !modification.IsDelete {
+			version.Value = json.RawMessage(modification.Value)
+		}
+
+		// === Registrants held personal data in the public state before the private collection, it isn't served anymore
+		if assetClass == "base.Registrant" && version.Value != nil {
+			redactedAsBytes, err := redactRegistrantVersion(version.Value)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+			version.Value = json.RawMessage(redactedAsBytes)
+		}
+		versions = append(versions, version)
+	}
+
+	// === Order the versions oldest first, the order of the history database differs between Fabric versions
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].Timestamp.Before(versions[j].Timestamp)
+	})
+
+	// === Compare consecutive versions
+	if diffClasses[assetClass] {
+		for i := 1; i < len(versions); i++ {
+			if versions[i-1].Value == nil || versions[i].Value == nil {
+				continue
+			}
+			changes, err := diffJSON(versions[i-1].Value, versions[i].Value)
+			if err != nil {
+				return shim.Error("Failed to compare versions of " + assetID + ": " + err.Error())
+			}
+			versions[i].Changes = changes
+		}
+	}
+
+	versionsJSONasBytes, err := json.Marshal(versions)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- end get asset history")
+	return shim.Success(versionsJSONasBytes)
+}
+
+// diffJSON - Get the changed fields between two JSON documents
+func diffJSON(fromAsBytes []byte, toAsBytes []byte) ([]FieldChange, error) {
+	from, err := decodeJSON(fromAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	to, err := decodeJSON(toAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := []FieldChange{}
+	diffValues("", from, to, &changes)
+	return changes, nil
+}
+
+// decodeJSON - Decode a JSON document keeping numbers as they were written
+func decodeJSON(valueAsBytes []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(valueAsBytes))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+// diffValues - Collect the changes between two decoded JSON values, objects and arrays are compared per field and element
+func diffValues(path string, from interface{}, to interface{}, changes *[]FieldChange) {
+	switch fromValue := from.(type) {
+	case map[string]interface{}:
+		if toValue, ok := to.(map[string]interface{}); ok {
+			// Sorted field names keep the result identical on all endorsing peers
+			fields := make([]string, 0, len(fromValue)+len(toValue))
+			for field := range fromValue {
+				fields = append(fields, field)
+			}
+			for field := range toValue {
+				if _, found := fromValue[field]; !found {
+					fields = append(fields, field)
+				}
+			}
+			sort.Strings(fields)
+
+			for _, field := range fields {
+				fieldPath := field
+				if path != "" {
+					fieldPath = path + "." + field
+				}
+				diffValues(fieldPath, fromValue[field], toValue[field], changes)
+			}
+			return
+		}
+	case []interface{}:
+		if toValue, ok := to.([]interface{}); ok {
+			length := len(fromValue)
+			if len(toValue) > length {
+				length = len(toValue)
+			}
+
+			for i := 0; i < length; i++ {
+				var fromElement, toElement interface{}
+				if i < len(fromValue) {
+					fromElement = fromValue[i]
+				}
+				if i < len(toValue) {
+					toElement = toValue[i]
+				}
+				diffValues(path+"["+strconv.Itoa(i)+"]", fromElement, toElement, changes)
+			}
+			return
+		}
+	}
+
+	// === Scalars, nulls and values which changed their type
+	fromAsBytes, _ := json.Marshal(from)
+	toAsBytes, _ := json.Marshal(to)
+	if !bytes.Equal(fromAsBytes, toAsBytes) {
+		*changes = append(*changes, FieldChange{path, from, to})
+	}
+}
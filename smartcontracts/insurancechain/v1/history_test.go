@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffJSON(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		want    string
+		wantErr bool
+	}{
+		{"identical", `{"a":1,"b":"x"}`, `{"b":"x","a":1}`, `[]`, false},
+		{"changed field", `{"status":"NEW"}`, `{"status":"RESOLVED"}`, `[{"path":"status","from":"NEW","to":"RESOLVED"}]`, false},
+		{"added and removed fields in order", `{"b":1,"a":2}`, `{"c":3,"a":2}`, `[{"path":"b","from":1,"to":null},{"path":"c","from":null,"to":3}]`, false},
+		{"nested object", `{"payout":{"amount":"1.00","currency":"USD"}}`, `{"payout":{"amount":"2.00","currency":"USD"}}`, `[{"path":"payout.amount","from":"1.00","to":"2.00"}]`, false},
+		{"array elements", `{"log":["a"]}`, `{"log":["a","b"]}`, `[{"path":"log[1]","from":null,"to":"b"}]`, false},
+		{"array of objects", `{"p":[{"id":1,"r":"DRIVER"}]}`, `{"p":[{"id":1,"r":"PASSENGER"}]}`, `[{"path":"p[0].r","from":"DRIVER","to":"PASSENGER"}]`, false},
+		{"numbers as written", `{"tax":11.0}`, `{"tax":11}`, `[{"path":"tax","from":11.0,"to":11}]`, false},
+		{"changed type", `{"a":{"b":1}}`, `{"a":[1]}`, `[{"path":"a","from":{"b":1},"to":[1]}]`, false},
+		{"invalid JSON", `{"a":`, `{}`, ``, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			changes, err := diffJSON([]byte(test.from), []byte(test.to))
+			if (err != nil) != test.wantErr {
+				t.Fatalf("diffJSON error = %v, want error %t", err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			changesJSONasBytes, err := json.Marshal(changes)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(changesJSONasBytes) != test.want {
+				t.Errorf("diffJSON = %s, want %s", changesJSONasBytes, test.want)
+			}
+		})
+	}
+}
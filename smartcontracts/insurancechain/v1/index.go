@@ -0,0 +1,335 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Index Definitions - Composite key indexes on relationships between assets
+// ============================================================================================================================
+
+// An index <asset>~<related> has composite keys with the attributes [related ID, asset ID], so all assets related to
+// one ID can be found with a partial composite key query. This works on both LevelDB and CouchDB.
+const (
+	policyVehicleIndex     = "policy~vehicle"
+	claimClaimantIndex     = "claim~claimant"
+	claimDefendantIndex    = "claim~defendant"
+	quoteRequestIndex      = "quote~request"
+	requestAccidentIndex   = "request~accident"
+	reportVehicleIndex     = "report~vehicle"
+	claimPairIndex         = "claim~pair"  // related ID is repair shop|registrant of the fraud assessment
+	ersGeohashIndex        = "ers~geohash" // related ID is the geohash cell of the location, one entry per precision
+	shopMakeIndex          = "shop~make"   // related ID is a supported MAKE, or * for shops repairing all makes
+	statementAccidentIndex = "statement~accident"
+	reportPersonIndex      = "report~person" // related ID is the identification number of an involved registrant
+
+	// Not asset indexes, the keys of award~model are [MAKE|MODEL, award recency, requestId] with the awarded total as
+	// value, the keys of award~request are [requestId] with the award~model key of the request as value
+	awardModelIndex   = "award~model"
+	awardRequestIndex = "award~request"
+)
+
+// indexClasses - class of the indexed assets per index
+var indexClasses = map[string]string{
+	policyVehicleIndex:     "insurance.InsurancePolicy",
+	claimClaimantIndex:     "insurance.InsuranceClaim",
+	claimDefendantIndex:    "insurance.InsuranceClaim",
+	quoteRequestIndex:      "vehiclerepair.RepairQuote",
+	requestAccidentIndex:   "vehiclerepair.QuoteRequest",
+	reportVehicleIndex:     "accident.AccidentReport",
+	claimPairIndex:         "insurance.InsuranceClaim",
+	ersGeohashIndex:        "base.EmergencyServices",
+	shopMakeIndex:          "base.RepairShop",
+	statementAccidentIndex: "accident.WitnessStatement",
+	reportPersonIndex:      "accident.AccidentReport",
+}
+
+// indexEntry - composite key of an asset in an index
+type indexEntry struct {
+	indexName string
+	relatedID string
+	assetID   string
+}
+
+// assetIDFromRef - Get the ID part of a class name + # + ID reference
+func assetIDFromRef(assetRef string) string {
+	parts := strings.SplitN(assetRef, "#", 2)
+	if len(parts) != 2 {
+		return assetRef
+	}
+	return parts[1]
+}
+
+// assetIndexEntries - Get the index entries of an asset from its JSON
+func assetIndexEntries(assetClass string, assetID string, assetAsBytes []byte) ([]indexEntry, error) {
+	var entries []indexEntry
+	var err error
+
+	switch assetClass {
+	case "insurance.InsurancePolicy":
+		var insurancePolicy InsurancePolicy
+		if err = json.Unmarshal(assetAsBytes, &insurancePolicy); err == nil {
+			entries = append(entries, indexEntry{policyVehicleIndex, assetIDFromRef(insurancePolicy.RegisteredVehicle), assetID})
+		}
+	case "insurance.InsuranceClaim":
+		var insuranceClaim InsuranceClaim
+		if err = json.Unmarshal(assetAsBytes, &insuranceClaim); err == nil {
+			entries = append(entries, indexEntry{claimClaimantIndex, assetIDFromRef(insuranceClaim.Claimant), assetID})
+			entries = append(entries, indexEntry{claimDefendantIndex, assetIDFromRef(insuranceClaim.Defendant), assetID})
+			if insuranceClaim.Fraud != nil {
+				entries = append(entries, indexEntry{claimPairIndex, shopRegistrantKey(insuranceClaim.Fraud.RepairShop, insuranceClaim.Fraud.Registrant), assetID})
+			}
+		}
+	case "vehiclerepair.RepairQuote":
+		var repairQuote RepairQuote
+		if err = json.Unmarshal(assetAsBytes, &repairQuote); err == nil {
+			entries = append(entries, indexEntry{quoteRequestIndex, assetIDFromRef(repairQuote.QuoteRequest), assetID})
+		}
+	case "vehiclerepair.QuoteRequest":
+		var quoteRequest QuoteRequest
+		if err = json.Unmarshal(assetAsBytes, &quoteRequest); err == nil {
+			entries = append(entries, indexEntry{requestAccidentIndex, assetIDFromRef(quoteRequest.AccidentReport), assetID})
+		}
+	case "accident.WitnessStatement":
+		var witnessStatement WitnessStatement
+		if err = json.Unmarshal(assetAsBytes, &witnessStatement); err == nil {
+			entries = append(entries, indexEntry{statementAccidentIndex, assetIDFromRef(witnessStatement.AccidentReport), assetID})
+		}
+	case "base.EmergencyServices":
+		var ers EmergencyServices
+		if err = json.Unmarshal(assetAsBytes, &ers); err == nil {
+			for _, cell := range ersGeohashKeys(ers.Location) {
+				entries = append(entries, indexEntry{ersGeohashIndex, cell, assetID})
+			}
+		}
+	case "base.RepairShop":
+		var shop RepairShop
+		if err = json.Unmarshal(assetAsBytes, &shop); err == nil {
+			for _, makeKey := range repairShopMakeKeys(&shop) {
+				entries = append(entries, indexEntry{shopMakeIndex, makeKey, assetID})
+			}
+		}
+	case "accident.AccidentReport":
+		var accidentReport AccidentReport
+		if err = json.Unmarshal(assetAsBytes, &accidentReport); err == nil {
+			for _, vehicleRef := range accidentReport.InvolvedGoods.Vehicles {
+				entries = append(entries, indexEntry{reportVehicleIndex, assetIDFromRef(vehicleRef), assetID})
+			}
+			for _, person := range accidentReport.InvolvedPersons {
+				entries = append(entries, indexEntry{reportPersonIndex, assetIDFromRef(person.Registrant), assetID})
+			}
+		}
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal %s for indexing: %s", assetClass, err.Error())
+	}
+	return entries, nil
+}
+
+// putAssetIndexes - Store the index entries of an asset, call after every write of an indexed asset
+func putAssetIndexes(stub shim.ChaincodeStubInterface, assetClass string, assetID string, assetAsBytes []byte) error {
+	entries, err := assetIndexEntries(assetClass, assetID, assetAsBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.relatedID == "" {
+			continue
+		}
+		indexKey, err := stub.CreateCompositeKey(entry.indexName, []string{entry.relatedID, entry.assetID})
+		if err != nil {
+			return err
+		}
+		// Only the key is needed, the value can't be empty as that would delete the entry
+		if err = stub.PutState(indexKey, []byte{0x00}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteAssetIndexes - Remove the index entries of the previous version of an asset before its relations change
+func deleteAssetIndexes(stub shim.ChaincodeStubInterface, assetClass string, assetID string, assetAsBytes []byte) error {
+	entries, err := assetIndexEntries(assetClass, assetID, assetAsBytes)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		indexKey, err := stub.CreateCompositeKey(entry.indexName, []string{entry.relatedID, entry.assetID})
+		if err != nil {
+			return err
+		}
+		if err = stub.DelState(indexKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getIndexedAssetIDs - Get the IDs of all assets related to an ID in an index
+func getIndexedAssetIDs(stub shim.ChaincodeStubInterface, indexName string, relatedID string) ([]string, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(indexName, []string{relatedID})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query index %s: %s", indexName, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var assetIDs []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, attributes, err := stub.SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		assetIDs = append(assetIDs, attributes[1])
+	}
+	return assetIDs, nil
+}
+
+// getIndexedAssets - Get all assets related to an ID in one or more indexes on the same class
+func getIndexedAssets(stub shim.ChaincodeStubInterface, relatedID string, indexNames ...string) ([]QueryRecord, error) {
+	records := []QueryRecord{}
+	seen := make(map[string]bool)
+
+	for _, indexName := range indexNames {
+		assetIDs, err := getIndexedAssetIDs(stub, indexName, relatedID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, assetID := range assetIDs {
+			assetRef := fmt.Sprintf("%s#%s", indexClasses[indexName], assetID)
+			if seen[assetRef] {
+				continue
+			}
+			seen[assetRef] = true
+
+			assetAsBytes, err := stub.GetState(assetRef)
+			if err != nil {
+				return nil, fmt.Errorf("Failed to get asset %s: %s", assetRef, err.Error())
+			} else if assetAsBytes == nil {
+				continue // stale entry of a deleted asset
+			}
+			records = append(records, QueryRecord{assetRef, json.RawMessage(assetAsBytes)})
+		}
+	}
+
+	return records, nil
+}
+
+// queryIndex - Run an index query for the single ID argument and return the related assets
+func (t *InsuranceChaincode) queryIndex(stub shim.ChaincodeStubInterface, args []string, indexNames ...string) pb.Response {
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	records, err := getIndexedAssets(stub, args[0], indexNames...)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	recordsAsBytes, err := json.Marshal(records)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	return shim.Success(recordsAsBytes)
+}
+
+// getPoliciesForVehicle - Get all insurance policies of a vehicle
+func (t *InsuranceChaincode) getPoliciesForVehicle(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// 0=registrationNumber
+	return t.queryIndex(stub, args, policyVehicleIndex)
+}
+
+// getClaimsForPolicy - Get all insurance claims of a policy, either as claimant or defendant
+func (t *InsuranceChaincode) getClaimsForPolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// 0=policyId
+	return t.queryIndex(stub, args, claimClaimantIndex, claimDefendantIndex)
+}
+
+// getQuotesForRequest - Get all repair quotes offered for a quote request
+func (t *InsuranceChaincode) getQuotesForRequest(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// 0=requestId
+	return t.queryIndex(stub, args, quoteRequestIndex)
+}
+
+// getRequestsForAccident - Get all quote requests for an accident report
+func (t *InsuranceChaincode) getRequestsForAccident(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// 0=accidentId
+	return t.queryIndex(stub, args, requestAccidentIndex)
+}
+
+// getReportsForVehicle - Get all accident reports a vehicle is involved in
+func (t *InsuranceChaincode) getReportsForVehicle(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// 0=registrationNumber
+	return t.queryIndex(stub, args, reportVehicleIndex)
+}
+
+// getStatementsForAccident - Get all witness statements of an accident report
+func (t *InsuranceChaincode) getStatementsForAccident(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// 0=accidentId
+	return t.queryIndex(stub, args, statementAccidentIndex)
+}
+
+// reindexAssets - Create the index entries of all existing indexed assets, e.g. after upgrading the chaincode
+func (t *InsuranceChaincode) reindexAssets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	indexedClasses := []string{"insurance.InsurancePolicy", "insurance.InsuranceClaim", "vehiclerepair.RepairQuote", "vehiclerepair.QuoteRequest", "accident.AccidentReport", "base.EmergencyServices", "base.RepairShop", "accident.WitnessStatement"}
+
+	reindexedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var assetList []AssetEntry
+	for _, assetClass := range indexedClasses {
+		resultsIterator, err := stub.GetStateByRange(assetClass+"#", assetClass+"$")
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return shim.Error(err.Error())
+			}
+
+			assetID := assetIDFromRef(queryResponse.Key)
+			if err = putAssetIndexes(stub, assetClass, assetID, queryResponse.Value); err != nil {
+				resultsIterator.Close()
+				return shim.Error(err.Error())
+			}
+			if assetClass == "vehiclerepair.QuoteRequest" {
+				if err = reindexAwardSample(stub, queryResponse.Value, reindexedAt); err != nil {
+					resultsIterator.Close()
+					return shim.Error(err.Error())
+				}
+			}
+			assetList = append(assetList, AssetEntry{assetClass, assetID})
+		}
+		resultsIterator.Close()
+	}
+
+	assetsJSONasBytes, err := json.Marshal(assetList)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- Indexes of existing assets successfully created")
+	return shim.Success(assetsJSONasBytes)
+}
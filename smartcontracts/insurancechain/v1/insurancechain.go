@@ -43,13 +43,71 @@ type GoodsConcept struct {
 
 // EstimateConcept - estimate type
 type EstimateConcept struct {
-	Class          string  `json:"$class"` // vehiclerepair.Estimate
-	Type           string  `json:"type"`   // This can be either REPAIR or REPLACE
-	Description    string  `json:"description"`
-	CostOfParts    float32 `json:"costOfParts,omitempty"`
-	CostOfLabor    float32 `json:"costOfLabor,omitempty"`
-	CostOfRefinish float32 `json:"costOfRefinish,omitempty"`
-	TotalCost      float32 `json:"totalCost"`
+	Class          string `json:"$class"` // vehiclerepair.Estimate
+	Type           string `json:"type"`   // This can be either REPAIR or REPLACE
+	Description    string `json:"description"`
+	CostOfParts    Money  `json:"costOfParts"`
+	CostOfLabor    Money  `json:"costOfLabor"`
+	CostOfRefinish Money  `json:"costOfRefinish"`
+	TotalCost      Money  `json:"totalCost"` // CostOfParts + CostOfLabor + CostOfRefinish
+}
+
+// OwnershipConcept - ownership type
+type OwnershipConcept struct {
+	Class          string    `json:"$class"` // base.Ownership
+	Owner          string    `json:"owner"`  // Registrant class name + # + registrationId
+	DateAscription time.Time `json:"dateAscription"`
+	DateTransfer   time.Time `json:"dateTransfer"`
+}
+
+// CoverageConcept - coverage type, a zero limit means the coverage is unlimited
+type CoverageConcept struct {
+	Class          string `json:"$class"` // insurance.Coverage
+	Type           string `json:"type"`   // This can be THIRD_PARTY_LIABILITY, COLLISION, COMPREHENSIVE or GLASS
+	Deductible     Money  `json:"deductible"`
+	PerEventLimit  Money  `json:"perEventLimit"`
+	AggregateLimit Money  `json:"aggregateLimit"`
+	PaidTotal      Money  `json:"paidTotal"` // sum of the payouts of accepted claims
+}
+
+// PayoutConcept - payout type
+type PayoutConcept struct {
+	Class          string     `json:"$class"` // insurance.Payout
+	CoverageType   string     `json:"coverageType"`
+	ClaimedAmount  Money      `json:"claimedAmount"`
+	Deductible     Money      `json:"deductible"`             // deductible applied, at most the claimed amount
+	LimitApplied   string     `json:"limitApplied,omitempty"` // PER_EVENT or AGGREGATE when the payout was capped
+	PayoutAmount   Money      `json:"payoutAmount"`
+	DefendantFault Percentage `json:"defendantFault"` // agreed fault of the defendant in percent
+	LiableAmount   Money      `json:"liableAmount"`   // ClaimedAmount × DefendantFault, before deductible and limits
+}
+
+// LiabilityConcept - liability type, the fault split of a claim signed by the insurers of both sides
+type LiabilityConcept struct {
+	Class            string     `json:"$class"`                 // insurance.Liability
+	Status           string     `json:"status"`                 // This can be PENDING, PROPOSED, AGREED or DISPUTED
+	ScenarioCode     string     `json:"scenarioCode,omitempty"` // standard collision scenario
+	DefendantFault   Percentage `json:"defendantFault"`         // fault of the defendant in percent
+	Round            int        `json:"round"`                  // number of proposals made
+	ProposedBy       string     `json:"proposedBy,omitempty"`   // Insurer class name + # + tradeName
+	ProposedAt       *time.Time `json:"proposedAt,omitempty"`
+	SignedBy         []string   `json:"signedBy,omitempty"` // CLAIMANT and/or DEFENDANT
+	AgreedAt         *time.Time `json:"agreedAt,omitempty"`
+	SettlementAmount *Money     `json:"settlementAmount,omitempty"` // repair quote total × defendant fault
+	DisputeReason    string     `json:"disputeReason,omitempty"`
+}
+
+// EndorsementConcept - endorsement type, keeps the values it replaced so earlier versions of the policy can be restored
+type EndorsementConcept struct {
+	Class            string            `json:"$class"` // insurance.Endorsement
+	Version          int               `json:"version"`
+	EffectiveDate    time.Time         `json:"effectiveDate"`
+	EndorsedAt       time.Time         `json:"endorsedAt"`
+	EndorsedBy       string            `json:"endorsedBy"` // Insurer class name + # + tradeName
+	Changes          []string          `json:"changes"`    // COVERAGE, VEHICLE and/or HOLDER
+	PreviousCoverage []CoverageConcept `json:"previousCoverage,omitempty"`
+	PreviousVehicle  string            `json:"previousVehicle,omitempty"` // Vehicle class name + # + registrationNumber
+	PreviousHolder   string            `json:"previousHolder,omitempty"`  // Registrant class name + # + identificationNumber
 }
 
 // ============================================================================================================================
@@ -68,12 +126,14 @@ type CompanyAbstract struct {
 
 // Registrant - participanting policy holder, vehicle owner
 type Registrant struct {
-	Class                string         `json:"$class"` // base.Registrant
-	IdentificationNumber string         `json:"identificationNumber"`
-	LegalEntity          string         `json:"legalEntity"` // This can be INDIVIDUAL, CORPORATION or LEASER
-	Name                 string         `json:"name"`
-	Initials             string         `json:"initials,omitempty"`
-	Address              AddressConcept `json:"address"`
+	Class                string          `json:"$class"`                     // base.Registrant
+	IdentificationNumber string          `json:"identificationNumber"`       // pseudonymous ID, must not be derived from personal data
+	LegalEntity          string          `json:"legalEntity"`                // This can be INDIVIDUAL, CORPORATION or LEASER
+	Name                 string          `json:"name,omitempty"`             // personal data, only read from collectionRegistrant
+	Initials             string          `json:"initials,omitempty"`         // personal data, only read from collectionRegistrant
+	Address              *AddressConcept `json:"address,omitempty"`          // personal data, only read from collectionRegistrant
+	PersonalDataHash     string          `json:"personalDataHash,omitempty"` // hex SHA-256 of the salted personal data record
+	ErasedAt             *time.Time      `json:"erasedAt,omitempty"`         // set when the personal data is erased, the ID stays as tombstone
 }
 
 // Insurer - participating insurer
@@ -94,8 +154,11 @@ type EmergencyServices struct {
 type RepairShop struct {
 	Class string `json:"$class"` // base.RepairShop
 	CompanyAbstract
-	Phone string `json:"phone,omitempty"`
-	Email string `json:"email,omitempty"`
+	Phone           string           `json:"phone,omitempty"`
+	Email           string           `json:"email,omitempty"`
+	Location        *LocationConcept `json:"location,omitempty"`        // shops without location don't get quote requests
+	ServiceRadiusKm float64          `json:"serviceRadiusKm,omitempty"` // distance to accidents the shop quotes for
+	Makes           []string         `json:"makes,omitempty"`           // supported vehicle makes in upper case, all makes if empty
 }
 
 // ============================================================================================================================
@@ -104,38 +167,48 @@ type RepairShop struct {
 
 // Vehicle = asset type of vehicle
 type Vehicle struct {
-	Class              string    `json:"$class"` // base.Vehicle
-	RegistrationNumber string    `json:"registrationNumber"`
-	LicencePlate       string    `json:"licencePlate"`
-	DateFirstAdmission time.Time `json:"dateFirstAdmission"`
-	DateAscription     time.Time `json:"dateAscription"`
-	Owner              string    `json:"owner"` // Registrant class name + # + registrationId
-	Make               string    `json:"make"`
-	Model              string    `json:"model"`
-	Color              string    `json:"color,omitempty"`
-	MaxMass            int       `json:"maxMass,omitempty"`
-	MaxSeating         int       `json:"maxSeating"`
+	Class              string             `json:"$class"` // base.Vehicle
+	RegistrationNumber string             `json:"registrationNumber"`
+	LicencePlate       string             `json:"licencePlate"`
+	DateFirstAdmission time.Time          `json:"dateFirstAdmission"`
+	DateAscription     time.Time          `json:"dateAscription"`
+	Owner              string             `json:"owner"` // Registrant class name + # + registrationId
+	Make               string             `json:"make"`
+	Model              string             `json:"model"`
+	Color              string             `json:"color,omitempty"`
+	MaxMass            int                `json:"maxMass,omitempty"`
+	MaxSeating         int                `json:"maxSeating"`
+	OwnershipHistory   []OwnershipConcept `json:"ownershipHistory,omitempty"` // previous owners, oldest first
 }
 
 // AccidentReport - asset type of accident report
 type AccidentReport struct {
-	Class         string          `json:"$class"` // accident.AccidentReport
-	AccidentID    string          `json:"accidentId"`
-	OccuredAt     time.Time       `json:"occuredAt"`
-	Status        string          `json:"status"` // This can be NEW, RESPONDING or RESOLVED
-	Location      LocationConcept `json:"location"`
-	Description   string          `json:"accidentDescription,omitempty"`
-	InvolvedGoods GoodsConcept    `json:"involvedGoods,omitempty"`
-	RespondingERS string          `json:"respondingERS,omitempty"` // Emergency Services class name + # + tradeName
+	Class              string                     `json:"$class"` // accident.AccidentReport
+	AccidentID         string                     `json:"accidentId"`
+	OccuredAt          time.Time                  `json:"occuredAt"`
+	Status             string                     `json:"status"` // This can be NEW, RESPONDING or RESOLVED
+	Location           LocationConcept            `json:"location"`
+	Description        string                     `json:"accidentDescription,omitempty"`
+	InvolvedGoods      GoodsConcept               `json:"involvedGoods,omitempty"`
+	RespondingERS      string                     `json:"respondingERS,omitempty"`      // Emergency Services class name + # + tradeName
+	DispatchCandidates []DispatchCandidateConcept `json:"dispatchCandidates,omitempty"` // nearest emergency services when reported
+	InvolvedPersons    []PersonConcept            `json:"involvedPersons,omitempty"`
 }
 
 // QuoteRequest - asset type of quote request
 type QuoteRequest struct {
-	Class             string `json:"$class"` // vehiclerepair.QuoteRequest
-	RequestID         string `json:"requestId"`
-	AccidentReport    string `json:"accidentReport"`   // Accident report class name + # + accidentId
-	VehicleInsurance  string `json:"vehicleInsurance"` // Insurance policy class name + # + policyId
-	DamageDescription string `json:"damageDescription"`
+	Class             string     `json:"$class"` // vehiclerepair.QuoteRequest
+	RequestID         string     `json:"requestId"`
+	AccidentReport    string     `json:"accidentReport"`   // Accident report class name + # + accidentId
+	VehicleInsurance  string     `json:"vehicleInsurance"` // Insurance policy class name + # + policyId
+	DamageDescription string     `json:"damageDescription"`
+	AwardedQuote      string     `json:"awardedQuote,omitempty"`    // Repair quote class name + # + quoteId
+	BiddingMode       string     `json:"biddingMode,omitempty"`     // This can be OPEN or SEALED, requests without one are OPEN
+	BiddingClosesAt   *time.Time `json:"biddingClosesAt,omitempty"` // end of the commitment window of sealed bids
+	RevealClosesAt    *time.Time `json:"revealClosesAt,omitempty"`  // end of the reveal window of sealed bids
+	VehicleMake       string     `json:"vehicleMake,omitempty"`
+	VehicleModel      string     `json:"vehicleModel,omitempty"`
+	EligibleShops     []string   `json:"eligibleShops,omitempty"` // Repair shop class name + # + tradeName, nearest first, any shop may quote if empty
 }
 
 // RepairQuote - asset type of repair quote
@@ -145,41 +218,60 @@ type RepairQuote struct {
 	QuoteRequest  string            `json:"quoteRequest"` // Quote request class name + # + requestId
 	Estimator     string            `json:"estimator"`    // Repair shop class name + # + tradeName
 	Estimates     []EstimateConcept `json:"estimates"`
-	TotalParts    float32           `json:"totalParts"`
-	TotalLabor    float32           `json:"totalLabor"`
-	TotalRefinish float32           `json:"totalRefinish"`
-	Tax           float32           `json:"tax"`
-	Total         float32           `json:"total"`
+	TotalParts    Money             `json:"totalParts"`
+	TotalLabor    Money             `json:"totalLabor"`
+	TotalRefinish Money             `json:"totalRefinish"`
+	Tax           Percentage        `json:"tax"` // tax rate in percent
+	TaxAmount     Money             `json:"taxAmount"`
+	Total         Money             `json:"total"`
+	Status        string            `json:"status,omitempty"`      // This can be OFFERED, ACCEPTED or REJECTED
+	RepairOrder   string            `json:"repairOrder,omitempty"` // Repair order class name + # + orderId, set when the repair is scheduled
 }
 
 // InsurancePolicy - asset type of insurance policy
 type InsurancePolicy struct {
-	Class             string    `json:"$class"` // insurance.InsurancePolicy
-	PolicyID          string    `json:"policyId"`
-	AutorisedBy       string    `json:"autorisedBy"`
-	ValidFrom         time.Time `json:"validFrom"`
-	ValidTo           time.Time `json:"validTo"`
-	RegisteredVehicle string    `json:"registeredVehicle"` // Vehicle class name + # + registrationNumber
-	CountryCode       string    `json:"countryCode"`
-	InsurerCode       string    `json:"insurerCode"`
-	PolicyNumber      int64     `json:"policyNumber"`
-	VehicleCategory   string    `json:"vehicleCategory"`
-	VehicleMake       string    `json:"vehicleMake"`
-	Coverage          []string  `json:"coverage"`
-	PolicyHolder      string    `json:"policyHolder"` // Registrant class name + # + identificationNumber
-	IssuedBy          string    `json:"issuedBy"`     // Insurer class name + # + tradeName
+	Class             string               `json:"$class"` // insurance.InsurancePolicy
+	PolicyID          string               `json:"policyId"`
+	AutorisedBy       string               `json:"autorisedBy"`
+	ValidFrom         time.Time            `json:"validFrom"`
+	ValidTo           time.Time            `json:"validTo"`
+	RegisteredVehicle string               `json:"registeredVehicle"` // Vehicle class name + # + registrationNumber
+	CountryCode       string               `json:"countryCode"`
+	InsurerCode       string               `json:"insurerCode"`
+	PolicyNumber      int64                `json:"policyNumber"`
+	VehicleCategory   string               `json:"vehicleCategory"`
+	VehicleMake       string               `json:"vehicleMake"`
+	Coverage          []CoverageConcept    `json:"coverage"`
+	PolicyHolder      string               `json:"policyHolder"`             // Registrant class name + # + identificationNumber
+	IssuedBy          string               `json:"issuedBy"`                 // Insurer class name + # + tradeName
+	HolderNotOwner    bool                 `json:"holderNotOwner,omitempty"` // set when the vehicle was transferred away from the policy holder
+	Territory         []string             `json:"territory"`                // ISO 3166-1 alpha-2 codes of the covered countries
+	Status            string               `json:"status,omitempty"`         // This can be ACTIVE or CANCELLED
+	Term              int                  `json:"term,omitempty"`           // 1 for the issued policy, incremented per renewal
+	PreviousTerm      string               `json:"previousTerm,omitempty"`   // Insurance policy class name + # + policyId
+	RenewedBy         string               `json:"renewedBy,omitempty"`      // Insurance policy class name + # + policyId
+	CancelledAt       *time.Time           `json:"cancelledAt,omitempty"`    // effective date of the cancellation
+	CancelReason      string               `json:"cancelReason,omitempty"`
+	Endorsements      []EndorsementConcept `json:"endorsements,omitempty"` // oldest first
 }
 
 // InsuranceClaim - asset type of insurance claim
 type InsuranceClaim struct {
-	Class          string    `json:"$class"` // insurance.InsuranceClaim
-	ClaimID        string    `json:"claimId"`
-	DateOfClaim    time.Time `json:"dateOfClaim"`
-	Status         string    `json:"status"`         // This can be NEW, ACCEPTED, DECLINED or RESOLVED
-	AccidentReport string    `json:"accidentReport"` // Accident report class name + # + accidentId
-	Claimant       string    `json:"claimant"`       // Insurance policy class name + # + policyId
-	Defendant      string    `json:"defendant"`      // Insurance policy class name + # + policyId
-	CostOfRepair   string    `json:"costOfRepair"`   // Repair Quote class name + # + quoteId
+	Class          string                  `json:"$class"` // insurance.InsuranceClaim
+	ClaimID        string                  `json:"claimId"`
+	DateOfClaim    time.Time               `json:"dateOfClaim"`
+	Status         string                  `json:"status"`                  // This can be NEW, DISPUTED, ACCEPTED, DECLINED or RESOLVED
+	AccidentReport string                  `json:"accidentReport"`          // Accident report class name + # + accidentId
+	Claimant       string                  `json:"claimant"`                // Insurance policy class name + # + policyId
+	Defendant      string                  `json:"defendant"`               // Insurance policy class name + # + policyId
+	CostOfRepair   string                  `json:"costOfRepair"`            // Repair Quote class name + # + quoteId
+	DeclineReason  string                  `json:"declineReason,omitempty"` // This can be NOT_LIABLE, POLICY_NOT_VALID, NOT_COVERED, INSUFFICIENT_EVIDENCE, DUPLICATE_CLAIM or OTHER
+	DeclineRemarks string                  `json:"declineRemarks,omitempty"`
+	CoverageType   string                  `json:"coverageType,omitempty"` // coverage of the defendant's policy paying the claim
+	Payout         *PayoutConcept          `json:"payout,omitempty"`       // set when the claim is accepted
+	Liability      *LiabilityConcept       `json:"liability,omitempty"`    // claims sent before the liability assessment have none
+	RepairOrder    string                  `json:"repairOrder,omitempty"`  // Repair order class name + # + orderId, carrying out the repair quote
+	Fraud          *FraudAssessmentConcept `json:"fraud,omitempty"`        // scored when the claim is sent
 }
 
 // AssetEntry - entry of created asset, used in setup
@@ -194,39 +286,191 @@ type AssetEntry struct {
 
 // NewAccidentEvent - new accident event type
 type NewAccidentEvent struct {
-	AccidentID string `json:"accidentId"`
-	Location   string `json:"location"` //Longitude, Latitude
+	AccidentID string                     `json:"accidentId"`
+	Location   string                     `json:"location"`   //Longitude, Latitude
+	Candidates []DispatchCandidateConcept `json:"candidates"` // nearest emergency services first
 }
 
 // ReportUpdateEvent - updated accident event type
 type ReportUpdateEvent struct {
-	AccidentID string `json:"accidentId"`
-	Reason     string `json:"reason"`
+	AccidentID  string   `json:"accidentId"`
+	Reason      string   `json:"reason"`
+	Status      string   `json:"status"`
+	ReasonCodes []string `json:"reasonCodes"` // ERS_ASSIGNED, DESCRIPTION_UPDATED, VEHICLE_ADDED, PERSON_ADDED or REPORT_RESOLVED
 }
 
 // RequestForQuoteEvent - new quote request event type
 type RequestForQuoteEvent struct {
-	RequestID         string `json:"requestId"`
-	VehicleMake       string `json:"vehicleMake"`
-	VehicleModel      string `json:"vehicleModel"`
-	DamageDescription string `json:"damageDescription"`
+	RequestID         string     `json:"requestId"`
+	VehicleMake       string     `json:"vehicleMake"`
+	VehicleModel      string     `json:"vehicleModel"`
+	DamageDescription string     `json:"damageDescription"`
+	BiddingMode       string     `json:"biddingMode"`
+	BiddingClosesAt   *time.Time `json:"biddingClosesAt,omitempty"`
+	RevealClosesAt    *time.Time `json:"revealClosesAt,omitempty"`
+	EligibleShops     []string   `json:"eligibleShops"` // repair shops which may quote, nearest first, null if any shop may quote
 }
 
 // NewQuoteOfferEvent - new repaire quote event type
 type NewQuoteOfferEvent struct {
-	RequestID     string  `json:"requestId"`
-	QuoteID       string  `json:"quoteId"`
-	TotalEstimate float32 `json:"totalEstimate"`
+	RequestID     string `json:"requestId"`
+	QuoteID       string `json:"quoteId"`
+	TotalEstimate Money  `json:"totalEstimate"`
+}
+
+// QuoteCommittedEvent - sealed repair quote commitment event type
+type QuoteCommittedEvent struct {
+	RequestID    string    `json:"requestId"`
+	CommitmentID string    `json:"commitmentId"`
+	Estimator    string    `json:"estimator"`
+	CommittedAt  time.Time `json:"committedAt"`
+}
+
+// QuoteUpdateEvent - accepted or rejected repair quote event type
+type QuoteUpdateEvent struct {
+	RequestID string `json:"requestId"`
+	QuoteID   string `json:"quoteId"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason,omitempty"`
 }
 
 // NewClaimEvent - new insurance claim event type
 type NewClaimEvent struct {
-	ClaimID      string  `json:"claimId"`
-	ClaimantID   string  `json:"claimantPolicyId"`
-	DefendantID  string  `json:"defendantPolicyId"`
-	CostOfRepair float32 `json:"costOfRepair"`
+	ClaimID      string `json:"claimId"`
+	ClaimantID   string `json:"claimantPolicyId"`
+	DefendantID  string `json:"defendantPolicyId"`
+	CostOfRepair Money  `json:"costOfRepair"`
+}
+
+// SuspiciousClaimEvent - new insurance claim flagged for review by fraud scoring event type, sent instead of NewClaimEvent
+type SuspiciousClaimEvent struct {
+	ClaimID      string   `json:"claimId"`
+	ClaimantID   string   `json:"claimantPolicyId"`
+	DefendantID  string   `json:"defendantPolicyId"`
+	CostOfRepair Money    `json:"costOfRepair"`
+	Score        int      `json:"score"`
+	Rules        []string `json:"rules"` // codes of the triggered fraud rules
+}
+
+// PolicyUpdateEvent - renewed, cancelled or endorsed insurance policy event type
+type PolicyUpdateEvent struct {
+	PolicyID string `json:"policyId"`
+	Status   string `json:"status"`
+	Reason   string `json:"reason"`
+	Version  int    `json:"version"` // number of endorsements
+}
+
+// LiabilityProposedEvent - proposed fault split of an insurance claim event type
+type LiabilityProposedEvent struct {
+	ClaimID        string     `json:"claimId"`
+	ScenarioCode   string     `json:"scenarioCode"`
+	DefendantFault Percentage `json:"defendantFault"`
+	ProposedBy     string     `json:"proposedBy"`
+	Round          int        `json:"round"`
+}
+
+// LiabilityAgreedEvent - agreed fault split of an insurance claim event type
+type LiabilityAgreedEvent struct {
+	ClaimID          string     `json:"claimId"`
+	ScenarioCode     string     `json:"scenarioCode"`
+	DefendantFault   Percentage `json:"defendantFault"`
+	SettlementAmount Money      `json:"settlementAmount"`
+}
+
+// NettingCompletedEvent - completed netting run event type
+type NettingCompletedEvent struct {
+	RunID       string    `json:"runId"`
+	PeriodEnd   time.Time `json:"periodEnd"`
+	EntryCount  int       `json:"entryCount"`
+	Obligations []string  `json:"obligations"` // Net obligation class name + # + obligationId
+}
+
+// SettlementConfirmedEvent - confirmed payment of a net obligation event type
+type SettlementConfirmedEvent struct {
+	ObligationID     string `json:"obligationId"`
+	Payer            string `json:"payer"`
+	Payee            string `json:"payee"`
+	Amount           Money  `json:"amount"`
+	PaymentReference string `json:"paymentReference"`
+}
+
+// RepairOrderUpdateEvent - updated repair order event type
+type RepairOrderUpdateEvent struct {
+	OrderID     string `json:"orderId"`
+	RepairQuote string `json:"repairQuote"`
+	Status      string `json:"status"`
+	Reason      string `json:"reason"`
+}
+
+// ClaimUpdateEvent - updated insurance claim event type
+type ClaimUpdateEvent struct {
+	ClaimID string `json:"claimId"`
+	Status  string `json:"status"`
+	Reason  string `json:"reason"`
+}
+
+// VehicleTransferredEvent - vehicle ownership transfer event type
+type VehicleTransferredEvent struct {
+	RegistrationNumber string   `json:"registrationNumber"`
+	PreviousOwner      string   `json:"previousOwner"`
+	NewOwner           string   `json:"newOwner"`
+	FlaggedPolicies    []string `json:"flaggedPolicies,omitempty"` // Insurance policy class name + # + policyId
 }
 
+// ParticipantRegisteredEvent - new participant event type
+type ParticipantRegisteredEvent struct {
+	Class         string `json:"$class"`
+	ParticipantID string `json:"participantId"`
+}
+
+// RepairShopUpdateEvent - updated service area of repair shop event type
+type RepairShopUpdateEvent struct {
+	TradeName       string          `json:"tradeName"`
+	Location        LocationConcept `json:"location"`
+	ServiceRadiusKm float64         `json:"serviceRadiusKm"`
+	Makes           []string        `json:"makes,omitempty"` // all makes if empty
+}
+
+// WitnessStatementAddedEvent - new witness statement event type
+type WitnessStatementAddedEvent struct {
+	StatementID  string    `json:"statementId"`
+	AccidentID   string    `json:"accidentId"`
+	RecordedBy   string    `json:"recordedBy"` // Emergency Services class name + # + tradeName
+	TakenAt      time.Time `json:"takenAt"`
+	DocumentHash string    `json:"documentHash,omitempty"`
+}
+
+// ErasureReceiptEvent - erased personal data of a registrant event type, the receipt for the data subject
+type ErasureReceiptEvent struct {
+	Registrant       string    `json:"registrant"` // Registrant class name + # + identificationNumber
+	ErasedAt         time.Time `json:"erasedAt"`
+	TxID             string    `json:"txId"`
+	ErasedFrom       []string  `json:"erasedFrom"`                 // private collections and/or public state the personal data was removed from
+	PersonalDataHash string    `json:"personalDataHash,omitempty"` // hash of the erased record as it was kept on the public ledger
+	Reason           string    `json:"reason,omitempty"`
+	RetainedIn       []string  `json:"retainedIn"` // privateDataStore and/or ledgerBlocks still holding copies which can't be erased
+}
+
+// ============================================================================================================================
+// Status Definitions - Allowed status transitions of assets
+// ============================================================================================================================
+
+// reportTransitions - allowed status transitions of an accident report
+var reportTransitions = map[string][]string{
+	"NEW":        {"RESPONDING"},
+	"RESPONDING": {"RESOLVED"},
+}
+
+// claimTransitions - allowed status transitions of an insurance claim
+var claimTransitions = map[string][]string{
+	"NEW":      {"ACCEPTED", "DECLINED", "DISPUTED"},
+	"DISPUTED": {"ACCEPTED", "DECLINED"},
+	"ACCEPTED": {"RESOLVED"},
+}
+
+// claimDeclineReasons - allowed reason codes for declining an insurance claim
+var claimDeclineReasons = []string{"NOT_LIABLE", "POLICY_NOT_VALID", "NOT_COVERED", "INSUFFICIENT_EVIDENCE", "DUPLICATE_CLAIM", "OTHER"}
+
 // ============================================================================================================================
 // Chaincode functions
 // ============================================================================================================================
@@ -249,38 +493,142 @@ func (t *InsuranceChaincode) Invoke(stub shim.ChaincodeStubInterface) pb.Respons
 	function, args := stub.GetFunctionAndParameters()
 	fmt.Println("invoke is running " + function)
 
+	// Check if the participant of the client identity may invoke the function
+	caller, err := authorize(stub, function)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// Record who submitted the transaction for the audit trail
+	if !readOnlyFunctions[function] {
+		if err = recordSubmitter(stub, caller); err != nil {
+			return shim.Error("Failed to record submitter: " + err.Error())
+		}
+	}
+
 	// Handle different functions
 	if function == "setupAssets" { // setup demo assets
-		return t.setupAssets(stub, args)
+		return t.setupAssets(stub, caller, args)
+	} else if function == "registerRegistrant" { // register new registrant
+		return t.registerRegistrant(stub, caller, args)
+	} else if function == "forgetRegistrant" { // erase personal data of registrant
+		return t.forgetRegistrant(stub, caller, args)
+	} else if function == "registerInsurer" { // register new insurer
+		return t.registerInsurer(stub, caller, args)
+	} else if function == "registerEmergencyServices" { // register new emergency services
+		return t.registerEmergencyServices(stub, caller, args)
+	} else if function == "registerRepairShop" { // register new repair shop
+		return t.registerRepairShop(stub, caller, args)
+	} else if function == "updateRepairShop" { // update service area of repair shop
+		return t.updateRepairShop(stub, caller, args)
+	} else if function == "registerVehicle" { // register new vehicle
+		return t.registerVehicle(stub, caller, args)
+	} else if function == "transferVehicle" { // transfer vehicle to new owner
+		return t.transferVehicle(stub, caller, args)
+	} else if function == "acceptClaim" { // accept insurance claim
+		return t.acceptClaim(stub, caller, args)
+	} else if function == "declineClaim" { // decline insurance claim
+		return t.declineClaim(stub, caller, args)
+	} else if function == "resolveClaim" { // resolve insurance claim
+		return t.resolveClaim(stub, caller, args)
+	} else if function == "renewPolicy" { // renew insurance policy
+		return t.renewPolicy(stub, caller, args)
+	} else if function == "cancelPolicy" { // cancel insurance policy
+		return t.cancelPolicy(stub, caller, args)
+	} else if function == "endorsePolicy" { // endorse insurance policy
+		return t.endorsePolicy(stub, caller, args)
+	} else if function == "proposeLiability" { // propose fault split of insurance claim
+		return t.proposeLiability(stub, caller, args)
+	} else if function == "agreeLiability" { // agree fault split of insurance claim
+		return t.agreeLiability(stub, caller, args)
+	} else if function == "disputeLiability" { // dispute fault split of insurance claim
+		return t.disputeLiability(stub, caller, args)
+	} else if function == "runNetting" { // net open settlements between insurers
+		return t.runNetting(stub, args)
+	} else if function == "confirmSettlement" { // confirm payment of net obligation
+		return t.confirmSettlement(stub, caller, args)
+	} else if function == "createRepairOrder" { // schedule repair of accepted quote
+		return t.createRepairOrder(stub, caller, args)
+	} else if function == "startRepair" { // start work of repair order
+		return t.startRepair(stub, caller, args)
+	} else if function == "reportActualCosts" { // report actual costs of repair order
+		return t.reportActualCosts(stub, caller, args)
+	} else if function == "fileSupplement" { // file additional work on repair order
+		return t.fileSupplement(stub, caller, args)
+	} else if function == "decideSupplement" { // approve or reject additional work on repair order
+		return t.decideSupplement(stub, caller, args)
+	} else if function == "completeRepair" { // complete work of repair order
+		return t.completeRepair(stub, caller, args)
+	} else if function == "invoiceRepair" { // invoice completed repair order
+		return t.invoiceRepair(stub, caller, args)
+	} else if function == "calculatePayout" { // calculate payout of insurance claim
+		return t.calculatePayout(stub, caller, args)
 	} else if function == "readAssetData" {
-		return t.readAssetData(stub, args)
+		return t.readAssetData(stub, caller, args)
+	} else if function == "queryAssets" { // query assets of a class
+		return t.queryAssets(stub, args)
+	} else if function == "getPoliciesForVehicle" { // query policies of vehicle
+		return t.getPoliciesForVehicle(stub, args)
+	} else if function == "getClaimsForPolicy" { // query claims of policy
+		return t.getClaimsForPolicy(stub, args)
+	} else if function == "getQuotesForRequest" { // query quotes of quote request
+		return t.getQuotesForRequest(stub, args)
+	} else if function == "getRequestsForAccident" { // query quote requests of accident
+		return t.getRequestsForAccident(stub, args)
+	} else if function == "getReportsForVehicle" { // query accident reports of vehicle
+		return t.getReportsForVehicle(stub, args)
+	} else if function == "getStatementsForAccident" { // query witness statements of accident
+		return t.getStatementsForAccident(stub, args)
+	} else if function == "getAssetHistory" { // get all versions of an asset
+		return t.getAssetHistory(stub, args)
+	} else if function == "reindexAssets" { // create indexes of existing assets
+		return t.reindexAssets(stub, args)
+	} else if function == "migrateRegistrantPersonalData" { // move personal data of existing registrants to the collection
+		return t.migrateRegistrantPersonalData(stub, args)
 	} else if function == "reportAccident" { // report new accident
 		return t.reportAccident(stub, args)
 	} else if function == "updateReport" { // update accident report
-		return t.updateReport(stub, args)
+		return t.updateReport(stub, caller, args)
+	} else if function == "claimReport" { // respond to new accident report
+		return t.claimReport(stub, caller, args)
+	} else if function == "addWitnessStatement" { // record statement of accident witness
+		return t.addWitnessStatement(stub, caller, args)
+	} else if function == "closeReport" { // close accident report
+		return t.closeReport(stub, caller, args)
 	} else if function == "requestQuote" { // request quote for repair
-		return t.requestQuote(stub, args)
+		return t.requestQuote(stub, caller, args)
 	} else if function == "offerQuote" { // offer repair quote
-		return t.offerQuote(stub, args)
+		return t.offerQuote(stub, caller, args)
+	} else if function == "commitQuote" { // commit a sealed repair quote
+		return t.commitQuote(stub, caller, args)
+	} else if function == "revealQuote" { // reveal a sealed repair quote
+		return t.revealQuote(stub, caller, args)
+	} else if function == "awardSealedQuote" { // award the best revealed sealed quote
+		return t.awardSealedQuote(stub, caller, args)
+	} else if function == "acceptQuote" { // award repair quote
+		return t.acceptQuote(stub, caller, args)
+	} else if function == "rejectQuote" { // reject repair quote
+		return t.rejectQuote(stub, caller, args)
 	} else if function == "issuePolicy" { // issue inusrance policy
-		return t.issuePolicy(stub, args)
+		return t.issuePolicy(stub, caller, args)
 	} else if function == "sendClaim" { // offer repair quote
-		return t.sendClaim(stub, args)
+		return t.sendClaim(stub, caller, args)
 	}
 
 	return shim.Error("Received unknown invoke function name - '" + function + "'")
 }
 
-// reportAccident - Create a new accident report, store into state
-func (t *InsuranceChaincode) reportAccident(stub shim.ChaincodeStubInterface, args []string) pb.Response {
-	var err error
-
-	// simple data model arguments
-	// 0=longitude  1=latitude  2=occuredAt               3=reporting vehicle
-	// 52.0920511   5.06641270  2018-08-03T10:20:20.325Z  JN6ND01S3GX194659
+// registerRegistrant - Register a new registrant, store into state
+func (t *InsuranceChaincode) registerRegistrant(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the personal data is passed in the transient map, it isn't recorded on the ledger
+	// 0=identificationNumber  1=legalEntity
+	// 170632064               INDIVIDUAL
+	//
+	// transient registrant={"name":"Smith","initials":"J.","addressLine1":"28 Clinton Ave",
+	//                       "addressLine2":"Jersey City, NJ 07304","addressLine3":"United States","salt":"9c1d7a52e4b0f836"}
 
-	if len(args) < 2 {
-		return shim.Error(fmt.Sprintf("Incorrect number of arguments. Expecting minimum of 2, got %d", len(args)))
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
 	}
 
 	// === Check input variables ===
@@ -291,89 +639,69 @@ func (t *InsuranceChaincode) reportAccident(stub shim.ChaincodeStubInterface, ar
 		return shim.Error("2nd argument must be a non-empty string")
 	}
 
-	longitude, err := strconv.ParseFloat(args[0], 64)
+	legalEntity := strings.ToUpper(args[1])
+	if legalEntity != "INDIVIDUAL" && legalEntity != "CORPORATION" && legalEntity != "LEASER" {
+		return shim.Error("2nd argument must be either INDIVIDUAL, CORPORATION or LEASER")
+	}
+
+	personalData, err := getRegistrantTransient(stub, args[0])
 	if err != nil {
-		return shim.Error("1st argument must be a floating point string")
+		return shim.Error(err.Error())
 	}
 
-	latitude, err := strconv.ParseFloat(args[1], 64)
+	// === Store personal data in the private collection, the public registrant keeps its hash
+	personalDataHash, err := putRegistrantPersonalData(stub, personalData)
 	if err != nil {
-		return shim.Error("2nd argument must be a floating point string")
+		return shim.Error(err.Error())
 	}
 
-	occuredAt := time.Now()
+	// === Create registrant object
+	registrant := &Registrant{"base.Registrant", args[0], legalEntity, "", "", nil, personalDataHash, nil}
 
-	// === Parse occuredAt dateTime format ===
-	if len(args[2]) > 0 {
-		occuredAt, err = time.Parse(time.RFC3339, args[2])
-		if err != nil {
-			return shim.Error("3rd argument must be a RFC3339 dateTime string")
-		}
-	}
+	return t.registerParticipant(stub, caller, registrant.Class, registrant.IdentificationNumber, registrant)
+}
 
-	// === Check if optional vehicle exists ===
-	var vehicleRef string
-	if len(args[3]) > 0 {
-		vehicleRef = fmt.Sprintf("%s#%s", "base.Vehicle", args[3])
-		vehicleAsBytes, err := stub.GetState(vehicleRef)
-		if err != nil {
-			return shim.Error("Failed to get vehicle: " + err.Error())
-		} else if vehicleAsBytes == nil {
-			return shim.Error("This vehicle doesn't exists: " + vehicleRef)
-		}
-	}
+// registerInsurer - Register a new insurer, store into state
+func (t *InsuranceChaincode) registerInsurer(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments
+	// 0=tradeName     1=addressLine1  2=addressLine2         3=addressLine3  4=signature
+	// AXA Insurance   888 Bergen Ave  Jersey City, NJ 07306  United States   iVBORw0KGgoAAAANSUhEUgAAAKUAAAAxBAMAAABJ8nS8...
 
-	// === Create report object
-	accidentObjClass := "accident.AccidentReport"
-	//accidentID, err := strconv.ParseInt("1534180781", 10, 64) //static id for testing
-	accidentID := time.Now().Unix()
-	location := LocationConcept{"accident.Location", longitude, latitude, ""}
-	accidentReport := &AccidentReport{Class: accidentObjClass, OccuredAt: occuredAt, Status: "NEW", Location: location}
-	if vehicleRef != "" {
-		var vehicles []string
-		vehicles[0] = vehicleRef
-		involvedGoods := GoodsConcept{"accident.Goods", vehicles}
-		accidentReport.InvolvedGoods = involvedGoods
+	if len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 5")
 	}
 
-	// === Marshal accident report
-	accidentJSONasBytes, err := json.Marshal(accidentReport)
-	if err != nil {
-		return shim.Error(err.Error())
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
 	}
-
-	// === Save accident to state ===
-	accidentRef := fmt.Sprintf("%s#%d", accidentObjClass, accidentID)
-	err = stub.PutState(accidentRef, accidentJSONasBytes)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
 	}
-
-	// === Emit NewAccident event ===
-	locationStr := fmt.Sprintf("%f, %f", longitude, latitude)
-	newAccident := &NewAccidentEvent{strconv.FormatInt(accidentID, 10), locationStr}
-	eventJSONasBytes, err := json.Marshal(newAccident)
-	if err != nil {
-		return shim.Error(err.Error())
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+	if len(args[4]) <= 0 {
+		return shim.Error("5th argument must be a non-empty string")
 	}
-	stub.SetEvent("NewAccidentEvent", eventJSONasBytes)
 
-	fmt.Println("- Accident report successfully created")
-	return shim.Success(eventJSONasBytes)
+	// === Create insurer object
+	address := AddressConcept{"base.Address", args[1], args[2], args[3]}
+	insurer := &Insurer{"base.Insurer", CompanyAbstract{args[0], address}, args[4]}
 
+	return t.registerParticipant(stub, caller, insurer.Class, insurer.TradeName, insurer)
 }
 
-// updateReport - Update the report
-func (t *InsuranceChaincode) updateReport(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+// registerEmergencyServices - Register new emergency services, store into state
+func (t *InsuranceChaincode) registerEmergencyServices(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	var err error
-	var reason string
 
 	// simple data model arguments
-	// 0=accidentId  1=respondingERS     2=description           3=other vehicle
-	// 1534180781    NYPD 34th Precinct  Nose to tail collision  1HTZR0007JH586991
+	// 0=tradeName          1=addressLine1  2=addressLine2      3=addressLine3  4=longitude  5=latitude   6=description
+	// NYPD 34th Precinct   4295 Broadway   New York, NY 10033  United States   -73.935389   40.851498    Police Station
 
-	if len(args) < 2 {
-		return shim.Error("Incorrect number of arguments. Expecting minimum of 2")
+	if len(args) != 7 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 7")
 	}
 
 	// === Check input variables ===
@@ -383,101 +711,134 @@ func (t *InsuranceChaincode) updateReport(stub shim.ChaincodeStubInterface, args
 	if len(args[1]) <= 0 {
 		return shim.Error("2nd argument must be a non-empty string")
 	}
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+	if len(args[4]) <= 0 {
+		return shim.Error("5th argument must be a non-empty string")
+	}
+	if len(args[5]) <= 0 {
+		return shim.Error("6th argument must be a non-empty string")
+	}
 
-	accidentID := args[0]
-	respondingERS := args[1]
-	description := args[2]
-	otherVehicle := args[3]
-
-	// === Check if AccidentReport asset exists
-	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
-	reportAsBytes, err := stub.GetState(accidentRef)
+	longitude, err := strconv.ParseFloat(args[4], 64)
 	if err != nil {
-		return shim.Error("Failed to get accident report: " + err.Error())
-	} else if reportAsBytes == nil {
-		return shim.Error("This accident report doesn't exists: " + accidentRef)
+		return shim.Error("5th argument must be a floating point string")
 	}
 
-	// === Check if EmergencyServices asset exists
-	ersRef := fmt.Sprintf("%s#%s", "base.EmergencyServices", respondingERS)
-	ersAsBytes, err := stub.GetState(ersRef)
+	latitude, err := strconv.ParseFloat(args[5], 64)
 	if err != nil {
-		return shim.Error("Failed to get accident report: " + err.Error())
-	} else if ersAsBytes == nil {
-		return shim.Error("This accident report doesn't exists: " + ersRef)
+		return shim.Error("6th argument must be a floating point string")
 	}
 
-	// === Unmarshal the report to an object
-	accidentReport := AccidentReport{}
-	if err = json.Unmarshal(reportAsBytes, accidentReport); err != nil {
-		return shim.Error("Failed to unmarshal accident report: " + err.Error())
-	}
+	// === Create emergency services object
+	address := AddressConcept{"base.Address", args[1], args[2], args[3]}
+	location := LocationConcept{"accident.Location", longitude, latitude, args[6]}
+	ers := &EmergencyServices{"base.EmergencyServices", CompanyAbstract{args[0], address}, location}
 
-	// === Update reponsing ERS if not yet assigned
-	if accidentReport.RespondingERS == "" {
-		accidentReport.RespondingERS = ersRef
-		reason = fmt.Sprintf("Emergencency Services (%s) responding to accident", respondingERS)
-	} else {
-		return shim.Error("Emergency Services already responding: " + accidentReport.RespondingERS)
+	return t.registerParticipant(stub, caller, ers.Class, ers.TradeName, ers)
+}
+
+// registerRepairShop - Register a new repair shop, store into state
+func (t *InsuranceChaincode) registerRepairShop(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, shops registered without location don't get quote requests
+	// 0=tradeName           1=addressLine1   2=addressLine2      3=addressLine3  4=phone  5=email                   6=longitude  7=latitude  8=serviceRadiusKm  9=makes
+	// USA Automotive NYC    225 Delancey St  New York, NY 10002  United States            nyc@usa-automotive.com  -73.984511   40.718092   25                 BMW,Mini
+
+	if len(args) != 6 && len(args) != 9 && len(args) != 10 {
+		return shim.Error("Incorrect number of arguments. Expecting 6, 9 or 10")
 	}
 
-	// === Check if description is given
-	if len(description) > 0 {
-		accidentReport.Description = description
-		reason = "Description of accident updated"
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
 	}
 
-	// === Check if other vehicle exists
-	if len(otherVehicle) > 0 {
-		vehicleRef := fmt.Sprintf("%s#%s", "base.Vehicle", otherVehicle)
-		vehicleAsBytes, err := stub.GetState(vehicleRef)
+	// === Parse location, service radius and supported makes
+	var location *LocationConcept
+	var serviceRadius float64
+	var makes []string
+	if len(args) > 6 {
+		makesArg := ""
+		if len(args) > 9 {
+			makesArg = args[9]
+		}
+		var err error
+		location, serviceRadius, makes, err = parseServiceArea(args[6], args[7], args[8], makesArg)
 		if err != nil {
-			return shim.Error("Failed to get vehicle: " + err.Error())
-		} else if vehicleAsBytes == nil {
-			return shim.Error("Added vehicle doesn't exists: " + vehicleRef)
+			return shim.Error(err.Error())
 		}
+	}
+
+	// === Create repair shop object
+	address := AddressConcept{"base.Address", args[1], args[2], args[3]}
+	shop := &RepairShop{"base.RepairShop", CompanyAbstract{args[0], address}, args[4], args[5], location, serviceRadius, makes}
+
+	return t.registerParticipant(stub, caller, shop.Class, shop.TradeName, shop)
+}
 
-		var vehicles []string
-		vehicles = accidentReport.InvolvedGoods.Vehicles
-		vehicles = append(vehicles, otherVehicle)
-		accidentReport.InvolvedGoods.Vehicles = vehicles
-		reason = "Another vehicle added to the report"
+// registerParticipant - Store a participant under its class#id key if it doesn't exist yet, bound to the caller's MSP
+func (t *InsuranceChaincode) registerParticipant(stub shim.ChaincodeStubInterface, caller *Caller, participantClass string, participantID string, participant interface{}) pb.Response {
+	// === Check if participant already exists
+	participantRef := fmt.Sprintf("%s#%s", participantClass, participantID)
+	participantAsBytes, err := stub.GetState(participantRef)
+	if err != nil {
+		return shim.Error("Failed to get participant: " + err.Error())
+	} else if participantAsBytes != nil {
+		return shim.Error("This participant already exists: " + participantRef)
 	}
 
-	// === Marshal the updated accident report
-	accidentJSONasBytes, err := json.Marshal(accidentReport)
+	// === Marshal the participant
+	participantJSONasBytes, err := json.Marshal(participant)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// === Save accident report to state ===
-	err = stub.PutState(accidentRef, accidentJSONasBytes)
+	// === Save participant to state
+	err = stub.PutState(participantRef, participantJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// === Emit ReportUpdate event ===
-	reportUpdate := &ReportUpdateEvent{accidentID, reason}
-	eventJSONasBytes, err := json.Marshal(reportUpdate)
+	// === Maintain location and make indexes
+	if err = putAssetIndexes(stub, participantClass, participantID, participantJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Identities of the registering organisation can act as the participant
+	err = bindParticipant(stub, participantClass, participantID, caller.MSPID)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	stub.SetEvent("ReportUpdateEvent", eventJSONasBytes)
 
-	fmt.Println("- Accident report successfully updated")
+	// === Emit ParticipantRegistered event
+	participantRegistered := &ParticipantRegisteredEvent{participantClass, participantID}
+	eventJSONasBytes, err := json.Marshal(participantRegistered)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("ParticipantRegisteredEvent", eventJSONasBytes)
+
+	fmt.Println("- Participant successfully registered")
 	return shim.Success(eventJSONasBytes)
 }
 
-// requestQuote - Request a new quote for repairs
-func (t *InsuranceChaincode) requestQuote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+// registerVehicle - Register a new vehicle, store into state
+func (t *InsuranceChaincode) registerVehicle(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	var err error
 
 	// simple data model arguments
-	// 0=accidentId  1=insurancePolicy  2=description
-	// 1534180781    USA-AX203-3459802  Scratch on back bumper (2x0.1 inches)
+	// 0=registrationNumber  1=licencePlate  2=dateFirstAdmission    3=dateAscription        4=owner    5=make  6=model  7=color  8=maxMass  9=maxSeating
+	// 1HTZR0007JH586991     B63-AGM         2014-09-28T00:00:00Z    2018-10-01T00:00:00Z    170632064  Toyota  Prius    Red      1526       4
 
-	if len(args) != 3 {
-		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	if len(args) != 10 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 10")
 	}
 
 	// === Check input variables ===
@@ -490,59 +851,684 @@ func (t *InsuranceChaincode) requestQuote(stub shim.ChaincodeStubInterface, args
 	if len(args[2]) <= 0 {
 		return shim.Error("3rd argument must be a non-empty string")
 	}
-
-	accidentID := args[0]
-	insurancePolicyID := args[1]
-	description := args[2]
-
-	// === Check if AccidentReport asset exists
-	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
-	reportAsBytes, err := stub.GetState(accidentRef)
-	if err != nil {
-		return shim.Error("Failed to get accident report: " + err.Error())
-	} else if reportAsBytes == nil {
-		return shim.Error("This accident report doesn't exists: " + accidentRef)
+	if len(args[4]) <= 0 {
+		return shim.Error("5th argument must be a non-empty string")
 	}
-
-	// === Unmarshal the report to an object
-	accidentReport := AccidentReport{}
-	if err = json.Unmarshal(reportAsBytes, accidentReport); err != nil {
-		return shim.Error("Failed to unmarshal accident report: " + err.Error())
+	if len(args[5]) <= 0 {
+		return shim.Error("6th argument must be a non-empty string")
+	}
+	if len(args[6]) <= 0 {
+		return shim.Error("7th argument must be a non-empty string")
+	}
+	if len(args[9]) <= 0 {
+		return shim.Error("10th argument must be a non-empty string")
 	}
 
-	// === Check if InsurancePolicy asset exists
-	policyRef := fmt.Sprintf("%s#%s", "insurance.InsurancePolicy", insurancePolicyID)
-	policyAsBytes, err := stub.GetState(policyRef)
+	registrationNumber := args[0]
+	licencePlate := args[1]
+	dateFirstAdmission, err := time.Parse(time.RFC3339, args[2])
 	if err != nil {
-		return shim.Error("Failed to get insurance policy: " + err.Error())
-	} else if policyAsBytes == nil {
-		return shim.Error("Given insurance policy doesn't exists: " + policyRef)
+		return shim.Error("3rd argument must be a RFC3339 dateTime string")
 	}
 
-	// === Unmarshal the policy to an object
-	insurancePolicy := InsurancePolicy{}
-	if err = json.Unmarshal(policyAsBytes, insurancePolicy); err != nil {
-		return shim.Error("Failed to unmarshal insurance policy: " + err.Error())
+	// === Parse optional dateAscription, defaults to first admission ===
+	dateAscription := dateFirstAdmission
+	if len(args[3]) > 0 {
+		dateAscription, err = time.Parse(time.RFC3339, args[3])
+		if err != nil {
+			return shim.Error("4th argument must be a RFC3339 dateTime string")
+		}
 	}
 
-	// === Check if vehicle is involved in accident
-	vehicles := accidentReport.InvolvedGoods.Vehicles
+	owner := args[4]
+	vehicleMake := args[5]
+	vehicleModel := args[6]
+	color := args[7]
 
-	// save the items in map
-	vmap := make(map[string]bool)
-	for i := 0; i < len(vehicles); i++ {
-		vmap[vehicles[i]] = true
+	var maxMass int
+	if len(args[8]) > 0 {
+		maxMass, err = strconv.Atoi(args[8])
+		if err != nil {
+			return shim.Error("9th argument must be a valid integer")
+		}
 	}
 
-	// Check if registered vehicle is involved in accident
-	var vehicleReg string
-	vehicleReg = insurancePolicy.RegisteredVehicle
-	if _, ok := vmap[vehicleReg]; ok {
-		return shim.Error("Insured vehicle is not involved in accident: " + vehicleReg)
+	maxSeating, err := strconv.Atoi(args[9])
+	if err != nil {
+		return shim.Error("10th argument must be a valid integer")
 	}
 
-	// === Retrieve insured vehicle
-	vehicleRef := insurancePolicy.RegisteredVehicle
+	// === Check if vehicle already exists
+	vehicleObjClass := "base.Vehicle"
+	vehicleRef := fmt.Sprintf("%s#%s", vehicleObjClass, registrationNumber)
+	vehicleAsBytes, err := stub.GetState(vehicleRef)
+	if err != nil {
+		return shim.Error("Failed to get vehicle: " + err.Error())
+	} else if vehicleAsBytes != nil {
+		return shim.Error("This vehicle already exists: " + vehicleRef)
+	}
+
+	// === Check if owner exists
+	ownerRef := fmt.Sprintf("%s#%s", "base.Registrant", owner)
+	ownerAsBytes, err := stub.GetState(ownerRef)
+	if err != nil {
+		return shim.Error("Failed to get owner: " + err.Error())
+	} else if ownerAsBytes == nil {
+		return shim.Error("Given owner doesn't exists: " + ownerRef)
+	}
+
+	// === Registrants can only register their own vehicles
+	if !caller.Admin && caller.ParticipantRef != ownerRef {
+		return shim.Error("Registrants may only register vehicles they own: " + ownerRef)
+	}
+
+	// === Create vehicle object and marshal to JSON ===
+	vehicle := &Vehicle{vehicleObjClass, registrationNumber, licencePlate, dateFirstAdmission, dateAscription, ownerRef, vehicleMake, vehicleModel, color, maxMass, maxSeating, nil}
+	vehicleJSONasBytes, err := json.Marshal(vehicle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save vehicle to state ===
+	err = stub.PutState(vehicleRef, vehicleJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- Vehicle successfully registered")
+	return shim.Success(vehicleJSONasBytes)
+}
+
+// transferVehicle - Transfer a vehicle to a new owner
+func (t *InsuranceChaincode) transferVehicle(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	var err error
+
+	// simple data model arguments
+	// 0=registrationNumber  1=newOwner   2=dateAscription
+	// JN6ND01S3GX194659     170632064    2018-11-01T00:00:00Z
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	registrationNumber := args[0]
+	newOwner := args[1]
+
+	dateAscription, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Parse optional dateAscription dateTime format ===
+	if len(args[2]) > 0 {
+		dateAscription, err = time.Parse(time.RFC3339, args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a RFC3339 dateTime string")
+		}
+	}
+
+	// === Check if vehicle exists
+	vehicleRef := fmt.Sprintf("%s#%s", "base.Vehicle", registrationNumber)
+	vehicleAsBytes, err := stub.GetState(vehicleRef)
+	if err != nil {
+		return shim.Error("Failed to get vehicle: " + err.Error())
+	} else if vehicleAsBytes == nil {
+		return shim.Error("Given vehicle doesn't exists: " + vehicleRef)
+	}
+
+	// === Unmarshal vehicle asset
+	var vehicle Vehicle
+	if err = json.Unmarshal(vehicleAsBytes, &vehicle); err != nil {
+		return shim.Error("Failed to unmarshal vehicle asset: " + err.Error())
+	}
+
+	// === Only the current owner can transfer the vehicle
+	if !caller.Admin && caller.ParticipantRef != vehicle.Owner {
+		return shim.Error("Only the owner may transfer the vehicle: " + vehicle.Owner)
+	}
+
+	// === Check if new owner exists
+	ownerRef := fmt.Sprintf("%s#%s", "base.Registrant", newOwner)
+	ownerAsBytes, err := stub.GetState(ownerRef)
+	if err != nil {
+		return shim.Error("Failed to get new owner: " + err.Error())
+	} else if ownerAsBytes == nil {
+		return shim.Error("Given new owner doesn't exists: " + ownerRef)
+	}
+
+	if vehicle.Owner == ownerRef {
+		return shim.Error("The vehicle is already owned by " + ownerRef)
+	}
+	if dateAscription.Before(vehicle.DateAscription) {
+		return shim.Error("Date of ascription must be after the current date of ascription")
+	}
+
+	// === Move current owner to the ownership history
+	previousOwner := vehicle.Owner
+	ownership := OwnershipConcept{"base.Ownership", previousOwner, vehicle.DateAscription, dateAscription}
+	vehicle.OwnershipHistory = append(vehicle.OwnershipHistory, ownership)
+	vehicle.Owner = ownerRef
+	vehicle.DateAscription = dateAscription
+
+	// === Marshal the updated vehicle
+	vehicleJSONasBytes, err := json.Marshal(vehicle)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save vehicle to state ===
+	err = stub.PutState(vehicleRef, vehicleJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Flag active policies of which the holder no longer owns the vehicle
+	flaggedPolicies, err := t.flagPoliciesForOwner(stub, vehicleRef, ownerRef, dateAscription)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit VehicleTransferred event ===
+	vehicleTransferred := &VehicleTransferredEvent{registrationNumber, previousOwner, ownerRef, flaggedPolicies}
+	eventJSONasBytes, err := json.Marshal(vehicleTransferred)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("VehicleTransferredEvent", eventJSONasBytes)
+
+	fmt.Println("- Vehicle successfully transferred")
+	return shim.Success(eventJSONasBytes)
+}
+
+// flagPoliciesForOwner - Mark active policies of a vehicle whose holder isn't the owner, returns the flagged references
+func (t *InsuranceChaincode) flagPoliciesForOwner(stub shim.ChaincodeStubInterface, vehicleRef string, ownerRef string, at time.Time) ([]string, error) {
+	var flaggedPolicies []string
+
+	policyRecords, err := getIndexedAssets(stub, assetIDFromRef(vehicleRef), policyVehicleIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, policyRecord := range policyRecords {
+		var insurancePolicy InsurancePolicy
+		if err = json.Unmarshal(policyRecord.Record, &insurancePolicy); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal insurance policy %s: %s", policyRecord.Key, err.Error())
+		}
+
+		// only active policies of the transferred vehicle
+		if insurancePolicy.RegisteredVehicle != vehicleRef || insurancePolicy.policyStatusAt(at) != policyActive {
+			continue
+		}
+
+		holderNotOwner := insurancePolicy.PolicyHolder != ownerRef
+		if insurancePolicy.HolderNotOwner == holderNotOwner {
+			continue
+		}
+		insurancePolicy.HolderNotOwner = holderNotOwner
+
+		policyJSONasBytes, err := json.Marshal(insurancePolicy)
+		if err != nil {
+			return nil, err
+		}
+		if err = stub.PutState(policyRecord.Key, policyJSONasBytes); err != nil {
+			return nil, err
+		}
+
+		if holderNotOwner {
+			flaggedPolicies = append(flaggedPolicies, policyRecord.Key)
+		}
+	}
+
+	return flaggedPolicies, nil
+}
+
+// reportAccident - Create a new accident report, store into state
+func (t *InsuranceChaincode) reportAccident(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	var err error
+
+	// simple data model arguments
+	// 0=longitude  1=latitude  2=occuredAt               3=reporting vehicle
+	// -73.936206   40.849496   2018-08-03T10:20:20.325Z  JN6ND01S3GX194659
+
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error(fmt.Sprintf("Incorrect number of arguments. Expecting minimum of 2 and maximum of 4, got %d", len(args)))
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	longitude, err := strconv.ParseFloat(args[0], 64)
+	if err != nil {
+		return shim.Error("1st argument must be a floating point string")
+	}
+
+	latitude, err := strconv.ParseFloat(args[1], 64)
+	if err != nil {
+		return shim.Error("2nd argument must be a floating point string")
+	}
+
+	occuredAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Parse occuredAt dateTime format ===
+	if len(args) > 2 && len(args[2]) > 0 {
+		occuredAt, err = time.Parse(time.RFC3339, args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a RFC3339 dateTime string")
+		}
+	}
+
+	// === Check if optional vehicle exists ===
+	var vehicleRef string
+	if len(args) > 3 && len(args[3]) > 0 {
+		vehicleRef = fmt.Sprintf("%s#%s", "base.Vehicle", args[3])
+		vehicleAsBytes, err := stub.GetState(vehicleRef)
+		if err != nil {
+			return shim.Error("Failed to get vehicle: " + err.Error())
+		} else if vehicleAsBytes == nil {
+			return shim.Error("This vehicle doesn't exists: " + vehicleRef)
+		}
+	}
+
+	// === Create report object
+	accidentObjClass := "accident.AccidentReport"
+	accidentID, err := newAssetID(stub, accidentObjClass, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	location := LocationConcept{"accident.Location", longitude, latitude, ""}
+	accidentReport := &AccidentReport{Class: accidentObjClass, AccidentID: accidentID, OccuredAt: occuredAt, Status: "NEW", Location: location}
+
+	// === Rank the nearest emergency services to dispatch
+	accidentReport.DispatchCandidates, err = nearestEmergencyServices(stub, location)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if vehicleRef != "" {
+		vehicles := []string{vehicleRef}
+		involvedGoods := GoodsConcept{"accident.Goods", vehicles}
+		accidentReport.InvolvedGoods = involvedGoods
+	}
+
+	// === Marshal accident report
+	accidentJSONasBytes, err := json.Marshal(accidentReport)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save accident to state ===
+	accidentRef := fmt.Sprintf("%s#%s", accidentObjClass, accidentID)
+	err = stub.PutState(accidentRef, accidentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, accidentObjClass, accidentID, accidentJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit NewAccident event ===
+	locationStr := fmt.Sprintf("%f, %f", longitude, latitude)
+	newAccident := &NewAccidentEvent{accidentID, locationStr, accidentReport.DispatchCandidates}
+	eventJSONasBytes, err := json.Marshal(newAccident)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("NewAccidentEvent", eventJSONasBytes)
+
+	fmt.Println("- Accident report successfully created")
+	return shim.Success(eventJSONasBytes)
+
+}
+
+// updateReport - Update the report
+func (t *InsuranceChaincode) updateReport(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	var err error
+	var reasons []string
+	var reasonCodes []string
+
+	// simple data model arguments, the responding ERS is the caller, the medical data of a person is passed as transient medical
+	// 0=accidentId  1=description           2=other vehicle      3=person role  4=person registrant  5=person descriptor
+	// 1534180781    Nose to tail collision  1HTZR0007JH586991    PEDESTRIAN                          Female, approx. 40 years
+
+	if len(args) < 1 || len(args) > 6 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 1 and maximum of 6")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	accidentID := args[0]
+	respondingERS := caller.ParticipantID
+	ersRef := caller.ParticipantRef
+	var description, otherVehicle, personRole, personRegistrant, personDescriptor string
+	if len(args) > 1 {
+		description = args[1]
+	}
+	if len(args) > 2 {
+		otherVehicle = args[2]
+	}
+	if len(args) > 3 {
+		personRole = args[3]
+	}
+	if len(args) > 4 {
+		personRegistrant = args[4]
+	}
+	if len(args) > 5 {
+		personDescriptor = args[5]
+	}
+
+	// === Check if AccidentReport asset exists
+	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
+	reportAsBytes, err := stub.GetState(accidentRef)
+	if err != nil {
+		return shim.Error("Failed to get accident report: " + err.Error())
+	} else if reportAsBytes == nil {
+		return shim.Error("This accident report doesn't exists: " + accidentRef)
+	}
+
+	// === Unmarshal the report to an object
+	accidentReport := &AccidentReport{}
+	if err = json.Unmarshal(reportAsBytes, accidentReport); err != nil {
+		return shim.Error("Failed to unmarshal accident report: " + err.Error())
+	}
+
+	// === Resolved reports can't be edited anymore
+	if accidentReport.Status == "RESOLVED" {
+		return shim.Error("Accident report is already resolved: " + accidentRef)
+	}
+
+	// === Update reponsing ERS if not yet assigned
+	if accidentReport.RespondingERS == "" {
+		if err = t.transitionReport(accidentReport, "RESPONDING"); err != nil {
+			return shim.Error(err.Error())
+		}
+		accidentReport.RespondingERS = ersRef
+		reasons = append(reasons, fmt.Sprintf("Emergencency Services (%s) responding to accident", respondingERS))
+		reasonCodes = append(reasonCodes, "ERS_ASSIGNED")
+	} else if accidentReport.RespondingERS != ersRef {
+		return shim.Error("Emergency Services already responding: " + accidentReport.RespondingERS)
+	}
+
+	// === Check if description is given
+	if len(description) > 0 {
+		accidentReport.Description = description
+		reasons = append(reasons, "Description of accident updated")
+		reasonCodes = append(reasonCodes, "DESCRIPTION_UPDATED")
+	}
+
+	// === Check if other vehicle exists
+	if len(otherVehicle) > 0 {
+		vehicleRef := fmt.Sprintf("%s#%s", "base.Vehicle", otherVehicle)
+		vehicleAsBytes, err := stub.GetState(vehicleRef)
+		if err != nil {
+			return shim.Error("Failed to get vehicle: " + err.Error())
+		} else if vehicleAsBytes == nil {
+			return shim.Error("Added vehicle doesn't exists: " + vehicleRef)
+		}
+
+		for _, involvedVehicle := range accidentReport.InvolvedGoods.Vehicles {
+			if involvedVehicle == vehicleRef {
+				return shim.Error("Vehicle already involved in accident: " + vehicleRef)
+			}
+		}
+
+		accidentReport.InvolvedGoods.Class = "accident.Goods"
+		accidentReport.InvolvedGoods.Vehicles = append(accidentReport.InvolvedGoods.Vehicles, vehicleRef)
+		reasons = append(reasons, "Another vehicle added to the report")
+		reasonCodes = append(reasonCodes, "VEHICLE_ADDED")
+	}
+
+	// === Check if a person is added
+	if len(personRole) > 0 {
+		person, err := addInvolvedPerson(stub, accidentReport, personRole, personRegistrant, personDescriptor)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		reasons = append(reasons, fmt.Sprintf("Person %s (%s) added to the report", person.PersonID, person.Role))
+		reasonCodes = append(reasonCodes, "PERSON_ADDED")
+	} else if len(personRegistrant) > 0 || len(personDescriptor) > 0 {
+		return shim.Error("4th argument must be a non-empty string when adding a person")
+	}
+
+	if len(reasonCodes) == 0 {
+		return shim.Error("Nothing to update, Emergency Services already responding: " + ersRef)
+	}
+
+	return t.saveReportUpdate(stub, accidentID, accidentReport, reasons, reasonCodes)
+}
+
+// closeReport - Close the report by the responding ERS
+func (t *InsuranceChaincode) closeReport(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	var err error
+
+	// simple data model arguments, the responding ERS is the caller
+	// 0=accidentId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	accidentID := args[0]
+	respondingERS := caller.ParticipantID
+
+	// === Check if AccidentReport asset exists
+	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
+	reportAsBytes, err := stub.GetState(accidentRef)
+	if err != nil {
+		return shim.Error("Failed to get accident report: " + err.Error())
+	} else if reportAsBytes == nil {
+		return shim.Error("This accident report doesn't exists: " + accidentRef)
+	}
+
+	// === Unmarshal the report to an object
+	accidentReport := &AccidentReport{}
+	if err = json.Unmarshal(reportAsBytes, accidentReport); err != nil {
+		return shim.Error("Failed to unmarshal accident report: " + err.Error())
+	}
+
+	// === Only the responding ERS may close the report
+	if accidentReport.RespondingERS != caller.ParticipantRef {
+		return shim.Error("Only the responding Emergency Services may close the report: " + caller.ParticipantRef)
+	}
+
+	if err = t.transitionReport(accidentReport, "RESOLVED"); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	reasons := []string{fmt.Sprintf("Accident resolved by Emergency Services (%s)", respondingERS)}
+	return t.saveReportUpdate(stub, accidentID, accidentReport, reasons, []string{"REPORT_RESOLVED"})
+}
+
+// transitionReport - Move an accident report to a new status if the transition is allowed
+func (t *InsuranceChaincode) transitionReport(accidentReport *AccidentReport, status string) error {
+	if !isAllowedTransition(reportTransitions, accidentReport.Status, status) {
+		return fmt.Errorf("Accident report can't move from %s to %s", accidentReport.Status, status)
+	}
+	accidentReport.Status = status
+	return nil
+}
+
+// saveReportUpdate - Store an updated accident report into state and emit ReportUpdate event
+func (t *InsuranceChaincode) saveReportUpdate(stub shim.ChaincodeStubInterface, accidentID string, accidentReport *AccidentReport, reasons []string, reasonCodes []string) pb.Response {
+	// === Marshal the updated accident report
+	accidentJSONasBytes, err := json.Marshal(accidentReport)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save accident report to state ===
+	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
+	err = stub.PutState(accidentRef, accidentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, "accident.AccidentReport", accidentID, accidentJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit ReportUpdate event ===
+	reportUpdate := &ReportUpdateEvent{accidentID, strings.Join(reasons, "; "), accidentReport.Status, reasonCodes}
+	eventJSONasBytes, err := json.Marshal(reportUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("ReportUpdateEvent", eventJSONasBytes)
+
+	fmt.Println("- Accident report successfully updated")
+	return shim.Success(eventJSONasBytes)
+}
+
+// requestQuote - Request a new quote for repairs
+func (t *InsuranceChaincode) requestQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	var err error
+
+	// simple data model arguments, the bidding windows are only given for SEALED bidding
+	// 0=accidentId  1=insurancePolicy  2=description                          3=biddingMode  4=biddingClosesAt          5=revealClosesAt
+	// 1534180781    USA-AX203-3459802  Scratch on back bumper (2x0.1 inches)  SEALED         2018-08-26T12:00:00.000Z  2018-08-27T12:00:00.000Z
+
+	if len(args) != 3 && len(args) != 4 && len(args) != 6 {
+		return shim.Error("Incorrect number of arguments. Expecting 3, 4 or 6")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+
+	accidentID := args[0]
+	insurancePolicyID := args[1]
+	description := args[2]
+
+	biddingMode := biddingOpen
+	if len(args) > 3 && len(args[3]) > 0 {
+		biddingMode = strings.ToUpper(args[3])
+	}
+	if biddingMode != biddingOpen && biddingMode != biddingSealed {
+		return shim.Error("4th argument must be OPEN or SEALED")
+	}
+
+	// === Sealed bidding needs a commitment window followed by a reveal window
+	var biddingClosesAt, revealClosesAt *time.Time
+	if biddingMode == biddingSealed {
+		if len(args) != 6 {
+			return shim.Error("Sealed bidding needs the end of the bidding and reveal windows as 5th and 6th argument")
+		}
+		txTime, err := getTxTime(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		biddingCloses, err := time.Parse(time.RFC3339, args[4])
+		if err != nil {
+			return shim.Error("5th argument must be a RFC3339 dateTime string")
+		} else if !biddingCloses.After(txTime) {
+			return shim.Error("5th argument must be in the future")
+		}
+		revealCloses, err := time.Parse(time.RFC3339, args[5])
+		if err != nil {
+			return shim.Error("6th argument must be a RFC3339 dateTime string")
+		} else if !revealCloses.After(biddingCloses) {
+			return shim.Error("6th argument must be after the end of the bidding window")
+		}
+		biddingClosesAt, revealClosesAt = &biddingCloses, &revealCloses
+	} else if len(args) > 4 {
+		return shim.Error("Open bidding takes no bidding windows")
+	}
+
+	// === Check if AccidentReport asset exists
+	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
+	reportAsBytes, err := stub.GetState(accidentRef)
+	if err != nil {
+		return shim.Error("Failed to get accident report: " + err.Error())
+	} else if reportAsBytes == nil {
+		return shim.Error("This accident report doesn't exists: " + accidentRef)
+	}
+
+	// === Unmarshal the report to an object
+	accidentReport := AccidentReport{}
+	if err = json.Unmarshal(reportAsBytes, &accidentReport); err != nil {
+		return shim.Error("Failed to unmarshal accident report: " + err.Error())
+	}
+
+	// === Check if InsurancePolicy asset exists
+	policyRef := fmt.Sprintf("%s#%s", "insurance.InsurancePolicy", insurancePolicyID)
+	policyAsBytes, err := stub.GetState(policyRef)
+	if err != nil {
+		return shim.Error("Failed to get insurance policy: " + err.Error())
+	} else if policyAsBytes == nil {
+		return shim.Error("Given insurance policy doesn't exists: " + policyRef)
+	}
+
+	// === Unmarshal the policy to an object
+	insurancePolicy := InsurancePolicy{}
+	if err = json.Unmarshal(policyAsBytes, &insurancePolicy); err != nil {
+		return shim.Error("Failed to unmarshal insurance policy: " + err.Error())
+	}
+
+	// === Only the policy holder or its insurer can request quotes
+	if !caller.isPolicyParty(&insurancePolicy) {
+		return shim.Error("Only the holder or insurer of the policy may request quotes: " + policyRef)
+	}
+
+	// === Use the policy as it was at the time of the accident, later endorsements don't apply
+	insurancePolicy = insurancePolicy.asOf(accidentReport.OccuredAt)
+
+	// === Check if vehicle is involved in accident
+	vehicles := accidentReport.InvolvedGoods.Vehicles
+
+	// save the items in map
+	vmap := make(map[string]bool)
+	for i := 0; i < len(vehicles); i++ {
+		vmap[vehicles[i]] = true
+	}
+
+	// Check if registered vehicle is involved in accident
+	var vehicleReg string
+	vehicleReg = insurancePolicy.RegisteredVehicle
+	if _, ok := vmap[vehicleReg]; !ok {
+		return shim.Error("Insured vehicle is not involved in accident: " + vehicleReg)
+	}
+
+	// === Check if the policy covers the time and place of the accident
+	if err = checkPolicyCoverage(&insurancePolicy, &accidentReport); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Retrieve insured vehicle
+	vehicleRef := insurancePolicy.RegisteredVehicle
 	vehicleAsBytes, err := stub.GetState(vehicleRef)
 	if err != nil {
 		return shim.Error("Failed to get vehicle: " + err.Error())
@@ -552,15 +1538,32 @@ func (t *InsuranceChaincode) requestQuote(stub shim.ChaincodeStubInterface, args
 
 	// === Unmarshal the vehicle to an object
 	vehicle := Vehicle{}
-	if err = json.Unmarshal(vehicleAsBytes, vehicle); err != nil {
+	if err = json.Unmarshal(vehicleAsBytes, &vehicle); err != nil {
 		return shim.Error("Failed to unmarshal vehicle: " + err.Error())
 	}
 
+	// === Route the request to the repair shops near the accident which repair the make
+	eligibleShops, err := eligibleRepairShops(stub, accidentReport.Location, vehicle.Make)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if len(eligibleShops) == 0 {
+		// === Until repair shops set their location with updateRepairShop, any shop may quote
+		located, err := repairShopsLocated(stub)
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if located {
+			return shim.Error(fmt.Sprintf("No repair shop repairs %s near the accident: %s", vehicle.Make, accidentRef))
+		}
+		eligibleShops = nil
+	}
+
 	// === Create new QuoteRequest object
 	requestObjClass := "vehiclerepair.QuoteRequest"
-	//requestID, err := strconv.ParseInt("1000000001", 10, 64) //static id for testing
-	requestID := time.Now().Unix()
-	quoteRequest := &QuoteRequest{requestObjClass, strconv.FormatInt(requestID, 10), accidentRef, policyRef, description}
+	requestID, err := newAssetID(stub, requestObjClass, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	quoteRequest := &QuoteRequest{requestObjClass, requestID, accidentRef, policyRef, description, "", biddingMode, biddingClosesAt, revealClosesAt, vehicle.Make, vehicle.Model, eligibleShops}
 
 	// === Marshal the quote request
 	requestJSONasBytes, err := json.Marshal(quoteRequest)
@@ -569,14 +1572,19 @@ func (t *InsuranceChaincode) requestQuote(stub shim.ChaincodeStubInterface, args
 	}
 
 	// === Save request to state
-	requestRef := fmt.Sprintf("%s#%d", requestObjClass, requestID)
+	requestRef := fmt.Sprintf("%s#%s", requestObjClass, requestID)
 	err = stub.PutState(requestRef, requestJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, requestObjClass, requestID, requestJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// === Emit RequestForQuote event
-	newQuoteRequest := &RequestForQuoteEvent{strconv.FormatInt(requestID, 10), vehicle.Make, vehicle.Model, description}
+	newQuoteRequest := &RequestForQuoteEvent{requestID, vehicle.Make, vehicle.Model, description, biddingMode, biddingClosesAt, revealClosesAt, eligibleShops}
 	eventJSONasBytes, err := json.Marshal(newQuoteRequest)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -588,15 +1596,15 @@ func (t *InsuranceChaincode) requestQuote(stub shim.ChaincodeStubInterface, args
 }
 
 // offerQuote - Offer a quote for repair
-func (t *InsuranceChaincode) offerQuote(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (t *InsuranceChaincode) offerQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	var err error
 
-	// simple data model arguments
-	// 0=requestId  1=repairShop       2=json{estimates[]}                                                                                              3=tax (%)
-	// 1534180781   USA Automotive NY  [{"type":"REPAIR","description":"Scratch removal","costOfPart":30.6,"costOfLabor":100,"totalCost":130.6},{...}]  11
+	// simple data model arguments, the repair shop is the caller
+	// 0=requestId  1=json{estimates[]}                                                                                               2=tax (%)  3=currency
+	// 1534180781   [{"type":"REPAIR","description":"Scratch removal","costOfParts":30.6,"costOfLabor":100,"totalCost":130.6},{...}]  11         USD
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting exactly 4")
+	if len(args) < 3 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 3 and maximum of 4")
 	}
 
 	// === Check input variables
@@ -606,108 +1614,406 @@ func (t *InsuranceChaincode) offerQuote(stub shim.ChaincodeStubInterface, args [
 	if len(args[1]) <= 0 {
 		return shim.Error("2nd argument must be a non-empty string")
 	}
-	if len(args[2]) <= 0 {
-		return shim.Error("3rd argument must be a non-empty string")
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+
+	// === Initialize variables
+	requestID := args[0]
+	shopRef := caller.ParticipantRef
+	estimatesAsBytes := []byte(args[1])
+	tax, err := ParsePercentage(args[2])
+	if err != nil {
+		return shim.Error("3rd argument must be a decimal string with at most 4 decimals")
+	} else if tax < 0 || tax >= 100*percentageScale {
+		return shim.Error("3rd argument must be between 0 and 100")
+	}
+
+	currency := defaultCurrency
+	if len(args) > 3 && len(args[3]) > 0 {
+		currency = strings.ToUpper(args[3])
+		if _, err = currencyExponent(currency); err != nil {
+			return shim.Error("4th argument must be a supported ISO 4217 currency code")
+		}
+	}
+
+	// === Unmarshal estimates array and check totals
+	estimates, err := parseEstimates(estimatesAsBytes, currency)
+	if err != nil {
+		return shim.Error("Failed to unmarshal estimate array: " + err.Error())
+	}
+
+	// === Check if QuoteRequest asset exists
+	requestObjClass := "vehiclerepair.QuoteRequest"
+	requestRef := fmt.Sprintf("%s#%s", requestObjClass, requestID)
+	requestAsBytes, err := stub.GetState(requestRef)
+	if err != nil {
+		return shim.Error("Failed to get quote request: " + err.Error())
+	} else if requestAsBytes == nil {
+		return shim.Error("Given quote request doesn't exists: " + requestRef)
+	}
+
+	// === Unmarshal the quote request to an object
+	quoteRequest := QuoteRequest{}
+	if err = json.Unmarshal(requestAsBytes, &quoteRequest); err != nil {
+		return shim.Error("Failed to unmarshal quote request: " + err.Error())
+	}
+
+	// === Check if the quote request is still open for offers
+	if quoteRequest.AwardedQuote != "" {
+		return shim.Error("Quote request is already awarded to " + quoteRequest.AwardedQuote)
+	}
+	if quoteRequest.BiddingMode == biddingSealed {
+		return shim.Error("Quote request takes sealed bids, commit the quote with commitQuote: " + requestRef)
+	}
+	if !quoteRequest.acceptsShop(shopRef) {
+		return shim.Error("Repair shop isn't eligible to quote for the request: " + shopRef)
+	}
+
+	repairQuote, totalEstimates, err := newRepairQuote(stub, requestRef, shopRef, estimates, tax, currency)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit NewQuoteOffer event
+	newQuoteOffer := &NewQuoteOfferEvent{requestID, repairQuote.QuoteID, totalEstimates}
+	eventJSONasBytes, err := json.Marshal(newQuoteOffer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("NewQuoteOfferEvent", eventJSONasBytes)
+
+	fmt.Println("- Offer quote for repairs successfully created")
+	return shim.Success(eventJSONasBytes)
+}
+
+// newRepairQuote - Calculate the totals of the estimates and store a new offered repair quote into state
+//
+// Returns the quote and the sum of the estimates without tax.
+func newRepairQuote(stub shim.ChaincodeStubInterface, requestRef string, shopRef string, estimates []EstimateConcept, tax Percentage, currency string) (*RepairQuote, Money, error) {
+	var err error
+
+	// === Calculate totals, tax is rounded half away from zero once over the sum of all estimates
+	totalParts := Money{0, currency}
+	totalLabor := Money{0, currency}
+	totalRefinish := Money{0, currency}
+	totalEstimates := Money{0, currency}
+	for _, estimate := range estimates {
+		if totalParts, err = totalParts.Add(estimate.CostOfParts); err != nil {
+			return nil, Money{}, err
+		}
+		if totalLabor, err = totalLabor.Add(estimate.CostOfLabor); err != nil {
+			return nil, Money{}, err
+		}
+		if totalRefinish, err = totalRefinish.Add(estimate.CostOfRefinish); err != nil {
+			return nil, Money{}, err
+		}
+		if totalEstimates, err = totalEstimates.Add(estimate.TotalCost); err != nil {
+			return nil, Money{}, err
+		}
+	}
+
+	taxAmount, err := totalEstimates.Percent(tax)
+	if err != nil {
+		return nil, Money{}, err
+	}
+	total, err := totalEstimates.Add(taxAmount)
+	if err != nil {
+		return nil, Money{}, err
+	}
+
+	// === Create new RepairQuote object
+	quoteObjClass := "vehiclerepair.RepairQuote"
+	quoteID, err := newAssetID(stub, quoteObjClass, "")
+	if err != nil {
+		return nil, Money{}, err
+	}
+	repairQuote := &RepairQuote{quoteObjClass, quoteID, requestRef, shopRef, estimates, totalParts, totalLabor, totalRefinish, tax, taxAmount, total, "OFFERED", ""}
+
+	// === Marshal the quote request
+	quoteJSONasBytes, err := json.Marshal(repairQuote)
+	if err != nil {
+		return nil, Money{}, err
+	}
+
+	// === Save request to state
+	quoteRef := fmt.Sprintf("%s#%s", quoteObjClass, quoteID)
+	err = stub.PutState(quoteRef, quoteJSONasBytes)
+	if err != nil {
+		return nil, Money{}, err
+	}
+
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, quoteObjClass, quoteID, quoteJSONasBytes); err != nil {
+		return nil, Money{}, err
+	}
+
+	return repairQuote, totalEstimates, nil
+}
+
+// parseEstimates - Unmarshal estimates in the given currency and check their total costs
+//
+// Amounts can be given as Money objects or plain JSON numbers, which are taken in the given currency. A missing
+// total cost is calculated, a given total cost must equal the sum of parts, labor and refinish.
+func parseEstimates(estimatesAsBytes []byte, currency string) ([]EstimateConcept, error) {
+	var input []struct {
+		Type           string          `json:"type"`
+		Description    string          `json:"description"`
+		CostOfParts    json.RawMessage `json:"costOfParts"`
+		CostOfLabor    json.RawMessage `json:"costOfLabor"`
+		CostOfRefinish json.RawMessage `json:"costOfRefinish"`
+		TotalCost      json.RawMessage `json:"totalCost"`
+	}
+	if err := json.Unmarshal(estimatesAsBytes, &input); err != nil {
+		return nil, err
+	}
+	if len(input) == 0 {
+		return nil, fmt.Errorf("At least one estimate is required")
+	}
+
+	estimates := make([]EstimateConcept, len(input))
+	for i, item := range input {
+		estimateType := strings.ToUpper(item.Type)
+		if estimateType != "REPAIR" && estimateType != "REPLACE" {
+			return nil, fmt.Errorf("Estimate %d must be of type REPAIR or REPLACE", i+1)
+		}
+
+		// === Parse costs, all in the currency of the quote
+		var costs [4]Money
+		for j, raw := range []json.RawMessage{item.CostOfParts, item.CostOfLabor, item.CostOfRefinish, item.TotalCost} {
+			cost, err := parseMoneyJSON(raw, currency, false)
+			if err != nil {
+				return nil, fmt.Errorf("Estimate %d: %s", i+1, err.Error())
+			}
+			if cost.Currency != currency {
+				return nil, fmt.Errorf("Estimate %d must be in %s, got %s", i+1, currency, cost.Currency)
+			}
+			if cost.MinorUnits < 0 {
+				return nil, fmt.Errorf("Estimate %d has a negative amount: %s", i+1, cost)
+			}
+			costs[j] = cost
+		}
+
+		// === Recompute and check the total cost
+		totalCost, err := costs[0].Add(costs[1])
+		if err == nil {
+			totalCost, err = totalCost.Add(costs[2])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Estimate %d: %s", i+1, err.Error())
+		}
+		if len(item.TotalCost) > 0 && string(item.TotalCost) != "null" && costs[3] != totalCost {
+			return nil, fmt.Errorf("Estimate %d total cost %s doesn't match parts, labor and refinish %s", i+1, costs[3], totalCost)
+		}
+
+		estimates[i] = EstimateConcept{"vehiclerepair.Estimate", estimateType, item.Description, costs[0], costs[1], costs[2], totalCost}
+	}
+
+	return estimates, nil
+}
+
+// acceptQuote - Award a repair quote for a quote request
+func (t *InsuranceChaincode) acceptQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments
+	// 0=requestId   1=quoteId
+	// 1534180781    1534180999
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	quoteRequest, repairQuote, err := t.getOfferedQuote(stub, caller, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if quoteRequest.BiddingMode == biddingSealed {
+		return shim.Error("Quote request takes sealed bids, the best revealed quote is awarded with awardSealedQuote")
+	}
+
+	return t.awardQuote(stub, quoteRequest, repairQuote, "Quote awarded by requester")
+}
+
+// awardQuote - Award a repair quote to its quote request, store both into state and emit QuoteUpdate event
+func (t *InsuranceChaincode) awardQuote(stub shim.ChaincodeStubInterface, quoteRequest *QuoteRequest, repairQuote *RepairQuote, reason string) pb.Response {
+	// === Award the quote to the request
+	requestRef := fmt.Sprintf("%s#%s", quoteRequest.Class, quoteRequest.RequestID)
+	quoteRef := fmt.Sprintf("%s#%s", repairQuote.Class, repairQuote.QuoteID)
+	quoteRequest.AwardedQuote = quoteRef
+	repairQuote.Status = "ACCEPTED"
+
+	requestJSONasBytes, err := json.Marshal(quoteRequest)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(requestRef, requestJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Awarded totals are the samples of the fraud median for the make and model
+	awardedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putAwardSample(stub, quoteRequest, repairQuote.Total, awardedAt); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return t.saveQuoteUpdate(stub, quoteRequest.RequestID, repairQuote, reason)
+}
+
+// rejectQuote - Reject a repair quote for a quote request
+func (t *InsuranceChaincode) rejectQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments
+	// 0=requestId   1=quoteId     2=reason
+	// 1534180781    1534180999    Too expensive
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	quoteRequest, repairQuote, err := t.getOfferedQuote(stub, caller, args[0], args[1])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if quoteRequest.BiddingMode == biddingSealed {
+		return shim.Error("Quote request takes sealed bids, revealed quotes can't be rejected as awardSealedQuote ranks all of them")
 	}
-	if len(args[3]) <= 0 {
-		return shim.Error("4th argument must be a non-empty string")
+
+	repairQuote.Status = "REJECTED"
+	return t.saveQuoteUpdate(stub, quoteRequest.RequestID, repairQuote, args[2])
+}
+
+// getOfferedQuote - Get an open quote request of the caller's policy and one of its offered repair quotes
+func (t *InsuranceChaincode) getOfferedQuote(stub shim.ChaincodeStubInterface, caller *Caller, requestID string, quoteID string) (*QuoteRequest, *RepairQuote, error) {
+	quoteRequest, err := getOpenQuoteRequest(stub, caller, requestID)
+	if err != nil {
+		return nil, nil, err
 	}
+	requestRef := fmt.Sprintf("%s#%s", quoteRequest.Class, quoteRequest.RequestID)
 
-	// === Initialize variables
-	requestID := args[0]
-	repairShopID := args[1]
-	estimatesAsBytes := []byte(args[2])
-	tax, err := strconv.ParseFloat(args[3], 32)
+	// === Check if RepairQuote asset exists
+	quoteRef := fmt.Sprintf("%s#%s", "vehiclerepair.RepairQuote", quoteID)
+	quoteAsBytes, err := stub.GetState(quoteRef)
 	if err != nil {
-		return shim.Error("4th argument must be a floating point string")
-	} else if 0 <= tax && tax >= 100 {
-		return shim.Error("4th argument must be between 0 and 100")
+		return nil, nil, fmt.Errorf("Failed to get repair quote: %s", err.Error())
+	} else if quoteAsBytes == nil {
+		return nil, nil, fmt.Errorf("Given repair quote doesn't exists: %s", quoteRef)
 	}
 
-	// === Unmarshal estimates array and calculate totals
-	var estimates []EstimateConcept
-	if err = json.Unmarshal(estimatesAsBytes, &estimates); err != nil {
-		return shim.Error("Failed to unmarshal estimate array: " + err.Error())
+	repairQuote := &RepairQuote{}
+	if err = json.Unmarshal(quoteAsBytes, repairQuote); err != nil {
+		return nil, nil, fmt.Errorf("Failed to unmarshal repair quote: %s", err.Error())
+	}
+
+	// === Check if the quote is an open offer for the request
+	if repairQuote.QuoteRequest != requestRef {
+		return nil, nil, fmt.Errorf("Given repair quote isn't offered for %s", requestRef)
+	}
+	if repairQuote.Status == "REJECTED" {
+		return nil, nil, fmt.Errorf("Given repair quote is already rejected: %s", quoteRef)
 	}
 
+	return quoteRequest, repairQuote, nil
+}
+
+// getOpenQuoteRequest - Get a quote request of the caller's policy which isn't awarded yet
+func getOpenQuoteRequest(stub shim.ChaincodeStubInterface, caller *Caller, requestID string) (*QuoteRequest, error) {
 	// === Check if QuoteRequest asset exists
-	requestObjClass := "vehiclerepair.QuoteRequest"
-	requestRef := fmt.Sprintf("%s#%s", requestObjClass, requestID)
+	requestRef := fmt.Sprintf("%s#%s", "vehiclerepair.QuoteRequest", requestID)
 	requestAsBytes, err := stub.GetState(requestRef)
 	if err != nil {
-		return shim.Error("Failed to get quote request: " + err.Error())
+		return nil, fmt.Errorf("Failed to get quote request: %s", err.Error())
 	} else if requestAsBytes == nil {
-		return shim.Error("Given quote request doesn't exists: " + requestRef)
+		return nil, fmt.Errorf("Given quote request doesn't exists: %s", requestRef)
 	}
 
-	// === Check if RepairShop asset exists
-	shopObjClass := "base.RepairShop"
-	shopRef := fmt.Sprintf("%s#%s", shopObjClass, repairShopID)
-	shopAsBytes, err := stub.GetState(shopRef)
+	quoteRequest := &QuoteRequest{}
+	if err = json.Unmarshal(requestAsBytes, quoteRequest); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal quote request: %s", err.Error())
+	}
+
+	if quoteRequest.AwardedQuote != "" {
+		return nil, fmt.Errorf("Quote request is already awarded to %s", quoteRequest.AwardedQuote)
+	}
+
+	// === Only the holder or insurer of the policy decides on quotes
+	policyAsBytes, err := stub.GetState(quoteRequest.VehicleInsurance)
 	if err != nil {
-		return shim.Error("Failed to get repair shop: " + err.Error())
-	} else if shopAsBytes == nil {
-		return shim.Error("Given repair shop doesn't exists: " + shopRef)
+		return nil, fmt.Errorf("Failed to get insurance policy: %s", err.Error())
+	} else if policyAsBytes == nil {
+		return nil, fmt.Errorf("Insurance policy of quote request doesn't exists: %s", quoteRequest.VehicleInsurance)
 	}
 
-	// === Calculate totals
-	var totalParts float32
-	var totalLabor float32
-	var totalRefinish float32
-	var totalEstimates float32
-	var total float32
-	for _, estimate := range estimates {
-		totalParts = totalParts + estimate.CostOfParts
-		totalLabor = totalLabor + estimate.CostOfLabor
-		totalRefinish = totalRefinish + estimate.CostOfRefinish
-		totalEstimates = total + estimate.TotalCost
+	insurancePolicy := &InsurancePolicy{}
+	if err = json.Unmarshal(policyAsBytes, insurancePolicy); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal insurance policy: %s", err.Error())
 	}
-	total = totalEstimates * float32(tax/100+1)
 
-	// === Create new RepairQuote object
-	quoteObjClass := "vehiclerepair.RepairQuote"
-	//quoteID, err := strconv.ParseInt("1000000001", 10, 64) //static id for testing
-	quoteID := time.Now().Unix()
-	repairQuote := &RepairQuote{quoteObjClass, strconv.FormatInt(quoteID, 10), requestRef, shopRef, estimates, totalParts, totalLabor, totalRefinish, float32(tax), total}
+	if !caller.isPolicyParty(insurancePolicy) {
+		return nil, fmt.Errorf("Only the holder or insurer of the policy may decide on quotes for %s", requestRef)
+	}
 
-	// === Marshal the quote request
+	return quoteRequest, nil
+}
+
+// saveQuoteUpdate - Store an updated repair quote into state and emit QuoteUpdate event
+func (t *InsuranceChaincode) saveQuoteUpdate(stub shim.ChaincodeStubInterface, requestID string, repairQuote *RepairQuote, reason string) pb.Response {
+	// === Marshal the updated repair quote
 	quoteJSONasBytes, err := json.Marshal(repairQuote)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// === Save request to state
-	quoteRef := fmt.Sprintf("%s#%d", quoteObjClass, quoteID)
+	// === Save repair quote to state
+	quoteRef := fmt.Sprintf("%s#%s", repairQuote.Class, repairQuote.QuoteID)
 	err = stub.PutState(quoteRef, quoteJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// === Emit NewQuoteOffer event
-	newQuoteOffer := &NewQuoteOfferEvent{requestID, strconv.FormatInt(quoteID, 10), totalEstimates}
-	eventJSONasBytes, err := json.Marshal(newQuoteOffer)
+	// === Emit QuoteUpdate event
+	quoteUpdate := &QuoteUpdateEvent{requestID, repairQuote.QuoteID, repairQuote.Status, reason}
+	eventJSONasBytes, err := json.Marshal(quoteUpdate)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
-	stub.SetEvent("NewQuoteOfferEvent", eventJSONasBytes)
+	stub.SetEvent("QuoteUpdateEvent", eventJSONasBytes)
 
-	fmt.Println("- Offer quote for repairs successfully created")
+	fmt.Println("- Repair quote successfully " + strings.ToLower(repairQuote.Status))
 	return shim.Success(eventJSONasBytes)
 }
 
 // issuePolicy - Create a new insurance policy
-func (t *InsuranceChaincode) issuePolicy(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (t *InsuranceChaincode) issuePolicy(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	var err error
 
-	// simple data model arguments
+	// simple data model arguments, the issuing insurer is the caller
 	// authorisedBy|validFrom|validTo|registeredVehicle|
-	// countryCode|insurerCode|policyNumber|vehicleCategory|vehicleMake|coverage|policyHolder|issuedBy
+	// countryCode|insurerCode|policyNumber|vehicleCategory|vehicleMake|territory|policyHolder|json{coverages[]}|currency
 	//
 	// State of New York|2018-08-01T00:00:00.000Z|2020-08-01T00:00:00.000Z|JN6ND01S3GX194659
-	// USA|AX203|3459802|AF|BMW|US,CA,MX|908123764|AXA Insurance
+	// USA|AX203|3459802|AF|BMW|US,CA,MX|908123764
+	// [{"type":"THIRD_PARTY_LIABILITY","perEventLimit":1000000},{"type":"COLLISION","deductible":500,"perEventLimit":50000}]|USD
 
-	if len(args) != 12 {
-		return shim.Error("Incorrect number of arguments. Expecting exactly 12")
+	if len(args) < 12 || len(args) > 13 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 12 and maximum of 13")
 	}
 
 	// === Check input variables ===
@@ -770,9 +2076,26 @@ func (t *InsuranceChaincode) issuePolicy(stub shim.ChaincodeStubInterface, args
 
 	vehicleCat := args[7]
 	vehicleMake := args[8]
-	coverage := strings.Split(args[9], ",")
+	territory, err := parseTerritory(args[9])
+	if err != nil {
+		return shim.Error("10th argument must be a comma separated list of covered countries: " + err.Error())
+	}
 	policyHolder := args[10]
-	issuedBy := args[11]
+	insurerRef := caller.ParticipantRef
+
+	currency := defaultCurrency
+	if len(args) > 12 && len(args[12]) > 0 {
+		currency = strings.ToUpper(args[12])
+		if _, err = currencyExponent(currency); err != nil {
+			return shim.Error("13th argument must be a supported ISO 4217 currency code")
+		}
+	}
+
+	// === Unmarshal coverages array and check deductibles and limits
+	coverage, err := parseCoverages([]byte(args[11]), currency)
+	if err != nil {
+		return shim.Error("Failed to unmarshal coverage array: " + err.Error())
+	}
 
 	// === Check if vehicle exists
 	vehicleRef := fmt.Sprintf("%s#%s", "base.Vehicle", vehicleReg)
@@ -787,7 +2110,7 @@ func (t *InsuranceChaincode) issuePolicy(stub shim.ChaincodeStubInterface, args
 	var vehicle Vehicle
 	if err = json.Unmarshal(vehicleAsBytes, &vehicle); err != nil {
 		return shim.Error("Failed to unmarshal vehicle asset: " + err.Error())
-	}	
+	}
 
 	// === Check if policy holder exists
 	holderRef := fmt.Sprintf("%s#%s", "base.Registrant", policyHolder)
@@ -803,45 +2126,52 @@ func (t *InsuranceChaincode) issuePolicy(stub shim.ChaincodeStubInterface, args
 		return shim.Error("The vehicle is not owned by the newly assigned policy holder")
 	}
 
-	// === Check if insurer issueing policy exists
-	insurerRef := fmt.Sprintf("%s#%s", "base.Insurer", issuedBy)
-	insurerAsBytes, err := stub.GetState(insurerRef)
+	// === Check if policy already exists, reissuing would take it over and reset its terms, endorsements and payouts
+	policyObjClass := "insurance.InsurancePolicy"
+	policyID := fmt.Sprintf("%s-%s-%d", countryCode, insurerCode, policyNumber)
+	policyRef := fmt.Sprintf("%s#%s", policyObjClass, policyID)
+	existingAsBytes, err := stub.GetState(policyRef)
 	if err != nil {
-		return shim.Error("Failed to get insurer: " + err.Error())
-	} else if insurerAsBytes == nil {
-		return shim.Error("Given insurer doesn't exists: " + insurerRef)
+		return shim.Error("Failed to get insurance policy: " + err.Error())
+	} else if existingAsBytes != nil {
+		return shim.Error("This insurance policy already exists: " + policyRef)
 	}
 
 	// === Create policy object and marchal to JSON ===
-	policyObjClass := "insurance.InsurancePolicy"
-	policyID := fmt.Sprintf("%s-%s-%d", countryCode, insurerCode, policyNumber)
-	insurancePolicy := &InsurancePolicy{policyObjClass, policyID, authorisedBy, validFrom, validTo, vehicleRef, countryCode, insurerCode, policyNumber, vehicleCat, vehicleMake, coverage, holderRef, insurerRef}
+	insurancePolicy := &InsurancePolicy{policyObjClass, policyID, authorisedBy, validFrom, validTo, vehicleRef, countryCode, insurerCode, policyNumber, vehicleCat, vehicleMake, coverage, holderRef, insurerRef, false, territory, policyActive, 1, "", "", nil, "", nil}
 	policyJSONasBytes, err := json.Marshal(insurancePolicy)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	// === Save insurance policy to state ===
-	policyRef := fmt.Sprintf("%s#%s", policyObjClass, policyID)
 	err = stub.PutState(policyRef, policyJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, policyObjClass, policyID, policyJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
 	fmt.Println("- Insurance policy successfully issued")
 	return shim.Success(policyJSONasBytes)
 }
 
 // sendClaim - Send a new insurance claim to defendant
-func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+//
+// The claim is scored on fraud signals first. Claims scoring at least the review threshold are saved as well, but emit a
+// SuspiciousClaimEvent for the special investigation unit instead of the NewClaimEvent.
+func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	var err error
 
 	// simple data model arguments
-	// 0=accidentId  1=claimantPolicyId  2=defendantPolicyId  3=repairQuoteId
-	// 1534180781    USA-AX203-3459802   USA-AS204-1042919    1000000001
+	// 0=accidentId  1=claimantPolicyId  2=defendantPolicyId  3=repairQuoteId  4=coverageType
+	// 1534180781    USA-AX203-3459802   USA-AS204-1042919    1000000001       THIRD_PARTY_LIABILITY
 
-	if len(args) != 4 {
-		return shim.Error("Incorrect number of arguments. Expecting exactly 4")
+	if len(args) < 4 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 4 and maximum of 5")
 	}
 
 	// === Check input variables ===
@@ -863,6 +2193,14 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 	defendantPolicyID := args[2]
 	repairQuoteID := args[3]
 
+	coverageType := defaultCoverageType
+	if len(args) > 4 && len(args[4]) > 0 {
+		coverageType = strings.ToUpper(args[4])
+		if !isCoverageType(coverageType) {
+			return shim.Error("5th argument must be one of " + strings.Join(coverageTypes, ", "))
+		}
+	}
+
 	// === Check if AccidentReport asset exists
 	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
 	reportAsBytes, err := stub.GetState(accidentRef)
@@ -874,7 +2212,7 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 
 	// === Unmarshal the report to an object
 	accidentReport := AccidentReport{}
-	if err = json.Unmarshal(reportAsBytes, accidentReport); err != nil {
+	if err = json.Unmarshal(reportAsBytes, &accidentReport); err != nil {
 		return shim.Error("Failed to unmarshal accident report: " + err.Error())
 	}
 
@@ -889,10 +2227,15 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 
 	// === Unmarshal the policy to an object
 	claimantPolicy := InsurancePolicy{}
-	if err = json.Unmarshal(claimantAsBytes, claimantPolicy); err != nil {
+	if err = json.Unmarshal(claimantAsBytes, &claimantPolicy); err != nil {
 		return shim.Error("Failed to unmarshal insurance policy of claimaint: " + err.Error())
 	}
 
+	// === Only the holder or insurer of the claimant policy can send the claim
+	if !caller.isPolicyParty(&claimantPolicy) {
+		return shim.Error("Only the holder or insurer of the claimant policy may send the claim: " + claimantRef)
+	}
+
 	// === Check if InsurancePolicy asset of defantdant exists
 	defendantRef := fmt.Sprintf("%s#%s", "insurance.InsurancePolicy", defendantPolicyID)
 	defendantAsBytes, err := stub.GetState(defendantRef)
@@ -904,10 +2247,14 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 
 	// === Unmarshal the policy to an object
 	defendantPolicy := InsurancePolicy{}
-	if err = json.Unmarshal(defendantAsBytes, defendantPolicy); err != nil {
+	if err = json.Unmarshal(defendantAsBytes, &defendantPolicy); err != nil {
 		return shim.Error("Failed to unmarshal insurance policy of defendant: " + err.Error())
 	}
 
+	// === Use the policies as they were at the time of the accident, later endorsements don't apply
+	claimantPolicy = claimantPolicy.asOf(accidentReport.OccuredAt)
+	defendantPolicy = defendantPolicy.asOf(accidentReport.OccuredAt)
+
 	// === Check if claimant and defendant are involved in accident
 	vehicles := accidentReport.InvolvedGoods.Vehicles
 
@@ -919,14 +2266,27 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 
 	// Check if registered vehicle of claimant is involved in accident
 	vehicleClaimantRef := claimantPolicy.RegisteredVehicle
-	if _, ok := vmap[vehicleClaimantRef]; ok {
+	if _, ok := vmap[vehicleClaimantRef]; !ok {
 		return shim.Error("Insured vehicle of claimant is not involved in accident: " + vehicleClaimantRef)
 	}
 
 	// Check if registered vehicle of defendant is involved in accident
 	vehicleDefendantRef := defendantPolicy.RegisteredVehicle
-	if _, ok := vmap[vehicleDefendantRef]; ok {
-		return shim.Error("Insured vehicle of claimant is not involved in accident: " + vehicleDefendantRef)
+	if _, ok := vmap[vehicleDefendantRef]; !ok {
+		return shim.Error("Insured vehicle of defendant is not involved in accident: " + vehicleDefendantRef)
+	}
+
+	// === Check if the policies of claimant and defendant cover the time and place of the accident
+	if err = checkPolicyCoverage(&claimantPolicy, &accidentReport); err != nil {
+		return shim.Error("Claimant: " + err.Error())
+	}
+	if err = checkPolicyCoverage(&defendantPolicy, &accidentReport); err != nil {
+		return shim.Error("Defendant: " + err.Error())
+	}
+
+	// === Check if the policy of the defendant has the coverage paying the claim
+	if _, err = findCoverage(&defendantPolicy, coverageType); err != nil {
+		return shim.Error("Defendant: " + err.Error())
 	}
 
 	// === Check if RepairQuote asset exists
@@ -940,30 +2300,92 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 
 	// === Unmarshal the quote to an object
 	repairQuote := RepairQuote{}
-	if err = json.Unmarshal(quoteAsBytes, repairQuote); err != nil {
+	if err = json.Unmarshal(quoteAsBytes, &repairQuote); err != nil {
 		return shim.Error("Failed to unmarshal repair quote: " + err.Error())
 	}
 
+	// === Check if the repair quote is awarded for the claimant's damage
+	requestAsBytes, err := stub.GetState(repairQuote.QuoteRequest)
+	if err != nil {
+		return shim.Error("Failed to get quote request: " + err.Error())
+	} else if requestAsBytes == nil {
+		return shim.Error("Quote request of repair quote doesn't exists: " + repairQuote.QuoteRequest)
+	}
+
+	quoteRequest := QuoteRequest{}
+	if err = json.Unmarshal(requestAsBytes, &quoteRequest); err != nil {
+		return shim.Error("Failed to unmarshal quote request: " + err.Error())
+	}
+
+	if quoteRequest.AwardedQuote != quoteRef {
+		return shim.Error("Given repair quote isn't awarded for its quote request: " + quoteRef)
+	}
+	if quoteRequest.AccidentReport != accidentRef || quoteRequest.VehicleInsurance != claimantRef {
+		return shim.Error("Given repair quote wasn't requested for this accident and claimant: " + quoteRef)
+	}
+
+	// === Score fraud signals, suspicious claims are saved but flagged for review
+	fraud, err := assessClaimFraud(stub, &accidentReport, &claimantPolicy, &quoteRequest, &repairQuote)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
 	// === Create claim object and marchal to JSON ===
+	liability := &LiabilityConcept{"insurance.Liability", liabilityPending, "", 0, 0, "", nil, nil, nil, nil, ""}
 	claimObjClass := "insurance.InsuranceClaim"
-	//claimID, err := strconv.ParseInt("1000000001", 10, 64) //static id for testing
-	claimID := time.Now().Unix()
-	dateOfClaim := time.Now()
-	insuranceClaim := &InsuranceClaim{claimObjClass, strconv.FormatInt(claimID, 10), dateOfClaim, "NEW", accidentRef, claimantRef, defendantRef, quoteRef}
+	claimID, err := newAssetID(stub, claimObjClass, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	dateOfClaim, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	insuranceClaim := &InsuranceClaim{claimObjClass, claimID, dateOfClaim, "NEW", accidentRef, claimantRef, defendantRef, quoteRef, "", "", coverageType, nil, liability, repairQuote.RepairOrder, fraud}
 	claimJSONasBytes, err := json.Marshal(insuranceClaim)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
 	// === Save insurance claim to state ===
-	claimRef := fmt.Sprintf("%s#%d", claimObjClass, claimID)
+	claimRef := fmt.Sprintf("%s#%s", claimObjClass, claimID)
 	err = stub.PutState(claimRef, claimJSONasBytes)
 	if err != nil {
 		return shim.Error(err.Error())
 	}
 
-	// === Emit NewQuoteOffer event
-	newClaim := &NewClaimEvent{strconv.FormatInt(claimID, 10), claimantPolicyID, defendantPolicyID, repairQuote.Total}
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, claimObjClass, claimID, claimJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Link the repair order of the quote, orders invoiced before the claim was sent aren't linked yet
+	if repairQuote.RepairOrder != "" {
+		if err = linkRepairOrderClaim(stub, repairQuote.RepairOrder, claimRef); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// === Emit SuspiciousClaim event for review, it is sent instead of the NewClaim event as only one event is kept per
+	// transaction, so it carries the NewClaim fields too
+	if fraud.Suspicious {
+		ruleCodes := []string{}
+		for _, rule := range fraud.Rules {
+			ruleCodes = append(ruleCodes, rule.Code)
+		}
+		suspiciousClaim := &SuspiciousClaimEvent{claimID, claimantPolicyID, defendantPolicyID, repairQuote.Total, fraud.Score, ruleCodes}
+		eventJSONasBytes, err := json.Marshal(suspiciousClaim)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		stub.SetEvent("SuspiciousClaimEvent", eventJSONasBytes)
+
+		fmt.Println("- Insurance claim send to defendant and flagged for review")
+		return shim.Success(eventJSONasBytes)
+	}
+
+	// === Emit NewClaim event
+	newClaim := &NewClaimEvent{claimID, claimantPolicyID, defendantPolicyID, repairQuote.Total}
 	eventJSONasBytes, err := json.Marshal(newClaim)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -974,8 +2396,233 @@ func (t *InsuranceChaincode) sendClaim(stub shim.ChaincodeStubInterface, args []
 	return shim.Success(eventJSONasBytes)
 }
 
+// acceptClaim - Accept an insurance claim by the insurer of the defendant
+func (t *InsuranceChaincode) acceptClaim(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer is the caller
+	// 0=claimId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	claimID := args[0]
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, claimID, caller.ParticipantRef, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAllowedTransition(claimTransitions, insuranceClaim.Status, "ACCEPTED") {
+		return shim.Error(fmt.Sprintf("Insurance claim can't move from %s to %s", insuranceClaim.Status, "ACCEPTED"))
+	}
+	if insuranceClaim.Liability != nil && insuranceClaim.Liability.Status != liabilityAgreed {
+		return shim.Error("Liability of the claim isn't agreed, it is " + insuranceClaim.Liability.Status)
+	}
+
+	// === Calculate the payout and add it to the paid total of the coverage
+	payout, insurancePolicy, err := t.payoutForClaim(stub, insuranceClaim)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	coverage, err := paidCoverage(insurancePolicy, payout.CoverageType)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if coverage.PaidTotal, err = coverage.PaidTotal.Add(payout.PayoutAmount); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save insurance policy to state ===
+	policyJSONasBytes, err := json.Marshal(insurancePolicy)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(insuranceClaim.Defendant, policyJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insuranceClaim.Payout = payout
+	reason := fmt.Sprintf("Claim accepted by %s, payout %s", caller.ParticipantID, payout.PayoutAmount)
+	return t.updateClaimStatus(stub, insuranceClaim, "ACCEPTED", reason)
+}
+
+// declineClaim - Decline an insurance claim by the insurer of the defendant
+func (t *InsuranceChaincode) declineClaim(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer is the caller
+	// 0=claimId     1=reasonCode  2=remarks
+	// 1534180781    NOT_LIABLE    Claimant drove through a red light
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	claimID := args[0]
+	reasonCode := strings.ToUpper(args[1])
+	remarks := args[2]
+
+	// === Check if reason code is known
+	validReason := false
+	for _, declineReason := range claimDeclineReasons {
+		if declineReason == reasonCode {
+			validReason = true
+			break
+		}
+	}
+	if !validReason {
+		return shim.Error("2nd argument must be one of " + strings.Join(claimDeclineReasons, ", "))
+	}
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, claimID, caller.ParticipantRef, false)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	insuranceClaim.DeclineReason = reasonCode
+	insuranceClaim.DeclineRemarks = remarks
+	return t.updateClaimStatus(stub, insuranceClaim, "DECLINED", reasonCode)
+}
+
+// resolveClaim - Resolve an accepted insurance claim by the insurer of the claimant or defendant
+func (t *InsuranceChaincode) resolveClaim(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer is the caller
+	// 0=claimId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	claimID := args[0]
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, claimID, caller.ParticipantRef, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	reason := fmt.Sprintf("Claim resolved by %s", caller.ParticipantID)
+	response := t.updateClaimStatus(stub, insuranceClaim, "RESOLVED", reason)
+	if response.Status != shim.OK {
+		return response
+	}
+
+	// === Record the amount owed between the insurers for the next netting run
+	if err = recordSettlement(stub, insuranceClaim); err != nil {
+		return shim.Error(err.Error())
+	}
+	return response
+}
+
+// getClaimForInsurer - Get a claim and check the insurer issued the defendant (or, if allowed, the claimant) policy
+func (t *InsuranceChaincode) getClaimForInsurer(stub shim.ChaincodeStubInterface, claimID string, insurerRef string, allowClaimant bool) (*InsuranceClaim, error) {
+	// === Check if InsuranceClaim asset exists
+	claimRef := fmt.Sprintf("%s#%s", "insurance.InsuranceClaim", claimID)
+	claimAsBytes, err := stub.GetState(claimRef)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get insurance claim: %s", err.Error())
+	} else if claimAsBytes == nil {
+		return nil, fmt.Errorf("This insurance claim doesn't exists: %s", claimRef)
+	}
+
+	// === Unmarshal the claim to an object
+	insuranceClaim := &InsuranceClaim{}
+	if err = json.Unmarshal(claimAsBytes, insuranceClaim); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal insurance claim: %s", err.Error())
+	}
+
+	// === Check if the insurer issued the policy of the defendant
+	policyRefs := []string{insuranceClaim.Defendant}
+	if allowClaimant {
+		policyRefs = append(policyRefs, insuranceClaim.Claimant)
+	}
+
+	for _, policyRef := range policyRefs {
+		policyAsBytes, err := stub.GetState(policyRef)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get insurance policy: %s", err.Error())
+		} else if policyAsBytes == nil {
+			return nil, fmt.Errorf("Insurance policy of claim doesn't exists: %s", policyRef)
+		}
+
+		insurancePolicy := InsurancePolicy{}
+		if err = json.Unmarshal(policyAsBytes, &insurancePolicy); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal insurance policy: %s", err.Error())
+		}
+
+		if insurancePolicy.IssuedBy == insurerRef {
+			return insuranceClaim, nil
+		}
+	}
+
+	if allowClaimant {
+		return nil, fmt.Errorf("Only the insurer of the claimant or defendant may update the claim: %s", insurerRef)
+	}
+	return nil, fmt.Errorf("Only the insurer of the defendant may update the claim: %s", insurerRef)
+}
+
+// updateClaimStatus - Move a claim to a new status, store into state and emit ClaimUpdate event
+func (t *InsuranceChaincode) updateClaimStatus(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim, status string, reason string) pb.Response {
+	// === Check if status transition is allowed
+	if !isAllowedTransition(claimTransitions, insuranceClaim.Status, status) {
+		return shim.Error(fmt.Sprintf("Insurance claim can't move from %s to %s", insuranceClaim.Status, status))
+	}
+	insuranceClaim.Status = status
+
+	// === Marshal the updated claim
+	claimJSONasBytes, err := json.Marshal(insuranceClaim)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save insurance claim to state ===
+	claimRef := fmt.Sprintf("%s#%s", insuranceClaim.Class, insuranceClaim.ClaimID)
+	err = stub.PutState(claimRef, claimJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit ClaimUpdate event ===
+	claimUpdate := &ClaimUpdateEvent{insuranceClaim.ClaimID, status, reason}
+	eventJSONasBytes, err := json.Marshal(claimUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("ClaimUpdateEvent", eventJSONasBytes)
+
+	fmt.Println("- Insurance claim successfully " + strings.ToLower(status))
+	return shim.Success(eventJSONasBytes)
+}
+
+// isAllowedTransition - Check a status transition against a transition table
+func isAllowedTransition(transitions map[string][]string, from string, to string) bool {
+	for _, nextStatus := range transitions[from] {
+		if nextStatus == to {
+			return true
+		}
+	}
+	return false
+}
+
 // readAssetData - Get a accident report from chaincode state
-func (t *InsuranceChaincode) readAssetData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (t *InsuranceChaincode) readAssetData(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	var assetClass, assetID, assetRef, assetType, jsonResp string
 	var err error
 
@@ -997,11 +2644,24 @@ func (t *InsuranceChaincode) readAssetData(stub shim.ChaincodeStubInterface, arg
 		return shim.Error(jsonResp)
 	}
 
+	// === Personal data of registrants and medical data of involved persons is only returned to members of the collection
+	if assetClass == "base.Registrant" {
+		valAsbytes, err = withRegistrantPersonalData(stub, valAsbytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	} else if assetClass == "accident.AccidentReport" {
+		valAsbytes, err = withMedicalData(stub, caller, valAsbytes)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
 	return shim.Success(valAsbytes)
 }
 
 // setupAssets - Create all example assets
-func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
 	// Setup has no arguments, just run the transactions
 
 	var err error
@@ -1016,9 +2676,14 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	vehicleObjClass := "base.Vehicle"
 	policyObjClass := "insurance.InsurancePolicy"
 
-	// === Create registrant - AutoLease
+	// === Create registrant - AutoLease, personal data goes to the private collection with the transaction ID as demo salt
 	address = AddressConcept{addressObjClass, "4300 Broadway", "New York, NY 10033", "United States"}
-	registrantAl := &Registrant{registrantObjClass, "908123764", "LEASER", "AutoLease", "", address}
+	personalAl := &RegistrantPersonalData{"base.RegistrantPersonalData", "908123764", "AutoLease", "", address, stub.GetTxID() + "-908123764"}
+	personalAlHash, err := putRegistrantPersonalData(stub, personalAl)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	registrantAl := &Registrant{registrantObjClass, "908123764", "LEASER", "", "", nil, personalAlHash, nil}
 	regAlJSONasBytes, err := json.Marshal(registrantAl)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1026,7 +2691,12 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 
 	// === Create registrant - John Smith
 	address = AddressConcept{addressObjClass, "28 Clinton Ave", "Jersey City, NJ 07304", "United States"}
-	registrantJS := &Registrant{registrantObjClass, "170632064", "INDIVIDUAL", "Smith", "J.", address}
+	personalJS := &RegistrantPersonalData{"base.RegistrantPersonalData", "170632064", "Smith", "J.", address, stub.GetTxID() + "-170632064"}
+	personalJSHash, err := putRegistrantPersonalData(stub, personalJS)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	registrantJS := &Registrant{registrantObjClass, "170632064", "INDIVIDUAL", "", "", nil, personalJSHash, nil}
 	regJsJSONasBytes, err := json.Marshal(registrantJS)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1034,7 +2704,7 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 
 	// === Create emergency services - NYPD 34th Precinct
 	address = AddressConcept{addressObjClass, "4295 Broadway", "New York, NY 10033", "United States"}
-	location = LocationConcept{locationObjClass, 40.851498, -73.935389, "Police Station"}
+	location = LocationConcept{locationObjClass, -73.935389, 40.851498, "Police Station"}
 	ersNYPD := &EmergencyServices{ersObjClass, CompanyAbstract{"NYPD 34th Precinct", address}, location}
 	ersNYPDJSONasBytes, err := json.Marshal(ersNYPD)
 	if err != nil {
@@ -1061,7 +2731,8 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 
 	// === Create repairshop USA Automotice New York City
 	address = AddressConcept{addressObjClass, "225 Delancey St", "New York, NY 10002", "United States"}
-	shopNYC := &RepairShop{shopObjClass, CompanyAbstract{"USA Automotive NYC", address}, "", "nyc@usa-automotive.com"}
+	locationNYC := LocationConcept{locationObjClass, -73.984511, 40.718092, ""}
+	shopNYC := &RepairShop{shopObjClass, CompanyAbstract{"USA Automotive NYC", address}, "", "nyc@usa-automotive.com", &locationNYC, 25, nil}
 	shopNycJSONasBytes, err := json.Marshal(shopNYC)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1069,7 +2740,8 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 
 	// === Create repairshop USA Automotice Jersey City
 	address = AddressConcept{addressObjClass, "5 West Side Ave", "Jersey City, NJ 07305", "United States"}
-	shopJC := &RepairShop{shopObjClass, CompanyAbstract{"USA Automotive JC", address}, "", "jersey@usa-automotive.com"}
+	locationJC := LocationConcept{locationObjClass, -74.086972, 40.708954, ""}
+	shopJC := &RepairShop{shopObjClass, CompanyAbstract{"USA Automotive JC", address}, "", "jersey@usa-automotive.com", &locationJC, 25, nil}
 	shopJcJSONasBytes, err := json.Marshal(shopJC)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1078,7 +2750,7 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	// === Create vehicle JN6ND01S3GX194659
 	dateFirstAdmissionOne, err := time.Parse(time.RFC3339, "2018-01-12T00:00:00Z")
 	dateAscriptionOne, err := time.Parse(time.RFC3339, "2018-01-13T00:00:00Z")
-	vehicleOne := &Vehicle{vehicleObjClass, "JN6ND01S3GX194659", "WPD 9321", dateFirstAdmissionOne, dateAscriptionOne, "base.Registrant#9081237645", "BMW", "X5 Estate 3.0i", "Black", 2595, 5}
+	vehicleOne := &Vehicle{vehicleObjClass, "JN6ND01S3GX194659", "WPD 9321", dateFirstAdmissionOne, dateAscriptionOne, "base.Registrant#9081237645", "BMW", "X5 Estate 3.0i", "Black", 2595, 5, nil}
 	vOneJSONasBytes, err := json.Marshal(vehicleOne)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1087,7 +2759,7 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	// === Create vehicle 1HTZR0007JH586991
 	dateFirstAdmissionTwo, err := time.Parse(time.RFC3339, "2014-09-28T00:00:00Z")
 	dateAscriptionTwo, err := time.Parse(time.RFC3339, "2018-10-01T00:00:00Z")
-	vehicleTwo := &Vehicle{vehicleObjClass, "1HTZR0007JH586991", "B63-AGM", dateFirstAdmissionTwo, dateAscriptionTwo, "base.Registrant#170632064", "Toyota", "Prius", "Red", 1526, 4}
+	vehicleTwo := &Vehicle{vehicleObjClass, "1HTZR0007JH586991", "B63-AGM", dateFirstAdmissionTwo, dateAscriptionTwo, "base.Registrant#170632064", "Toyota", "Prius", "Red", 1526, 4, nil}
 	vTwoJSONasBytes, err := json.Marshal(vehicleTwo)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1096,7 +2768,11 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	// === Create insurance policy USA-AS204-1042919
 	dateValidFrom, err := time.Parse(time.RFC3339, "2018-05-01T00:00:00Z")
 	dateValidTo, err := time.Parse(time.RFC3339, "2020-04-30T00:00:00Z")
-	insurancePolicy := &InsurancePolicy{policyObjClass, "USA-AS204-1042919", "State of New Jersey", dateValidFrom, dateValidTo, "base.Vehicle#1HTZR0007JH586991", "USA", "AS204", 1042919, "AF", "Toyota", []string{"US", "CA"}, "base.Registrant#170632064", "base.Insurer#AXA Insurance"}
+	coverages := []CoverageConcept{
+		{"insurance.Coverage", "THIRD_PARTY_LIABILITY", Money{0, "USD"}, Money{100000000, "USD"}, Money{0, "USD"}, Money{0, "USD"}},
+		{"insurance.Coverage", "COLLISION", Money{50000, "USD"}, Money{5000000, "USD"}, Money{0, "USD"}, Money{0, "USD"}},
+	}
+	insurancePolicy := &InsurancePolicy{policyObjClass, "USA-AS204-1042919", "State of New Jersey", dateValidFrom, dateValidTo, "base.Vehicle#1HTZR0007JH586991", "USA", "AS204", 1042919, "AF", "Toyota", coverages, "base.Registrant#170632064", "base.Insurer#AXA Insurance", false, []string{"US", "CA"}, policyActive, 1, "", "", nil, "", nil}
 	pOneJSONasBytes, err := json.Marshal(insurancePolicy)
 	if err != nil {
 		return shim.Error(err.Error())
@@ -1133,6 +2809,9 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err = putAssetIndexes(stub, ersObjClass, ersNYPD.TradeName, ersNYPDJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
 	assetEntry = AssetEntry{ersObjClass, ersNYPD.TradeName}
 	assetList = append(assetList, assetEntry)
 
@@ -1160,6 +2839,9 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err = putAssetIndexes(stub, shopObjClass, shopNYC.TradeName, shopNycJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
 	assetEntry = AssetEntry{shopObjClass, shopNYC.TradeName}
 	assetList = append(assetList, assetEntry)
 
@@ -1169,6 +2851,9 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	if err = putAssetIndexes(stub, shopObjClass, shopJC.TradeName, shopJcJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
 	assetEntry = AssetEntry{shopObjClass, shopJC.TradeName}
 	assetList = append(assetList, assetEntry)
 
@@ -1196,9 +2881,23 @@ func (t *InsuranceChaincode) setupAssets(stub shim.ChaincodeStubInterface, args
 	if err != nil {
 		return shim.Error(err.Error())
 	}
+	err = putAssetIndexes(stub, policyObjClass, insurancePolicy.PolicyID, pOneJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
 	assetEntry = AssetEntry{policyObjClass, insurancePolicy.PolicyID}
 	assetList = append(assetList, assetEntry)
 
+	// Bind the example participants to the organisation running the setup
+	for _, entry := range assetList {
+		if participantClasses[entry.Class] {
+			err = bindParticipant(stub, entry.Class, entry.AssetID, caller.MSPID)
+			if err != nil {
+				return shim.Error(err.Error())
+			}
+		}
+	}
+
 	// Marshal AssetList
 	assetsJSONasBytes, err := json.Marshal(assetList)
 	if err != nil {
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// claimOccuredAt - time of the accident of the test claims
+var claimOccuredAt = time.Date(2018, 8, 15, 14, 30, 0, 0, time.UTC)
+
+// newClaimStub - Get a mock stub with an accident in New York between the vehicles of two policies,
+// and the accepted repair quote 1534180999 of 120.00 USD awarded for the damage of the claimant
+func newClaimStub(t *testing.T) (*InsuranceChaincode, *testStub) {
+	estimate := EstimateConcept{"vehiclerepair.Estimate", "REPAIR", "Scratch removal", Money{0, "USD"}, Money{12000, "USD"}, Money{0, "USD"}, Money{12000, "USD"}}
+	return newTestStub(t, map[string]interface{}{
+		"accident.AccidentReport#1534180781": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180781", OccuredAt: claimOccuredAt, Status: "NEW",
+			Location:      LocationConcept{"accident.Location", -73.936206, 40.849496, "Washington Heights"},
+			InvolvedGoods: GoodsConcept{"accident.Goods", []string{"base.Vehicle#JN6ND01S3GX194659", "base.Vehicle#1HTZR0007JH586991"}}},
+		"insurance.InsurancePolicy#USA-AX203-3459802": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AX203-3459802", ValidFrom: policyValidFrom, ValidTo: policyValidTo,
+			RegisteredVehicle: "base.Vehicle#JN6ND01S3GX194659", Coverage: policyCoverage, PolicyHolder: "base.Registrant#170632063", IssuedBy: "base.Insurer#Allsecur Insurance",
+			Territory: []string{"US"}, Status: policyActive, Term: 1},
+		"insurance.InsurancePolicy#USA-AS204-1042919": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AS204-1042919", ValidFrom: policyValidFrom, ValidTo: policyValidTo,
+			RegisteredVehicle: "base.Vehicle#1HTZR0007JH586991", Coverage: policyCoverage, PolicyHolder: "base.Registrant#170632064", IssuedBy: "base.Insurer#AXA Insurance",
+			Territory: []string{"US"}, Status: policyActive, Term: 1},
+		"base.Vehicle#JN6ND01S3GX194659": &Vehicle{Class: "base.Vehicle", RegistrationNumber: "JN6ND01S3GX194659", Owner: "base.Registrant#170632063", Make: "Nissan", Model: "Rogue"},
+		"base.Vehicle#1HTZR0007JH586991": &Vehicle{Class: "base.Vehicle", RegistrationNumber: "1HTZR0007JH586991", Owner: "base.Registrant#170632064", Make: "Ford", Model: "F-150"},
+		"vehiclerepair.QuoteRequest#1534180900": &QuoteRequest{Class: "vehiclerepair.QuoteRequest", RequestID: "1534180900", AccidentReport: "accident.AccidentReport#1534180781",
+			VehicleInsurance: "insurance.InsurancePolicy#USA-AX203-3459802", DamageDescription: "Scratched rear bumper", AwardedQuote: "vehiclerepair.RepairQuote#1534180999",
+			VehicleMake: "Nissan", VehicleModel: "Rogue"},
+		"vehiclerepair.RepairQuote#1534180999": &RepairQuote{Class: "vehiclerepair.RepairQuote", QuoteID: "1534180999", QuoteRequest: "vehiclerepair.QuoteRequest#1534180900",
+			Estimator: "base.RepairShop#Joe's Garage", Estimates: []EstimateConcept{estimate}, TotalParts: Money{0, "USD"}, TotalLabor: Money{12000, "USD"},
+			TotalRefinish: Money{0, "USD"}, TaxAmount: Money{0, "USD"}, Total: Money{12000, "USD"}, Status: "ACCEPTED"},
+	})
+}
+
+// sendTestClaim - Send the claim of the test accident by the claimant insurer and get its reference
+func sendTestClaim(t *testing.T, cc *InsuranceChaincode, stub *testStub) string {
+	response := stub.call(t, testTxTime, func() pb.Response {
+		return cc.sendClaim(stub, testCaller("base.Insurer#Allsecur Insurance"), []string{"1534180781", "USA-AX203-3459802", "USA-AS204-1042919", "1534180999"})
+	})
+	if response.Status != shim.OK {
+		t.Fatalf("sendClaim status = %d %s", response.Status, response.Message)
+	}
+
+	newClaim := NewClaimEvent{}
+	if err := json.Unmarshal(response.Payload, &newClaim); err != nil {
+		t.Fatal(err)
+	}
+	return "insurance.InsuranceClaim#" + newClaim.ClaimID
+}
+
+func TestSendClaim(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  string
+		args    []string
+		wantErr bool
+	}{
+		{"by claimant insurer", "base.Insurer#Allsecur Insurance", []string{"1534180781", "USA-AX203-3459802", "USA-AS204-1042919", "1534180999"}, false},
+		{"by claimant holder", "base.Registrant#170632063", []string{"1534180781", "USA-AX203-3459802", "USA-AS204-1042919", "1534180999", "collision"}, false},
+		{"by defendant insurer", "base.Insurer#AXA Insurance", []string{"1534180781", "USA-AX203-3459802", "USA-AS204-1042919", "1534180999"}, true},
+		{"quote requested for the defendant", "base.Insurer#AXA Insurance", []string{"1534180781", "USA-AS204-1042919", "USA-AX203-3459802", "1534180999"}, true},
+		{"unknown coverage type", "base.Insurer#Allsecur Insurance", []string{"1534180781", "USA-AX203-3459802", "USA-AS204-1042919", "1534180999", "HAIL"}, true},
+		{"unknown accident", "base.Insurer#Allsecur Insurance", []string{"1534180782", "USA-AX203-3459802", "USA-AS204-1042919", "1534180999"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newClaimStub(t)
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.sendClaim(stub, testCaller(test.caller), test.args)
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("sendClaim status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			newClaim := NewClaimEvent{}
+			if err := json.Unmarshal(response.Payload, &newClaim); err != nil {
+				t.Fatal(err)
+			}
+			insuranceClaim := InsuranceClaim{}
+			stub.get(t, "insurance.InsuranceClaim#"+newClaim.ClaimID, &insuranceClaim)
+			if insuranceClaim.Status != "NEW" || insuranceClaim.CostOfRepair != "vehiclerepair.RepairQuote#1534180999" || insuranceClaim.Liability == nil {
+				t.Errorf("claim = status %s, cost of repair %s, liability %v, want a NEW claim of the quote", insuranceClaim.Status, insuranceClaim.CostOfRepair, insuranceClaim.Liability)
+			}
+			if newClaim.CostOfRepair != (Money{12000, "USD"}) {
+				t.Errorf("cost of repair = %s, want 120.00 USD", newClaim.CostOfRepair)
+			}
+		})
+	}
+}
+
+func TestRejectQuote(t *testing.T) {
+	tests := []struct {
+		name        string
+		biddingMode string
+		caller      string
+		wantErr     bool
+	}{
+		{"open request by insurer", biddingOpen, "base.Insurer#Allsecur Insurance", false},
+		{"open request by holder", "", "base.Registrant#908123765", false},
+		{"open request by other insurer", biddingOpen, "base.Insurer#AXA Insurance", true},
+		{"sealed request", biddingSealed, "base.Insurer#Allsecur Insurance", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newSealedBidStub(t)
+			stub.put(t, map[string]interface{}{
+				"vehiclerepair.QuoteRequest#1534180781": &QuoteRequest{Class: "vehiclerepair.QuoteRequest", RequestID: "1534180781", VehicleInsurance: "insurance.InsurancePolicy#USA-AX203-3459802",
+					BiddingMode: test.biddingMode, BiddingClosesAt: &sealedBiddingCloses, RevealClosesAt: &sealedRevealCloses},
+				"vehiclerepair.RepairQuote#1534180999": &RepairQuote{Class: "vehiclerepair.RepairQuote", QuoteID: "1534180999", QuoteRequest: "vehiclerepair.QuoteRequest#1534180781",
+					Estimator: "base.RepairShop#USA Automotive NYC", Total: Money{11100, "USD"}, Status: "OFFERED"},
+			})
+
+			response := stub.call(t, sealedRevealCloses, func() pb.Response {
+				return cc.rejectQuote(stub, testCaller(test.caller), []string{"1534180781", "1534180999", "Too expensive"})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("rejectQuote status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+
+			repairQuote := RepairQuote{}
+			stub.get(t, "vehiclerepair.RepairQuote#1534180999", &repairQuote)
+			wantStatus := "REJECTED"
+			if test.wantErr {
+				wantStatus = "OFFERED"
+			}
+			if repairQuote.Status != wantStatus {
+				t.Errorf("quote status = %s, want %s", repairQuote.Status, wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Liability Definitions - Fault allocation between the insurers of a claim
+// ============================================================================================================================
+
+// Liability status values
+const (
+	liabilityPending  = "PENDING"
+	liabilityProposed = "PROPOSED"
+	liabilityAgreed   = "AGREED"
+	liabilityDisputed = "DISPUTED"
+)
+
+// Sides of a claim whose insurers sign the liability
+const (
+	claimantSide  = "CLAIMANT"
+	defendantSide = "DEFENDANT"
+)
+
+// liabilityScenarios - standard collision scenarios with the fault of the defendant in percent, OTHER needs an explicit fault
+var liabilityScenarios = map[string]Percentage{
+	"REAR_END":              100 * percentageScale, // defendant drove into the rear of the claimant
+	"PARKED_VEHICLE":        100 * percentageScale, // defendant hit the parked claimant
+	"RED_LIGHT":             100 * percentageScale, // defendant passed a red light
+	"RIGHT_OF_WAY":          100 * percentageScale, // defendant failed to give way
+	"LANE_CHANGE":           100 * percentageScale, // defendant changed lanes into the claimant
+	"REVERSING":             100 * percentageScale, // defendant reversed into the claimant
+	"OPENING_DOOR":          100 * percentageScale, // defendant opened a door into the traffic
+	"BOTH_LANE_CHANGE":      50 * percentageScale,  // both changed lanes at the same time
+	"BOTH_REVERSING":        50 * percentageScale,  // both reversed into each other
+	"CENTER_LINE":           50 * percentageScale,  // position on the road can't be established
+	"CLAIMANT_REAR_END":     0,                     // claimant drove into the rear of the defendant
+	"CLAIMANT_RIGHT_OF_WAY": 0,                     // claimant failed to give way
+	"OTHER":                 -1,
+}
+
+// claimInsurerSides - Get the sides of a claim the insurer issued the policy of, both if it insures both parties
+func claimInsurerSides(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim, insurerRef string) ([]string, error) {
+	var sides []string
+	for _, side := range []string{claimantSide, defendantSide} {
+		policyRef := insuranceClaim.Claimant
+		if side == defendantSide {
+			policyRef = insuranceClaim.Defendant
+		}
+
+		policyAsBytes, err := stub.GetState(policyRef)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get insurance policy: %s", err.Error())
+		} else if policyAsBytes == nil {
+			return nil, fmt.Errorf("Insurance policy of claim doesn't exists: %s", policyRef)
+		}
+
+		insurancePolicy := InsurancePolicy{}
+		if err = json.Unmarshal(policyAsBytes, &insurancePolicy); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal insurance policy: %s", err.Error())
+		}
+		if insurancePolicy.IssuedBy == insurerRef {
+			sides = append(sides, side)
+		}
+	}
+
+	if len(sides) == 0 {
+		return nil, fmt.Errorf("Only the insurer of the claimant or defendant may assess the liability: %s", insurerRef)
+	}
+	return sides, nil
+}
+
+// getClaimRepairTotal - Get the total of the repair quote of a claim
+func getClaimRepairTotal(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim) (Money, error) {
+	quoteAsBytes, err := stub.GetState(insuranceClaim.CostOfRepair)
+	if err != nil {
+		return Money{}, fmt.Errorf("Failed to get repair quote: %s", err.Error())
+	} else if quoteAsBytes == nil {
+		return Money{}, fmt.Errorf("Repair quote of claim doesn't exists: %s", insuranceClaim.CostOfRepair)
+	}
+
+	repairQuote := RepairQuote{}
+	if err = json.Unmarshal(quoteAsBytes, &repairQuote); err != nil {
+		return Money{}, fmt.Errorf("Failed to unmarshal repair quote: %s", err.Error())
+	}
+	return repairQuote.Total, nil
+}
+
+// signLiability - Add the signatures of the insurer's sides, the liability is agreed once both sides signed
+func signLiability(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim, sides []string) error {
+	liability := insuranceClaim.Liability
+	for _, side := range sides {
+		if !containsString(liability.SignedBy, side) {
+			liability.SignedBy = append(liability.SignedBy, side)
+		}
+	}
+	sort.Strings(liability.SignedBy)
+	if len(liability.SignedBy) < 2 {
+		return nil
+	}
+
+	repairTotal, err := getClaimRepairTotal(stub, insuranceClaim)
+	if err != nil {
+		return err
+	}
+	settlementAmount, err := repairTotal.Percent(liability.DefendantFault)
+	if err != nil {
+		return err
+	}
+	agreedAt, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	liability.Status = liabilityAgreed
+	liability.AgreedAt = &agreedAt
+	liability.SettlementAmount = &settlementAmount
+	return nil
+}
+
+// containsString - Check if a list contains a value
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// putClaim - Store an insurance claim into state
+func putClaim(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim) error {
+	claimJSONasBytes, err := json.Marshal(insuranceClaim)
+	if err != nil {
+		return err
+	}
+	claimRef := fmt.Sprintf("%s#%s", insuranceClaim.Class, insuranceClaim.ClaimID)
+	return stub.PutState(claimRef, claimJSONasBytes)
+}
+
+// proposeLiability - Propose the fault split of a claim, signed by the proposing insurer
+func (t *InsuranceChaincode) proposeLiability(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer of the claimant or defendant is the caller
+	// 0=claimId     1=scenarioCode  2=defendantFault (%)
+	// 1534180781    REAR_END        100
+
+	if len(args) < 2 || len(args) > 3 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 2 and maximum of 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	claimID := args[0]
+	scenarioCode := strings.ToUpper(args[1])
+	defendantFault, found := liabilityScenarios[scenarioCode]
+	if !found {
+		scenarioCodes := make([]string, 0, len(liabilityScenarios))
+		for code := range liabilityScenarios {
+			scenarioCodes = append(scenarioCodes, code)
+		}
+		sort.Strings(scenarioCodes)
+		return shim.Error("2nd argument must be one of " + strings.Join(scenarioCodes, ", "))
+	}
+
+	// === An explicit fault overrides the one of the scenario
+	if len(args) > 2 && len(args[2]) > 0 {
+		fault, err := ParsePercentage(args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a decimal string with at most 4 decimals")
+		} else if fault < 0 || fault > 100*percentageScale {
+			return shim.Error("3rd argument must be between 0 and 100")
+		}
+		defendantFault = fault
+	} else if defendantFault < 0 {
+		return shim.Error("3rd argument is required for scenario " + scenarioCode)
+	}
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, claimID, caller.ParticipantRef, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sides, err := claimInsurerSides(stub, insuranceClaim, caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Liability can only be proposed on open claims which aren't agreed yet
+	if insuranceClaim.Status != "NEW" && insuranceClaim.Status != "DISPUTED" {
+		return shim.Error("Liability can't be proposed for a claim with status " + insuranceClaim.Status)
+	}
+	if insuranceClaim.Liability == nil {
+		insuranceClaim.Liability = &LiabilityConcept{"insurance.Liability", liabilityPending, "", 0, 0, "", nil, nil, nil, nil, ""}
+	} else if insuranceClaim.Liability.Status == liabilityAgreed {
+		return shim.Error("Liability of the claim is already agreed")
+	}
+
+	// === A new proposal replaces the previous one and its signatures
+	proposedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	liability := insuranceClaim.Liability
+	liability.Status = liabilityProposed
+	liability.ScenarioCode = scenarioCode
+	liability.DefendantFault = defendantFault
+	liability.Round++
+	liability.ProposedBy = caller.ParticipantRef
+	liability.ProposedAt = &proposedAt
+	liability.SignedBy = nil
+	if err = signLiability(stub, insuranceClaim, sides); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if err = putClaim(stub, insuranceClaim); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit LiabilityAgreed event if the insurer insures both sides, LiabilityProposed event otherwise
+	if liability.Status == liabilityAgreed {
+		return emitLiabilityAgreed(stub, insuranceClaim)
+	}
+	liabilityProposed := &LiabilityProposedEvent{claimID, scenarioCode, defendantFault, caller.ParticipantRef, liability.Round}
+	eventJSONasBytes, err := json.Marshal(liabilityProposed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("LiabilityProposedEvent", eventJSONasBytes)
+
+	fmt.Println("- Liability successfully proposed")
+	return shim.Success(eventJSONasBytes)
+}
+
+// agreeLiability - Sign the proposed fault split of a claim by the insurer of the other side
+func (t *InsuranceChaincode) agreeLiability(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer of the claimant or defendant is the caller
+	// 0=claimId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, args[0], caller.ParticipantRef, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	sides, err := claimInsurerSides(stub, insuranceClaim, caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check there is an unsigned proposal for the insurer
+	if insuranceClaim.Liability == nil || insuranceClaim.Liability.Status != liabilityProposed {
+		return shim.Error("There is no liability proposal to agree for this claim")
+	}
+	unsigned := false
+	for _, side := range sides {
+		if !containsString(insuranceClaim.Liability.SignedBy, side) {
+			unsigned = true
+		}
+	}
+	if !unsigned {
+		return shim.Error("The liability proposal is already signed by " + caller.ParticipantRef)
+	}
+
+	if err = signLiability(stub, insuranceClaim, sides); err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = putClaim(stub, insuranceClaim); err != nil {
+		return shim.Error(err.Error())
+	}
+	return emitLiabilityAgreed(stub, insuranceClaim)
+}
+
+// emitLiabilityAgreed - Emit LiabilityAgreed event for a claim
+func emitLiabilityAgreed(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim) pb.Response {
+	liability := insuranceClaim.Liability
+	liabilityAgreed := &LiabilityAgreedEvent{insuranceClaim.ClaimID, liability.ScenarioCode, liability.DefendantFault, *liability.SettlementAmount}
+	eventJSONasBytes, err := json.Marshal(liabilityAgreed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("LiabilityAgreedEvent", eventJSONasBytes)
+
+	fmt.Println("- Liability successfully agreed")
+	return shim.Success(eventJSONasBytes)
+}
+
+// disputeLiability - Escalate a disagreement on the liability of a claim into a dispute
+func (t *InsuranceChaincode) disputeLiability(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer of the claimant or defendant is the caller
+	// 0=claimId     1=reason
+	// 1534180781    Dashcam footage shows the claimant braked without reason
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	insuranceClaim, err := t.getClaimForInsurer(stub, args[0], caller.ParticipantRef, true)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if _, err = claimInsurerSides(stub, insuranceClaim, caller.ParticipantRef); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	if insuranceClaim.Liability == nil {
+		insuranceClaim.Liability = &LiabilityConcept{"insurance.Liability", liabilityPending, "", 0, 0, "", nil, nil, nil, nil, ""}
+	} else if insuranceClaim.Liability.Status == liabilityAgreed {
+		return shim.Error("Liability of the claim is already agreed")
+	}
+	insuranceClaim.Liability.Status = liabilityDisputed
+	insuranceClaim.Liability.DisputeReason = args[1]
+
+	return t.updateClaimStatus(stub, insuranceClaim, "DISPUTED", args[1])
+}
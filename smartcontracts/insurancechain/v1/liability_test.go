@@ -0,0 +1,119 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// newLiabilityStub - Get a mock stub with a new claim of 130.61 USD between policies of the given insurers
+func newLiabilityStub(t *testing.T, claimantInsurer string, defendantInsurer string) (*InsuranceChaincode, *testStub) {
+	return newTestStub(t, map[string]interface{}{
+		"insurance.InsurancePolicy#USA-AX203-3459802": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AX203-3459802", IssuedBy: "base.Insurer#" + claimantInsurer},
+		"insurance.InsurancePolicy#USA-AS204-1042919": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AS204-1042919", IssuedBy: "base.Insurer#" + defendantInsurer},
+		"vehiclerepair.RepairQuote#1534180999":        &RepairQuote{Class: "vehiclerepair.RepairQuote", QuoteID: "1534180999", Total: Money{13061, "USD"}},
+		"insurance.InsuranceClaim#1534181000": &InsuranceClaim{Class: "insurance.InsuranceClaim", ClaimID: "1534181000", Status: "NEW", Claimant: "insurance.InsurancePolicy#USA-AX203-3459802",
+			Defendant: "insurance.InsurancePolicy#USA-AS204-1042919", CostOfRepair: "vehiclerepair.RepairQuote#1534180999"},
+	})
+}
+
+func TestProposeLiability(t *testing.T) {
+	tests := []struct {
+		name             string
+		defendantInsurer string
+		insurer          string
+		args             []string
+		wantEvent        string
+		wantFault        Percentage
+		wantSignedBy     []string
+		wantErr          bool
+	}{
+		{"fault of scenario", "AXA Insurance", "AXA Insurance", []string{"1534181000", "rear_end"}, "LiabilityProposedEvent", 100 * percentageScale, []string{defendantSide}, false},
+		{"shared fault by claimant insurer", "AXA Insurance", "Allsecur Insurance", []string{"1534181000", "CENTER_LINE"}, "LiabilityProposedEvent", 50 * percentageScale, []string{claimantSide}, false},
+		{"explicit fault overrides scenario", "AXA Insurance", "AXA Insurance", []string{"1534181000", "REAR_END", "80"}, "LiabilityProposedEvent", 80 * percentageScale, []string{defendantSide}, false},
+		{"insurer of both sides agrees at once", "Allsecur Insurance", "Allsecur Insurance", []string{"1534181000", "OTHER", "33.3333"}, "LiabilityAgreedEvent", 333333, []string{claimantSide, defendantSide}, false},
+		{"OTHER without fault", "AXA Insurance", "AXA Insurance", []string{"1534181000", "OTHER"}, "", 0, nil, true},
+		{"unknown scenario", "AXA Insurance", "AXA Insurance", []string{"1534181000", "HAIL"}, "", 0, nil, true},
+		{"fault above 100", "AXA Insurance", "AXA Insurance", []string{"1534181000", "OTHER", "100.5"}, "", 0, nil, true},
+		{"insurer of neither side", "AXA Insurance", "State Farm", []string{"1534181000", "REAR_END"}, "", 0, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newLiabilityStub(t, "Allsecur Insurance", test.defendantInsurer)
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.proposeLiability(stub, testCaller("base.Insurer#"+test.insurer), test.args)
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("proposeLiability status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			if eventName, _ := stub.lastEvent(t); eventName != test.wantEvent {
+				t.Errorf("event = %s, want %s", eventName, test.wantEvent)
+			}
+			insuranceClaim := InsuranceClaim{}
+			stub.get(t, "insurance.InsuranceClaim#1534181000", &insuranceClaim)
+			liability := insuranceClaim.Liability
+			if liability.DefendantFault != test.wantFault || liability.Round != 1 || !reflect.DeepEqual(liability.SignedBy, test.wantSignedBy) {
+				t.Errorf("liability = fault %s round %d signed by %v, want %s round 1 signed by %v", liability.DefendantFault, liability.Round, liability.SignedBy, test.wantFault, test.wantSignedBy)
+			}
+		})
+	}
+}
+
+func TestLiabilityRounds(t *testing.T) {
+	cc, stub := newLiabilityStub(t, "Allsecur Insurance", "AXA Insurance")
+	claimantInsurer, defendantInsurer := testCaller("base.Insurer#Allsecur Insurance"), testCaller("base.Insurer#AXA Insurance")
+	steps := []struct {
+		name       string
+		caller     *Caller
+		function   func(shim.ChaincodeStubInterface, *Caller, []string) pb.Response
+		args       []string
+		wantErr    bool
+		wantStatus string // of the liability after the step
+		wantRound  int
+	}{
+		{"agree without proposal", claimantInsurer, cc.agreeLiability, []string{"1534181000"}, true, "", 0},
+		{"claimant insurer proposes", claimantInsurer, cc.proposeLiability, []string{"1534181000", "REAR_END"}, false, liabilityProposed, 1},
+		{"proposer can't agree", claimantInsurer, cc.agreeLiability, []string{"1534181000"}, true, liabilityProposed, 1},
+		{"defendant insurer disputes", defendantInsurer, cc.disputeLiability, []string{"1534181000", "Claimant braked without reason"}, false, liabilityDisputed, 1},
+		{"defendant insurer counters", defendantInsurer, cc.proposeLiability, []string{"1534181000", "OTHER", "50"}, false, liabilityProposed, 2},
+		{"claimant insurer agrees", claimantInsurer, cc.agreeLiability, []string{"1534181000"}, false, liabilityAgreed, 2},
+		{"agreed liability can't be proposed", claimantInsurer, cc.proposeLiability, []string{"1534181000", "REAR_END"}, true, liabilityAgreed, 2},
+		{"agreed liability can't be disputed", defendantInsurer, cc.disputeLiability, []string{"1534181000", "Changed our mind"}, true, liabilityAgreed, 2},
+	}
+
+	for _, step := range steps {
+		response := stub.call(t, testTxTime, func() pb.Response {
+			return step.function(stub, step.caller, step.args)
+		})
+		if (response.Status != shim.OK) != step.wantErr {
+			t.Fatalf("%s: status = %d %s, want error %t", step.name, response.Status, response.Message, step.wantErr)
+		}
+
+		insuranceClaim := InsuranceClaim{}
+		stub.get(t, "insurance.InsuranceClaim#1534181000", &insuranceClaim)
+		status, round := "", 0
+		if insuranceClaim.Liability != nil {
+			status, round = insuranceClaim.Liability.Status, insuranceClaim.Liability.Round
+		}
+		if status != step.wantStatus || round != step.wantRound {
+			t.Fatalf("%s: liability %s round %d, want %s round %d", step.name, status, round, step.wantStatus, step.wantRound)
+		}
+	}
+
+	// === Settlement is the repair total by the agreed fault, rounded half away from zero
+	insuranceClaim := InsuranceClaim{}
+	stub.get(t, "insurance.InsuranceClaim#1534181000", &insuranceClaim)
+	if settlement := insuranceClaim.Liability.SettlementAmount; settlement == nil || *settlement != (Money{6531, "USD"}) {
+		t.Errorf("settlement amount = %v, want 65.31 USD", settlement)
+	}
+	if !reflect.DeepEqual(insuranceClaim.Liability.SignedBy, []string{claimantSide, defendantSide}) {
+		t.Errorf("signed by %v, want both sides", insuranceClaim.Liability.SignedBy)
+	}
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// ============================================================================================================================
+// Money Definitions - Fixed-point monetary amounts
+// ============================================================================================================================
+
+// defaultCurrency - currency of amounts stored as plain JSON numbers before Money was introduced
+const defaultCurrency = "USD"
+
+// currencyExponents - ISO 4217 currency codes accepted by the chaincode and their number of minor unit digits
+var currencyExponents = map[string]int{
+	"AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2, "CZK": 2, "DKK": 2, "EUR": 2, "GBP": 2,
+	"HKD": 2, "INR": 2, "JPY": 0, "KRW": 0, "KWD": 3, "MXN": 2, "NOK": 2, "NZD": 2, "PLN": 2, "SEK": 2,
+	"SGD": 2, "USD": 2, "ZAR": 2,
+}
+
+// Money - amount in minor units (e.g. cents) of an ISO 4217 currency
+//
+// The zero value, e.g. an amount missing from a stored asset, is zero in any currency.
+type Money struct {
+	MinorUnits int64
+	Currency   string
+}
+
+// moneyJSON - JSON representation of Money, the amount is a decimal string to avoid floating point
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// currencyExponent - Get the number of minor unit digits of a currency
+func currencyExponent(currency string) (int, error) {
+	exponent, ok := currencyExponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("Unsupported ISO 4217 currency code: %s", currency)
+	}
+	return exponent, nil
+}
+
+// ParseMoney - Parse a decimal amount string in the given currency, more decimals than the currency has are rejected
+func ParseMoney(amount string, currency string) (Money, error) {
+	currency = strings.ToUpper(currency)
+	exponent, err := currencyExponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+
+	minorUnits, err := parseDecimal(amount, exponent, false)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{minorUnits, currency}, nil
+}
+
+// String - Format the amount with the number of decimals of its currency, e.g. "130.60 USD"
+func (m Money) String() string {
+	return m.Amount() + " " + m.Currency
+}
+
+// Amount - Format the amount as decimal string with the number of decimals of its currency
+func (m Money) Amount() string {
+	exponent, err := currencyExponent(m.Currency)
+	if err != nil {
+		exponent = 2
+	}
+	return formatDecimal(m.MinorUnits, exponent)
+}
+
+// IsZero - Check if the amount is zero
+func (m Money) IsZero() bool {
+	return m.MinorUnits == 0
+}
+
+// Add - Add an amount in the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if m == (Money{}) {
+		m.Currency = other.Currency
+	} else if other == (Money{}) {
+		other.Currency = m.Currency
+	}
+
+	if m.Currency != other.Currency {
+		return Money{}, fmt.Errorf("Can't add %s to %s", other.Currency, m.Currency)
+	}
+
+	sum := m.MinorUnits + other.MinorUnits
+	if (other.MinorUnits > 0 && sum < m.MinorUnits) || (other.MinorUnits < 0 && sum > m.MinorUnits) {
+		return Money{}, fmt.Errorf("Amount overflow adding %s to %s", other, m)
+	}
+	return Money{sum, m.Currency}, nil
+}
+
+// Sub - Subtract an amount in the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	return m.Add(Money{-other.MinorUnits, other.Currency})
+}
+
+// Percent - Get the given percentage of the amount, rounded half away from zero to whole minor units
+func (m Money) Percent(p Percentage) (Money, error) {
+	product := new(big.Int).Mul(big.NewInt(m.MinorUnits), big.NewInt(int64(p)))
+	divisor := big.NewInt(100 * percentageScale)
+
+	quotient, remainder := new(big.Int).QuoRem(product, divisor, new(big.Int))
+	remainder.Abs(remainder).Mul(remainder, big.NewInt(2))
+	if remainder.Cmp(divisor) >= 0 {
+		quotient.Add(quotient, big.NewInt(int64(product.Sign())))
+	}
+
+	if !quotient.IsInt64() {
+		return Money{}, fmt.Errorf("Amount overflow taking %s%% of %s", p, m)
+	}
+	return Money{quotient.Int64(), m.Currency}, nil
+}
+
+// MarshalJSON - Marshal to {"amount":"130.60","currency":"USD"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	if m.Currency == "" {
+		m.Currency = defaultCurrency
+	}
+	return json.Marshal(moneyJSON{m.Amount(), m.Currency})
+}
+
+// UnmarshalJSON - Unmarshal from the Money object, or from a plain JSON number in the default currency
+func (m *Money) UnmarshalJSON(data []byte) error {
+	money, err := parseMoneyJSON(data, defaultCurrency, true)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
+
+// parseMoneyJSON - Parse a Money object, or a plain JSON number in the given currency
+//
+// Plain numbers are written by chaincode versions which stored amounts as float32, set round to round these to whole
+// minor units. Amounts in a Money object must always be exact.
+func parseMoneyJSON(data []byte, currency string, round bool) (Money, error) {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" || trimmed == "null" {
+		return Money{0, currency}, nil
+	}
+
+	if !strings.HasPrefix(trimmed, "{") {
+		exponent, err := currencyExponent(currency)
+		if err != nil {
+			return Money{}, err
+		}
+		minorUnits, err := parseDecimal(trimmed, exponent, round)
+		if err != nil {
+			return Money{}, err
+		}
+		return Money{minorUnits, currency}, nil
+	}
+
+	var value moneyJSON
+	if err := json.Unmarshal(data, &value); err != nil {
+		return Money{}, err
+	}
+	if value.Currency == "" {
+		value.Currency = currency
+	}
+	return ParseMoney(value.Amount, value.Currency)
+}
+
+// ============================================================================================================================
+// Percentage Definitions - Fixed-point percentages
+// ============================================================================================================================
+
+// percentageScale - number of units of a Percentage per whole percent, i.e. 4 decimals
+const percentageScale = 10000
+
+// Percentage - percentage in 1/10000th of a percent, e.g. 8.875% is 88750
+type Percentage int64
+
+// ParsePercentage - Parse a decimal percentage string with up to 4 decimals
+func ParsePercentage(value string) (Percentage, error) {
+	units, err := parseDecimal(value, 4, false)
+	if err != nil {
+		return 0, err
+	}
+	return Percentage(units), nil
+}
+
+// String - Format the percentage without trailing zeros, e.g. "8.875"
+func (p Percentage) String() string {
+	formatted := formatDecimal(int64(p), 4)
+	formatted = strings.TrimRight(formatted, "0")
+	return strings.TrimSuffix(formatted, ".")
+}
+
+// MarshalJSON - Marshal to a plain JSON number
+func (p Percentage) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalJSON - Unmarshal from a JSON number or string, rounded to 4 decimals
+func (p *Percentage) UnmarshalJSON(data []byte) error {
+	trimmed := strings.Trim(strings.TrimSpace(string(data)), "\"")
+	if trimmed == "" || trimmed == "null" {
+		*p = 0
+		return nil
+	}
+
+	units, err := parseDecimal(trimmed, 4, true)
+	if err != nil {
+		return err
+	}
+	*p = Percentage(units)
+	return nil
+}
+
+// ============================================================================================================================
+// Decimal helpers
+// ============================================================================================================================
+
+// parseDecimal - Parse a decimal string into an integer scaled by 10^exponent, without using floating point
+//
+// Extra decimals are rounded half away from zero when round is set, otherwise they must be zero.
+func parseDecimal(value string, exponent int, round bool) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" || strings.Trim(value, "0123456789+-.eE") != "" {
+		return 0, fmt.Errorf("Invalid decimal amount: %s", value)
+	}
+
+	// === Exponent notation is accepted as written by encoding/json for large or small floats
+	rat, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("Invalid decimal amount: %s", value)
+	}
+
+	scaled := new(big.Rat).Mul(rat, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(exponent)), nil)))
+	if !scaled.IsInt() {
+		if !round {
+			return 0, fmt.Errorf("Amount %s has more than %d decimals", value, exponent)
+		}
+
+		numerator := new(big.Int).Set(scaled.Num())
+		denominator := scaled.Denom()
+		quotient, remainder := new(big.Int).QuoRem(numerator, denominator, new(big.Int))
+		remainder.Abs(remainder).Mul(remainder, big.NewInt(2))
+		if remainder.Cmp(denominator) >= 0 {
+			quotient.Add(quotient, big.NewInt(int64(numerator.Sign())))
+		}
+		scaled.SetInt(quotient)
+	}
+
+	if !scaled.Num().IsInt64() {
+		return 0, fmt.Errorf("Amount out of range: %s", value)
+	}
+	return scaled.Num().Int64(), nil
+}
+
+// formatDecimal - Format an integer scaled by 10^exponent as decimal string
+func formatDecimal(units int64, exponent int) string {
+	sign := ""
+	if units < 0 {
+		sign = "-"
+	}
+
+	digits := strconv.FormatInt(units, 10)
+	digits = strings.TrimPrefix(digits, "-")
+	if exponent == 0 {
+		return sign + digits
+	}
+
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
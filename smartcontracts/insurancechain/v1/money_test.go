@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseDecimal(t *testing.T) {
+	tests := []struct {
+		value    string
+		exponent int
+		round    bool
+		want     int64
+		wantErr  bool
+	}{
+		{"130.6", 2, false, 13060, false},
+		{"-130.60", 2, false, -13060, false},
+		{"+7", 0, false, 7, false},
+		{"0.005", 2, true, 1, false},
+		{"0.004", 2, true, 0, false},
+		{"-0.005", 2, true, -1, false},
+		{"-0.015", 2, true, -2, false},
+		{"2.5", 0, true, 3, false},
+		{"-2.5", 0, true, -3, false},
+		{"1e3", 2, false, 100000, false},
+		{"1.25E-1", 2, true, 13, false},
+		{"130.599999", 2, true, 13060, false},
+		{"0.001", 2, false, 0, true},
+		{"12,50", 2, false, 0, true},
+		{"", 2, false, 0, true},
+		{"1e30", 2, false, 0, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseDecimal(test.value, test.exponent, test.round)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseDecimal(%q, %d, %t) error = %v, want error %t", test.value, test.exponent, test.round, err, test.wantErr)
+		} else if got != test.want {
+			t.Errorf("parseDecimal(%q, %d, %t) = %d, want %d", test.value, test.exponent, test.round, got, test.want)
+		}
+	}
+}
+
+func TestMoneyPercent(t *testing.T) {
+	tests := []struct {
+		amount  Money
+		percent string
+		want    int64
+	}{
+		{Money{13060, "USD"}, "11", 1437},
+		{Money{1000, "USD"}, "8.875", 89},
+		{Money{50, "USD"}, "1", 1},
+		{Money{-50, "USD"}, "1", -1},
+		{Money{49, "USD"}, "1", 0},
+		{Money{12345, "JPY"}, "0.5", 62},
+		{Money{-12345, "JPY"}, "0.5", -62},
+		{Money{0, "USD"}, "100", 0},
+	}
+
+	for _, test := range tests {
+		percent, err := ParsePercentage(test.percent)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := test.amount.Percent(percent)
+		if err != nil {
+			t.Errorf("%s.Percent(%s) error = %v", test.amount, test.percent, err)
+		} else if got != (Money{test.want, test.amount.Currency}) {
+			t.Errorf("%s.Percent(%s) = %s, want %d minor units", test.amount, test.percent, got, test.want)
+		}
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		data    string
+		want    Money
+		wantErr bool
+	}{
+		{`{"amount":"130.60","currency":"USD"}`, Money{13060, "USD"}, false},
+		{`{"amount":"5","currency":"jpy"}`, Money{5, "JPY"}, false},
+		{`{"amount":"1.001","currency":"USD"}`, Money{}, true},
+		{`{"amount":"1","currency":"XXX"}`, Money{}, true},
+		{`130.6`, Money{13060, "USD"}, false},              // legacy float32 amount
+		{`130.60000610351562`, Money{13060, "USD"}, false}, // float32 130.6 written as float64
+		{`1.2345e+06`, Money{123450000, "USD"}, false},
+		{`-0.005`, Money{-1, "USD"}, false},
+		{`null`, Money{0, "USD"}, false},
+	}
+
+	for _, test := range tests {
+		var got Money
+		err := json.Unmarshal([]byte(test.data), &got)
+		if (err != nil) != test.wantErr {
+			t.Errorf("Unmarshal(%s) error = %v, want error %t", test.data, err, test.wantErr)
+		} else if !test.wantErr && got != test.want {
+			t.Errorf("Unmarshal(%s) = %#v, want %#v", test.data, got, test.want)
+		}
+	}
+}
+
+func TestMoneyMarshalJSON(t *testing.T) {
+	tests := []struct {
+		amount Money
+		want   string
+	}{
+		{Money{13060, "USD"}, `{"amount":"130.60","currency":"USD"}`},
+		{Money{-5, "EUR"}, `{"amount":"-0.05","currency":"EUR"}`},
+		{Money{1234, "KWD"}, `{"amount":"1.234","currency":"KWD"}`},
+		{Money{500, "JPY"}, `{"amount":"500","currency":"JPY"}`},
+		{Money{}, `{"amount":"0.00","currency":"USD"}`},
+	}
+
+	for _, test := range tests {
+		got, err := json.Marshal(test.amount)
+		if err != nil {
+			t.Errorf("Marshal(%#v) error = %v", test.amount, err)
+		} else if string(got) != test.want {
+			t.Errorf("Marshal(%#v) = %s, want %s", test.amount, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+)
+
+// ============================================================================================================================
+// Involved Persons Definitions - Persons involved in accidents, their medical data is kept in a private data collection
+// ============================================================================================================================
+
+// collectionMedical - private data collection with the medical data of persons involved in accidents, see collections_config.json
+const collectionMedical = "collectionAccidentMedical"
+
+// medicalTransientKey - transient map key with the medical data of an involved person as JSON
+const medicalTransientKey = "medical"
+
+// personRoles - roles of persons involved in an accident
+var personRoles = map[string]bool{
+	"DRIVER":     true,
+	"PASSENGER":  true,
+	"PEDESTRIAN": true,
+	"OTHER":      true,
+}
+
+// injurySeverities - severities of injuries, from none to fatal
+var injurySeverities = map[string]bool{
+	"NONE":     true,
+	"MINOR":    true,
+	"SERIOUS":  true,
+	"CRITICAL": true,
+	"FATAL":    true,
+}
+
+// PersonConcept - person involved in an accident, either a registrant or described anonymously
+type PersonConcept struct {
+	Class           string                `json:"$class"`               // accident.Person
+	PersonID        string                `json:"personId"`             // sequence number within the report
+	Role            string                `json:"role"`                 // This can be DRIVER, PASSENGER, PEDESTRIAN or OTHER
+	Registrant      string                `json:"registrant,omitempty"` // Registrant class name + # + identificationNumber
+	Descriptor      string                `json:"descriptor,omitempty"` // anonymous description of persons who aren't registrants
+	MedicalDataHash string                `json:"medicalDataHash"`      // hex SHA-256 of the salted medical record in the private collection
+	Medical         *MedicalRecordConcept `json:"medical,omitempty"`    // only returned to members of the collection
+}
+
+// MedicalRecordConcept - private data type with the medical data of an involved person
+type MedicalRecordConcept struct {
+	Class             string `json:"$class"` // accident.MedicalRecord
+	AccidentID        string `json:"accidentId"`
+	PersonID          string `json:"personId"`
+	InjurySeverity    string `json:"injurySeverity"` // This can be NONE, MINOR, SERIOUS, CRITICAL or FATAL
+	InjuryDescription string `json:"injuryDescription,omitempty"`
+	TransportedByERS  bool   `json:"transportedByERS"`
+	TransportedTo     string `json:"transportedTo,omitempty"` // e.g. the hospital the person was taken to
+	Salt              string `json:"salt"`
+}
+
+// medicalRecordKey - Get the private data key of the medical record of an involved person
+func medicalRecordKey(accidentID string, personID string) string {
+	return fmt.Sprintf("%s#%s-%s", "accident.MedicalRecord", accidentID, personID)
+}
+
+// getMedicalTransient - Get the medical data of an involved person from the transient map of the proposal
+func getMedicalTransient(stub shim.ChaincodeStubInterface, accidentID string, personID string) (*MedicalRecordConcept, error) {
+	transientMap, err := stub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+	medicalAsBytes, found := transientMap[medicalTransientKey]
+	if !found || len(medicalAsBytes) == 0 {
+		return nil, fmt.Errorf("Medical data of the person must be passed in the transient map as %s", medicalTransientKey)
+	}
+
+	var input struct {
+		InjurySeverity    string `json:"injurySeverity"`
+		InjuryDescription string `json:"injuryDescription"`
+		TransportedByERS  bool   `json:"transportedByERS"`
+		TransportedTo     string `json:"transportedTo"`
+		Salt              string `json:"salt"`
+	}
+	if err = json.Unmarshal(medicalAsBytes, &input); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal medical data of the person: %s", err.Error())
+	}
+
+	// === Check input variables ===
+	injurySeverity := strings.ToUpper(input.InjurySeverity)
+	if !injurySeverities[injurySeverity] {
+		return nil, fmt.Errorf("Transient injurySeverity must be NONE, MINOR, SERIOUS, CRITICAL or FATAL")
+	}
+	if !input.TransportedByERS && len(input.TransportedTo) > 0 {
+		return nil, fmt.Errorf("Transient transportedTo is only given for persons transported by ERS")
+	}
+	if len(input.Salt) < minSaltLength {
+		return nil, fmt.Errorf("Transient salt must be a string of at least %d characters", minSaltLength)
+	}
+
+	return &MedicalRecordConcept{"accident.MedicalRecord", accidentID, personID, injurySeverity, input.InjuryDescription, input.TransportedByERS, input.TransportedTo, input.Salt}, nil
+}
+
+// addInvolvedPerson - Add a person to an accident report, the medical data goes to the private collection
+func addInvolvedPerson(stub shim.ChaincodeStubInterface, accidentReport *AccidentReport, role string, registrantID string, descriptor string) (*PersonConcept, error) {
+	role = strings.ToUpper(role)
+	if !personRoles[role] {
+		return nil, fmt.Errorf("Role of the person must be DRIVER, PASSENGER, PEDESTRIAN or OTHER")
+	}
+	if (registrantID == "") == (descriptor == "") {
+		return nil, fmt.Errorf("Person must be given either as registrant or as anonymous descriptor")
+	}
+
+	// === Check if registrant exists and isn't involved yet
+	var registrantRef string
+	if registrantID != "" {
+		registrantRef = fmt.Sprintf("%s#%s", "base.Registrant", registrantID)
+		registrantAsBytes, err := stub.GetState(registrantRef)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to get registrant: %s", err.Error())
+		} else if registrantAsBytes == nil {
+			return nil, fmt.Errorf("Added registrant doesn't exists: %s", registrantRef)
+		}
+
+		for _, involvedPerson := range accidentReport.InvolvedPersons {
+			if involvedPerson.Registrant == registrantRef {
+				return nil, fmt.Errorf("Registrant already involved in accident: %s", registrantRef)
+			}
+		}
+	}
+
+	personID := strconv.Itoa(len(accidentReport.InvolvedPersons) + 1)
+	medicalRecord, err := getMedicalTransient(stub, accidentReport.AccidentID, personID)
+	if err != nil {
+		return nil, err
+	}
+
+	// === Store medical data in the private collection, the report keeps its hash
+	medicalJSONasBytes, err := json.Marshal(medicalRecord)
+	if err != nil {
+		return nil, err
+	}
+	if err = stub.PutPrivateData(collectionMedical, medicalRecordKey(accidentReport.AccidentID, personID), medicalJSONasBytes); err != nil {
+		return nil, fmt.Errorf("Failed to put medical data of person: %s", err.Error())
+	}
+	hash := sha256.Sum256(medicalJSONasBytes)
+
+	person := PersonConcept{"accident.Person", personID, role, registrantRef, descriptor, hex.EncodeToString(hash[:]), nil}
+	accidentReport.InvolvedPersons = append(accidentReport.InvolvedPersons, person)
+	return &person, nil
+}
+
+// withMedicalData - Add the medical data to the involved persons of a public accident report if the caller may read it
+//
+// Like the personal data of registrants it is only returned to members of the collection, and only to emergency
+// services, insurers and admins.
+func withMedicalData(stub shim.ChaincodeStubInterface, caller *Caller, reportAsBytes []byte) ([]byte, error) {
+	if !caller.Admin && caller.ParticipantClass != "base.EmergencyServices" && caller.ParticipantClass != "base.Insurer" {
+		return reportAsBytes, nil
+	}
+
+	accidentReport := AccidentReport{}
+	if err := json.Unmarshal(reportAsBytes, &accidentReport); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal accident report: %s", err.Error())
+	}
+	if len(accidentReport.InvolvedPersons) == 0 {
+		return reportAsBytes, nil
+	}
+
+	for i := range accidentReport.InvolvedPersons {
+		person := &accidentReport.InvolvedPersons[i]
+		medicalAsBytes, err := stub.GetPrivateData(collectionMedical, medicalRecordKey(accidentReport.AccidentID, person.PersonID))
+		if err != nil {
+			return reportAsBytes, nil // no access to the collection
+		} else if medicalAsBytes == nil {
+			continue
+		}
+
+		medicalRecord := &MedicalRecordConcept{}
+		if err = json.Unmarshal(medicalAsBytes, medicalRecord); err != nil {
+			return nil, fmt.Errorf("Failed to unmarshal medical data of person: %s", err.Error())
+		}
+		person.Medical = medicalRecord
+	}
+
+	return json.Marshal(accidentReport)
+}
+
+// forgetInvolvedRegistrant - Erase the medical records of a registrant involved in accidents and unlink it from the reports
+//
+// The person stays in the report with its role and the hash of the erased record, so the report keeps its meaning.
+// Returns the number of erased medical records.
+func forgetInvolvedRegistrant(stub shim.ChaincodeStubInterface, registrantRef string) (int, error) {
+	reportRecords, err := getIndexedAssets(stub, assetIDFromRef(registrantRef), reportPersonIndex)
+	if err != nil {
+		return 0, err
+	}
+
+	erased := 0
+	for _, reportRecord := range reportRecords {
+		accidentReport := AccidentReport{}
+		if err = json.Unmarshal(reportRecord.Record, &accidentReport); err != nil {
+			return 0, fmt.Errorf("Failed to unmarshal accident report %s: %s", reportRecord.Key, err.Error())
+		}
+
+		for i := range accidentReport.InvolvedPersons {
+			person := &accidentReport.InvolvedPersons[i]
+			if person.Registrant != registrantRef {
+				continue
+			}
+			if err = stub.DelPrivateData(collectionMedical, medicalRecordKey(accidentReport.AccidentID, person.PersonID)); err != nil {
+				return 0, fmt.Errorf("Failed to delete medical data of person: %s", err.Error())
+			}
+			person.Registrant = ""
+			person.Descriptor = "erased registrant"
+			erased++
+		}
+
+		// === Save accident report to state, the registrant link is removed from the index
+		accidentJSONasBytes, err := json.Marshal(accidentReport)
+		if err != nil {
+			return 0, err
+		}
+		if err = stub.PutState(reportRecord.Key, accidentJSONasBytes); err != nil {
+			return 0, err
+		}
+		if err = deleteAssetIndexes(stub, "accident.AccidentReport", accidentReport.AccidentID, reportRecord.Record); err != nil {
+			return 0, err
+		}
+		if err = putAssetIndexes(stub, "accident.AccidentReport", accidentReport.AccidentID, accidentJSONasBytes); err != nil {
+			return 0, err
+		}
+	}
+	return erased, nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// medicalTransient - Medical data of an involved person as passed in the transient map
+const medicalTransient = `{"injurySeverity":"minor","injuryDescription":"Bruised shoulder","transportedByERS":true,"transportedTo":"NewYork-Presbyterian","salt":"3f7a0c9e5b21d846"}`
+
+// newPersonsStub - Get a mock stub with an accident the NYPD responds to and a registrant who may be involved in it
+func newPersonsStub(t *testing.T) (*InsuranceChaincode, *testStub) {
+	return newTestStub(t, map[string]interface{}{
+		"accident.AccidentReport#1534180781": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180781", OccuredAt: testTxTime, Status: "RESPONDING",
+			RespondingERS: "base.EmergencyServices#NYPD 34th Precinct"},
+		"base.Registrant#170632064": &Registrant{Class: "base.Registrant", IdentificationNumber: "170632064", LegalEntity: "INDIVIDUAL"},
+	})
+}
+
+// addTestPerson - Add a person to the test accident by the responding ERS with the given medical data
+func addTestPerson(t *testing.T, cc *InsuranceChaincode, stub *testStub, transient string, args ...string) pb.Response {
+	stub.TransientMap = map[string][]byte{medicalTransientKey: []byte(transient)}
+	return stub.call(t, testTxTime, func() pb.Response {
+		return cc.updateReport(stub, testCaller("base.EmergencyServices#NYPD 34th Precinct"), append([]string{"1534180781", "", ""}, args...))
+	})
+}
+
+func TestAddInvolvedPerson(t *testing.T) {
+	tests := []struct {
+		name      string
+		transient string
+		args      []string // role, registrant, descriptor
+		wantErr   bool
+	}{
+		{"registrant", medicalTransient, []string{"driver", "170632064"}, false},
+		{"anonymous person", medicalTransient, []string{"PEDESTRIAN", "", "Cyclist, about 30 years old"}, false},
+		{"registrant and descriptor", medicalTransient, []string{"DRIVER", "170632064", "Cyclist"}, true},
+		{"neither registrant nor descriptor", medicalTransient, []string{"DRIVER"}, true},
+		{"unknown role", medicalTransient, []string{"WITNESS", "170632064"}, true},
+		{"unknown registrant", medicalTransient, []string{"DRIVER", "170632065"}, true},
+		{"descriptor without role", medicalTransient, []string{"", "", "Cyclist"}, true},
+		{"no medical data", "", []string{"DRIVER", "170632064"}, true},
+		{"unknown injury severity", `{"injurySeverity":"BROKEN","salt":"3f7a0c9e5b21d846"}`, []string{"DRIVER", "170632064"}, true},
+		{"transported to without transport", `{"injurySeverity":"NONE","transportedTo":"NewYork-Presbyterian","salt":"3f7a0c9e5b21d846"}`, []string{"DRIVER", "170632064"}, true},
+		{"short salt", `{"injurySeverity":"NONE","salt":"3f7a"}`, []string{"DRIVER", "170632064"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newPersonsStub(t)
+			response := addTestPerson(t, cc, stub, test.transient, test.args...)
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("updateReport status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+
+			accidentReport := AccidentReport{}
+			stub.get(t, "accident.AccidentReport#1534180781", &accidentReport)
+			if test.wantErr {
+				if len(accidentReport.InvolvedPersons) != 0 || len(stub.PvtState[collectionMedical]) != 0 {
+					t.Errorf("persons = %+v, want none added", accidentReport.InvolvedPersons)
+				}
+				return
+			}
+
+			// === The report keeps the hash of the medical record, the record itself is only in the collection
+			if len(accidentReport.InvolvedPersons) != 1 {
+				t.Fatalf("persons = %+v, want one", accidentReport.InvolvedPersons)
+			}
+			person := accidentReport.InvolvedPersons[0]
+			medicalAsBytes := stub.PvtState[collectionMedical][medicalRecordKey("1534180781", "1")]
+			hash := sha256.Sum256(medicalAsBytes)
+			if person.PersonID != "1" || person.MedicalDataHash != hex.EncodeToString(hash[:]) || person.Medical != nil {
+				t.Errorf("person = %+v, want person 1 with the hash of its medical record", person)
+			}
+			if strings.Contains(string(stub.State["accident.AccidentReport#1534180781"]), "Bruised") {
+				t.Error("medical data is in the public report")
+			}
+
+			medicalRecord := MedicalRecordConcept{}
+			if err := json.Unmarshal(medicalAsBytes, &medicalRecord); err != nil {
+				t.Fatal(err)
+			}
+			if medicalRecord.InjurySeverity != "MINOR" || medicalRecord.TransportedTo != "NewYork-Presbyterian" {
+				t.Errorf("medical record = %+v, want a MINOR injury transported to NewYork-Presbyterian", medicalRecord)
+			}
+		})
+	}
+}
+
+func TestAddInvolvedPersonTwice(t *testing.T) {
+	cc, stub := newPersonsStub(t)
+	if response := addTestPerson(t, cc, stub, medicalTransient, "DRIVER", "170632064"); response.Status != shim.OK {
+		t.Fatalf("updateReport status = %d %s", response.Status, response.Message)
+	}
+	if response := addTestPerson(t, cc, stub, medicalTransient, "PASSENGER", "170632064"); response.Status == shim.OK {
+		t.Error("updateReport added a registrant twice")
+	}
+	if response := addTestPerson(t, cc, stub, medicalTransient, "PASSENGER", "", "Child"); response.Status != shim.OK {
+		t.Fatalf("updateReport status = %d %s", response.Status, response.Message)
+	}
+
+	accidentReport := AccidentReport{}
+	stub.get(t, "accident.AccidentReport#1534180781", &accidentReport)
+	if len(accidentReport.InvolvedPersons) != 2 || accidentReport.InvolvedPersons[1].PersonID != "2" {
+		t.Errorf("persons = %+v, want the anonymous passenger as person 2", accidentReport.InvolvedPersons)
+	}
+	if stub.PvtState[collectionMedical][medicalRecordKey("1534180781", "2")] == nil {
+		t.Error("medical record of person 2 is missing")
+	}
+}
+
+func TestWithMedicalData(t *testing.T) {
+	tests := []struct {
+		name        string
+		caller      string
+		admin       bool
+		denied      bool
+		wantMedical bool
+	}{
+		{"emergency services", "base.EmergencyServices#NYPD 34th Precinct", false, false, true},
+		{"insurer", "base.Insurer#Allsecur Insurance", false, false, true},
+		{"admin", "", true, false, true},
+		{"insurer outside the collection", "base.Insurer#Allsecur Insurance", false, true, false},
+		{"registrant", "base.Registrant#170632064", false, false, false},
+		{"repair shop", "base.RepairShop#Joe's Garage", false, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newPersonsStub(t)
+			if response := addTestPerson(t, cc, stub, medicalTransient, "DRIVER", "170632064"); response.Status != shim.OK {
+				t.Fatalf("updateReport status = %d %s", response.Status, response.Message)
+			}
+			stub.deniedCollections[collectionMedical] = test.denied
+
+			caller := testCaller(test.caller)
+			caller.Admin = test.admin
+			response := cc.readAssetData(stub, caller, []string{"accident.AccidentReport", "1534180781"})
+			if response.Status != shim.OK {
+				t.Fatalf("readAssetData status = %d %s", response.Status, response.Message)
+			}
+
+			accidentReport := AccidentReport{}
+			if err := json.Unmarshal(response.Payload, &accidentReport); err != nil {
+				t.Fatal(err)
+			}
+			if medical := accidentReport.InvolvedPersons[0].Medical; (medical != nil) != test.wantMedical {
+				t.Errorf("medical data = %+v, want returned %t", medical, test.wantMedical)
+			} else if medical != nil && medical.InjurySeverity != "MINOR" {
+				t.Errorf("injury severity = %s, want MINOR", medical.InjurySeverity)
+			}
+		})
+	}
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Policy Administration Definitions - Renewal, cancellation and endorsement of insurance policies
+// ============================================================================================================================
+
+// Policy status values, a policy whose validity ended keeps its status but is reported as expired
+const (
+	policyActive    = "ACTIVE"
+	policyCancelled = "CANCELLED"
+	policyExpired   = "EXPIRED"
+)
+
+// Changes an endorsement can make to a policy
+const (
+	endorseCoverage = "COVERAGE"
+	endorseVehicle  = "VEHICLE"
+	endorseHolder   = "HOLDER"
+)
+
+// policyStatusAt - Get the status of a policy at a point in time, policies stored before the status field are active
+func (p *InsurancePolicy) policyStatusAt(at time.Time) string {
+	if p.CancelledAt != nil && !at.Before(*p.CancelledAt) {
+		return policyCancelled
+	}
+	if at.After(p.ValidTo) {
+		return policyExpired
+	}
+	return policyActive
+}
+
+// asOf - Get the policy as it was at a point in time, undoing the endorsements which became effective later
+func (p *InsurancePolicy) asOf(at time.Time) InsurancePolicy {
+	policy := *p
+	for i := len(p.Endorsements) - 1; i >= 0; i-- {
+		endorsement := p.Endorsements[i]
+		if !endorsement.EffectiveDate.After(at) {
+			break
+		}
+		for _, change := range endorsement.Changes {
+			switch change {
+			case endorseCoverage:
+				policy.Coverage = endorsement.PreviousCoverage
+			case endorseVehicle:
+				policy.RegisteredVehicle = endorsement.PreviousVehicle
+			case endorseHolder:
+				policy.PolicyHolder = endorsement.PreviousHolder
+			}
+		}
+	}
+	return policy
+}
+
+// getPolicyForInsurer - Get a policy and check the insurer issued it
+func getPolicyForInsurer(stub shim.ChaincodeStubInterface, policyID string, insurerRef string) (*InsurancePolicy, error) {
+	// === Check if InsurancePolicy asset exists
+	policyRef := fmt.Sprintf("%s#%s", "insurance.InsurancePolicy", policyID)
+	policyAsBytes, err := stub.GetState(policyRef)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get insurance policy: %s", err.Error())
+	} else if policyAsBytes == nil {
+		return nil, fmt.Errorf("This insurance policy doesn't exists: %s", policyRef)
+	}
+
+	// === Unmarshal the policy to an object
+	insurancePolicy := &InsurancePolicy{}
+	if err = json.Unmarshal(policyAsBytes, insurancePolicy); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal insurance policy: %s", err.Error())
+	}
+
+	if insurancePolicy.IssuedBy != insurerRef {
+		return nil, fmt.Errorf("Only the insurer of the policy may change it: %s", insurerRef)
+	}
+	if insurancePolicy.Status == policyCancelled {
+		return nil, fmt.Errorf("Insurance policy is cancelled: %s", policyRef)
+	}
+	return insurancePolicy, nil
+}
+
+// savePolicy - Store a policy into state and emit PolicyUpdate event
+func savePolicy(stub shim.ChaincodeStubInterface, insurancePolicy *InsurancePolicy, reason string) pb.Response {
+	policyJSONasBytes, err := json.Marshal(insurancePolicy)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save insurance policy to state ===
+	policyRef := fmt.Sprintf("%s#%s", insurancePolicy.Class, insurancePolicy.PolicyID)
+	err = stub.PutState(policyRef, policyJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit PolicyUpdate event ===
+	policyUpdate := &PolicyUpdateEvent{insurancePolicy.PolicyID, insurancePolicy.Status, reason, len(insurancePolicy.Endorsements)}
+	eventJSONasBytes, err := json.Marshal(policyUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("PolicyUpdateEvent", eventJSONasBytes)
+
+	fmt.Println("- Insurance policy successfully updated")
+	return shim.Success(eventJSONasBytes)
+}
+
+// renewPolicy - Issue the next term of a policy with a new validity window
+func (t *InsuranceChaincode) renewPolicy(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the issuing insurer is the caller
+	// 0=policyId          1=validFrom                 2=validTo
+	// USA-AX203-3459802   2020-08-01T00:00:00.000Z    2022-08-01T00:00:00.000Z
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	validFrom, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a RFC3339 dateTime string")
+	}
+	validTo, err := time.Parse(time.RFC3339, args[2])
+	if err != nil {
+		return shim.Error("3rd argument must be a RFC3339 dateTime string")
+	}
+	if !validTo.After(validFrom) {
+		return shim.Error("3rd argument must be after the 2nd argument")
+	}
+
+	insurancePolicy, err := getPolicyForInsurer(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Only the latest term of a policy can be renewed, without overlapping the current term
+	if insurancePolicy.RenewedBy != "" {
+		return shim.Error("Insurance policy is already renewed by " + insurancePolicy.RenewedBy)
+	}
+	if validFrom.Before(insurancePolicy.ValidTo) {
+		return shim.Error("2nd argument must not be before the end of the current term " + insurancePolicy.ValidTo.Format(time.RFC3339))
+	}
+	if insurancePolicy.HolderNotOwner {
+		return shim.Error("The policy holder no longer owns the vehicle, endorse the policy before renewing it")
+	}
+
+	// === Create next term, the aggregate limits start over
+	term := insurancePolicy.Term
+	if term == 0 {
+		term = 1
+	}
+	policyRef := fmt.Sprintf("%s#%s", insurancePolicy.Class, insurancePolicy.PolicyID)
+	renewal := *insurancePolicy
+	renewal.PolicyID = fmt.Sprintf("%s-%s-%d-%d", insurancePolicy.CountryCode, insurancePolicy.InsurerCode, insurancePolicy.PolicyNumber, term+1)
+	renewal.ValidFrom = validFrom
+	renewal.ValidTo = validTo
+	renewal.Coverage = make([]CoverageConcept, len(insurancePolicy.Coverage))
+	for i, coverage := range insurancePolicy.Coverage {
+		coverage.PaidTotal = Money{0, coverage.PaidTotal.Currency}
+		renewal.Coverage[i] = coverage
+	}
+	renewal.Status = policyActive
+	renewal.Term = term + 1
+	renewal.PreviousTerm = policyRef
+	renewal.RenewedBy = ""
+	renewal.CancelledAt = nil
+	renewal.CancelReason = ""
+	renewal.Endorsements = nil
+
+	renewalRef := fmt.Sprintf("%s#%s", renewal.Class, renewal.PolicyID)
+	renewalAsBytes, err := stub.GetState(renewalRef)
+	if err != nil {
+		return shim.Error("Failed to get insurance policy: " + err.Error())
+	} else if renewalAsBytes != nil {
+		return shim.Error("This insurance policy already exists: " + renewalRef)
+	}
+
+	renewalJSONasBytes, err := json.Marshal(renewal)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(renewalRef, renewalJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, renewal.Class, renewal.PolicyID, renewalJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Link the current term to its renewal
+	insurancePolicy.RenewedBy = renewalRef
+	return savePolicy(stub, insurancePolicy, "Policy renewed by "+renewal.PolicyID)
+}
+
+// cancelPolicy - Cancel a policy from an effective date on
+func (t *InsuranceChaincode) cancelPolicy(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the issuing insurer is the caller
+	// 0=policyId          1=effectiveDate             2=reason
+	// USA-AX203-3459802   2019-03-01T00:00:00.000Z    Premium not paid
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	effectiveDate, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a RFC3339 dateTime string")
+	}
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+
+	insurancePolicy, err := getPolicyForInsurer(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check effective date lies within the validity window
+	if effectiveDate.Before(insurancePolicy.ValidFrom) || effectiveDate.After(insurancePolicy.ValidTo) {
+		return shim.Error(fmt.Sprintf("2nd argument must be between %s and %s",
+			insurancePolicy.ValidFrom.Format(time.RFC3339), insurancePolicy.ValidTo.Format(time.RFC3339)))
+	}
+
+	insurancePolicy.Status = policyCancelled
+	insurancePolicy.CancelledAt = &effectiveDate
+	insurancePolicy.CancelReason = args[2]
+	return savePolicy(stub, insurancePolicy, args[2])
+}
+
+// endorsePolicy - Change the coverage, vehicle or holder of a policy mid-term
+func (t *InsuranceChaincode) endorsePolicy(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the issuing insurer is the caller, empty arguments 2-4 are left unchanged
+	// 0=policyId          1=effectiveDate             2=json{coverages[]}                                  3=registeredVehicle  4=policyHolder  5=currency
+	// USA-AX203-3459802   2019-03-01T00:00:00.000Z    [{"type":"GLASS","deductible":100,"perEventLimit":2000}]  1HTZR0007JH586991    170632064       USD
+
+	if len(args) < 5 || len(args) > 6 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 5 and maximum of 6")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	effectiveDate, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a RFC3339 dateTime string")
+	}
+	if len(args[2]) <= 0 && len(args[3]) <= 0 && len(args[4]) <= 0 {
+		return shim.Error("At least one of the 3rd to 5th arguments must be a non-empty string")
+	}
+
+	currency := defaultCurrency
+	if len(args) > 5 && len(args[5]) > 0 {
+		currency = strings.ToUpper(args[5])
+		if _, err = currencyExponent(currency); err != nil {
+			return shim.Error("6th argument must be a supported ISO 4217 currency code")
+		}
+	}
+
+	insurancePolicy, err := getPolicyForInsurer(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	previousPolicyAsBytes, err := json.Marshal(insurancePolicy)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check effective date lies within the validity window and after the last endorsement
+	if effectiveDate.Before(insurancePolicy.ValidFrom) || effectiveDate.After(insurancePolicy.ValidTo) {
+		return shim.Error(fmt.Sprintf("2nd argument must be between %s and %s",
+			insurancePolicy.ValidFrom.Format(time.RFC3339), insurancePolicy.ValidTo.Format(time.RFC3339)))
+	}
+	if count := len(insurancePolicy.Endorsements); count > 0 && effectiveDate.Before(insurancePolicy.Endorsements[count-1].EffectiveDate) {
+		return shim.Error("2nd argument must not be before the last endorsement " + insurancePolicy.Endorsements[count-1].EffectiveDate.Format(time.RFC3339))
+	}
+
+	endorsedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	endorsement := EndorsementConcept{"insurance.Endorsement", len(insurancePolicy.Endorsements) + 1, effectiveDate, endorsedAt, caller.ParticipantRef, nil, nil, "", ""}
+
+	// === Replace coverages, keeping the amount paid per coverage type
+	if len(args[2]) > 0 {
+		coverage, err := parseCoverages([]byte(args[2]), currency)
+		if err != nil {
+			return shim.Error("Failed to unmarshal coverage array: " + err.Error())
+		}
+		for i := range coverage {
+			if previous, err := findCoverage(insurancePolicy, coverage[i].Type); err == nil && !previous.PaidTotal.IsZero() {
+				if coverage[i].PaidTotal, err = coverage[i].PaidTotal.Add(previous.PaidTotal); err != nil {
+					return shim.Error(fmt.Sprintf("Coverage %s: %s", coverage[i].Type, err.Error()))
+				}
+			}
+		}
+		endorsement.Changes = append(endorsement.Changes, endorseCoverage)
+		endorsement.PreviousCoverage = insurancePolicy.Coverage
+		insurancePolicy.Coverage = coverage
+	}
+
+	// === Replace vehicle and holder
+	if len(args[3]) > 0 {
+		vehicleRef := fmt.Sprintf("%s#%s", "base.Vehicle", args[3])
+		if vehicleRef == insurancePolicy.RegisteredVehicle {
+			return shim.Error("4th argument must differ from the insured vehicle")
+		}
+		endorsement.Changes = append(endorsement.Changes, endorseVehicle)
+		endorsement.PreviousVehicle = insurancePolicy.RegisteredVehicle
+		insurancePolicy.RegisteredVehicle = vehicleRef
+	}
+	if len(args[4]) > 0 {
+		holderRef := fmt.Sprintf("%s#%s", "base.Registrant", args[4])
+		if holderRef == insurancePolicy.PolicyHolder {
+			return shim.Error("5th argument must differ from the policy holder")
+		}
+		holderAsBytes, err := stub.GetState(holderRef)
+		if err != nil {
+			return shim.Error("Failed to get policy holder: " + err.Error())
+		} else if holderAsBytes == nil {
+			return shim.Error("Given policy holder doesn't exists: " + holderRef)
+		}
+		endorsement.Changes = append(endorsement.Changes, endorseHolder)
+		endorsement.PreviousHolder = insurancePolicy.PolicyHolder
+		insurancePolicy.PolicyHolder = holderRef
+	}
+
+	// === Check the vehicle is owned by the policy holder after a change of either
+	if endorsement.PreviousVehicle != "" || endorsement.PreviousHolder != "" {
+		vehicleAsBytes, err := stub.GetState(insurancePolicy.RegisteredVehicle)
+		if err != nil {
+			return shim.Error("Failed to get vehicle: " + err.Error())
+		} else if vehicleAsBytes == nil {
+			return shim.Error("Given vehicle doesn't exists: " + insurancePolicy.RegisteredVehicle)
+		}
+
+		var vehicle Vehicle
+		if err = json.Unmarshal(vehicleAsBytes, &vehicle); err != nil {
+			return shim.Error("Failed to unmarshal vehicle asset: " + err.Error())
+		}
+		if vehicle.Owner != insurancePolicy.PolicyHolder {
+			return shim.Error("The vehicle is not owned by the policy holder")
+		}
+		insurancePolicy.HolderNotOwner = false
+	}
+
+	insurancePolicy.Endorsements = append(insurancePolicy.Endorsements, endorsement)
+
+	// === Move the policy in the vehicle index
+	if endorsement.PreviousVehicle != "" {
+		if err = deleteAssetIndexes(stub, insurancePolicy.Class, insurancePolicy.PolicyID, previousPolicyAsBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+		policyJSONasBytes, err := json.Marshal(insurancePolicy)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = putAssetIndexes(stub, insurancePolicy.Class, insurancePolicy.PolicyID, policyJSONasBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	reason := fmt.Sprintf("Endorsement %d changes %s", endorsement.Version, strings.Join(endorsement.Changes, ", "))
+	return savePolicy(stub, insurancePolicy, reason)
+}
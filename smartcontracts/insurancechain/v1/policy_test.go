@@ -0,0 +1,264 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Validity and coverage of the test policy
+var (
+	policyValidFrom = time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC)
+	policyValidTo   = time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	policyCoverage  = []CoverageConcept{
+		{"insurance.Coverage", "THIRD_PARTY_LIABILITY", Money{0, "USD"}, Money{100000000, "USD"}, Money{0, "USD"}, Money{0, "USD"}},
+		{"insurance.Coverage", "COLLISION", Money{50000, "USD"}, Money{5000000, "USD"}, Money{0, "USD"}, Money{0, "USD"}},
+	}
+)
+
+// newPolicyStub - Get a mock stub with the policy USA-AS204-1042919 issued by AXA Insurance
+func newPolicyStub(t *testing.T) (*InsuranceChaincode, *testStub) {
+	return newTestStub(t, map[string]interface{}{
+		"insurance.InsurancePolicy#USA-AS204-1042919": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AS204-1042919", ValidFrom: policyValidFrom, ValidTo: policyValidTo,
+			RegisteredVehicle: "base.Vehicle#1HTZR0007JH586991", CountryCode: "USA", InsurerCode: "AS204", PolicyNumber: 1042919, Coverage: policyCoverage,
+			PolicyHolder: "base.Registrant#170632064", IssuedBy: "base.Insurer#AXA Insurance", Territory: []string{"US"}, Status: policyActive, Term: 1},
+		"base.Vehicle#1HTZR0007JH586991": &Vehicle{Class: "base.Vehicle", RegistrationNumber: "1HTZR0007JH586991", Owner: "base.Registrant#170632064"},
+		"base.Vehicle#JN6ND01S3GX194659": &Vehicle{Class: "base.Vehicle", RegistrationNumber: "JN6ND01S3GX194659", Owner: "base.Registrant#170632064"},
+		"base.Registrant#170632064":      &Registrant{Class: "base.Registrant", IdentificationNumber: "170632064", LegalEntity: "INDIVIDUAL"},
+	})
+}
+
+func TestPolicyStatusAt(t *testing.T) {
+	cancelledAt := time.Date(2019, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		cancelledAt *time.Time
+		at          time.Time
+		want        string
+	}{
+		{"within term", nil, policyValidFrom.Add(time.Hour), policyActive},
+		{"end of term", nil, policyValidTo, policyActive},
+		{"after term", nil, policyValidTo.Add(time.Second), policyExpired},
+		{"before cancellation", &cancelledAt, cancelledAt.Add(-time.Second), policyActive},
+		{"from cancellation", &cancelledAt, cancelledAt, policyCancelled},
+		{"cancelled after term", &cancelledAt, policyValidTo.Add(time.Hour), policyCancelled},
+	}
+
+	for _, test := range tests {
+		insurancePolicy := &InsurancePolicy{ValidFrom: policyValidFrom, ValidTo: policyValidTo, CancelledAt: test.cancelledAt}
+		if got := insurancePolicy.policyStatusAt(test.at); got != test.want {
+			t.Errorf("%s: policyStatusAt = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestPolicyAsOf(t *testing.T) {
+	firstEffective := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	secondEffective := time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC)
+	glass := []CoverageConcept{{"insurance.Coverage", "GLASS", Money{10000, "USD"}, Money{200000, "USD"}, Money{0, "USD"}, Money{0, "USD"}}}
+	insurancePolicy := &InsurancePolicy{RegisteredVehicle: "base.Vehicle#C", PolicyHolder: "base.Registrant#B", Coverage: glass, Endorsements: []EndorsementConcept{
+		{"insurance.Endorsement", 1, firstEffective, firstEffective, "base.Insurer#AXA Insurance", []string{endorseCoverage, endorseHolder}, policyCoverage, "", "base.Registrant#A"},
+		{"insurance.Endorsement", 2, secondEffective, secondEffective, "base.Insurer#AXA Insurance", []string{endorseVehicle}, nil, "base.Vehicle#B", ""},
+	}}
+
+	tests := []struct {
+		name        string
+		at          time.Time
+		wantVehicle string
+		wantHolder  string
+		wantCover   []CoverageConcept
+	}{
+		{"before all endorsements", firstEffective.Add(-time.Second), "base.Vehicle#B", "base.Registrant#A", policyCoverage},
+		{"from the first endorsement", firstEffective, "base.Vehicle#B", "base.Registrant#B", glass},
+		{"from the second endorsement", secondEffective, "base.Vehicle#C", "base.Registrant#B", glass},
+	}
+
+	for _, test := range tests {
+		policy := insurancePolicy.asOf(test.at)
+		if policy.RegisteredVehicle != test.wantVehicle || policy.PolicyHolder != test.wantHolder || !reflect.DeepEqual(policy.Coverage, test.wantCover) {
+			t.Errorf("%s: asOf = vehicle %s, holder %s, coverage %v, want %s, %s, %v", test.name,
+				policy.RegisteredVehicle, policy.PolicyHolder, policy.Coverage, test.wantVehicle, test.wantHolder, test.wantCover)
+		}
+	}
+	if insurancePolicy.RegisteredVehicle != "base.Vehicle#C" || !reflect.DeepEqual(insurancePolicy.Coverage, glass) {
+		t.Error("asOf changed the current policy")
+	}
+}
+
+func TestRenewPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		insurer string
+		args    []string
+		wantErr bool
+	}{
+		{"next term", "AXA Insurance", []string{"USA-AS204-1042919", "2020-08-01T00:00:00Z", "2022-08-01T00:00:00Z"}, false},
+		{"overlapping current term", "AXA Insurance", []string{"USA-AS204-1042919", "2020-07-01T00:00:00Z", "2022-08-01T00:00:00Z"}, true},
+		{"end before start", "AXA Insurance", []string{"USA-AS204-1042919", "2022-08-01T00:00:00Z", "2020-08-01T00:00:00Z"}, true},
+		{"other insurer", "Allsecur Insurance", []string{"USA-AS204-1042919", "2020-08-01T00:00:00Z", "2022-08-01T00:00:00Z"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newPolicyStub(t)
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.renewPolicy(stub, testCaller("base.Insurer#"+test.insurer), test.args)
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("renewPolicy status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			current, renewal := InsurancePolicy{}, InsurancePolicy{}
+			stub.get(t, "insurance.InsurancePolicy#USA-AS204-1042919", &current)
+			stub.get(t, "insurance.InsurancePolicy#USA-AS204-1042919-2", &renewal)
+			if current.RenewedBy != "insurance.InsurancePolicy#USA-AS204-1042919-2" || renewal.PreviousTerm != "insurance.InsurancePolicy#USA-AS204-1042919" || renewal.Term != 2 {
+				t.Errorf("terms aren't linked, renewed by %q, previous term %q, term %d", current.RenewedBy, renewal.PreviousTerm, renewal.Term)
+			}
+
+			// === A term is renewed only once
+			response = stub.call(t, testTxTime, func() pb.Response {
+				return cc.renewPolicy(stub, testCaller("base.Insurer#"+test.insurer), test.args)
+			})
+			if response.Status == shim.OK {
+				t.Error("renewPolicy renewed a term twice")
+			}
+		})
+	}
+}
+
+func TestCancelPolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"within term", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", "Premium not paid"}, false},
+		{"before term", []string{"USA-AS204-1042919", "2018-07-01T00:00:00Z", "Premium not paid"}, true},
+		{"after term", []string{"USA-AS204-1042919", "2020-09-01T00:00:00Z", "Premium not paid"}, true},
+		{"without reason", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", ""}, true},
+	}
+
+	for _, test := range tests {
+		cc, stub := newPolicyStub(t)
+		response := stub.call(t, testTxTime, func() pb.Response {
+			return cc.cancelPolicy(stub, testCaller("base.Insurer#AXA Insurance"), test.args)
+		})
+		if (response.Status != shim.OK) != test.wantErr {
+			t.Errorf("%s: cancelPolicy status = %d %s, want error %t", test.name, response.Status, response.Message, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+
+		insurancePolicy := InsurancePolicy{}
+		stub.get(t, "insurance.InsurancePolicy#USA-AS204-1042919", &insurancePolicy)
+		if insurancePolicy.Status != policyCancelled || insurancePolicy.CancelReason != test.args[2] {
+			t.Errorf("%s: status %s reason %q, want %s %q", test.name, insurancePolicy.Status, insurancePolicy.CancelReason, policyCancelled, test.args[2])
+		}
+	}
+}
+
+func TestEndorsePolicy(t *testing.T) {
+	glass := `[{"type":"GLASS","deductible":100,"perEventLimit":2000}]`
+	tests := []struct {
+		name        string
+		args        []string
+		wantChanges []string
+		wantErr     bool
+	}{
+		{"coverage", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", glass, "", ""}, []string{endorseCoverage}, false},
+		{"vehicle", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", "", "JN6ND01S3GX194659", ""}, []string{endorseVehicle}, false},
+		{"nothing changed", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", "", "", ""}, nil, true},
+		{"same vehicle", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", "", "1HTZR0007JH586991", ""}, nil, true},
+		{"unknown holder", []string{"USA-AS204-1042919", "2019-03-01T00:00:00Z", "", "", "999999999"}, nil, true},
+		{"after term", []string{"USA-AS204-1042919", "2020-09-01T00:00:00Z", glass, "", ""}, nil, true},
+	}
+
+	for _, test := range tests {
+		cc, stub := newPolicyStub(t)
+		response := stub.call(t, testTxTime, func() pb.Response {
+			return cc.endorsePolicy(stub, testCaller("base.Insurer#AXA Insurance"), test.args)
+		})
+		if (response.Status != shim.OK) != test.wantErr {
+			t.Errorf("%s: endorsePolicy status = %d %s, want error %t", test.name, response.Status, response.Message, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+
+		insurancePolicy := InsurancePolicy{}
+		stub.get(t, "insurance.InsurancePolicy#USA-AS204-1042919", &insurancePolicy)
+		if len(insurancePolicy.Endorsements) != 1 || !reflect.DeepEqual(insurancePolicy.Endorsements[0].Changes, test.wantChanges) {
+			t.Errorf("%s: endorsements = %+v, want one changing %v", test.name, insurancePolicy.Endorsements, test.wantChanges)
+		}
+	}
+}
+
+func TestAcceptClaimAfterEndorsement(t *testing.T) {
+	occuredAt := time.Date(2019, 2, 1, 12, 0, 0, 0, time.UTC)
+	glass := `[{"type":"GLASS","deductible":100,"perEventLimit":2000}]`
+	tests := []struct {
+		name      string
+		effective string // effective date of the endorsement replacing the coverage with GLASS
+		wantErr   bool
+	}{
+		{"coverage removed after the accident", "2019-03-01T00:00:00Z", false},
+		{"coverage removed before the accident", "2019-01-01T00:00:00Z", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newPolicyStub(t)
+			stub.put(t, map[string]interface{}{
+				"accident.AccidentReport#1534180780": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180780", OccuredAt: occuredAt, Status: "RESOLVED"},
+				"insurance.InsurancePolicy#USA-AX203-3459802": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AX203-3459802", IssuedBy: "base.Insurer#Allsecur Insurance",
+					Coverage: policyCoverage},
+				"vehiclerepair.RepairQuote#1534180999": &RepairQuote{Class: "vehiclerepair.RepairQuote", QuoteID: "1534180999", Total: Money{150000, "USD"}},
+				"insurance.InsuranceClaim#1534181000": &InsuranceClaim{Class: "insurance.InsuranceClaim", ClaimID: "1534181000", Status: "NEW", AccidentReport: "accident.AccidentReport#1534180780",
+					Claimant: "insurance.InsurancePolicy#USA-AX203-3459802", Defendant: "insurance.InsurancePolicy#USA-AS204-1042919", CostOfRepair: "vehiclerepair.RepairQuote#1534180999", CoverageType: "COLLISION"},
+			})
+			insurer := testCaller("base.Insurer#AXA Insurance")
+
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.endorsePolicy(stub, insurer, []string{"USA-AS204-1042919", test.effective, glass, "", ""})
+			})
+			if response.Status != shim.OK {
+				t.Fatalf("endorsePolicy: %s", response.Message)
+			}
+
+			response = stub.call(t, testTxTime, func() pb.Response {
+				return cc.acceptClaim(stub, insurer, []string{"1534181000"})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("acceptClaim status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			// === Paid from the COLLISION terms at the time of the accident, the paid total stays with the replaced coverage
+			insuranceClaim := InsuranceClaim{}
+			stub.get(t, "insurance.InsuranceClaim#1534181000", &insuranceClaim)
+			if insuranceClaim.Payout == nil || insuranceClaim.Payout.PayoutAmount != (Money{100000, "USD"}) {
+				t.Errorf("payout = %+v, want 1000.00 USD", insuranceClaim.Payout)
+			}
+			insurancePolicy := InsurancePolicy{}
+			stub.get(t, "insurance.InsurancePolicy#USA-AS204-1042919", &insurancePolicy)
+			paid, err := paidCoverage(&insurancePolicy, "COLLISION")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if paid.PaidTotal != (Money{100000, "USD"}) {
+				t.Errorf("paid total of replaced COLLISION coverage = %s, want 1000.00 USD", paid.PaidTotal)
+			}
+		})
+	}
+}
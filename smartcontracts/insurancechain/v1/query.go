@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Query Definitions - Rich queries over the CouchDB state database
+// ============================================================================================================================
+
+// assetClasses - classes of participants and assets which can be queried
+var assetClasses = map[string]bool{
+	"base.Registrant":               true,
+	"base.Insurer":                  true,
+	"base.EmergencyServices":        true,
+	"base.RepairShop":               true,
+	"base.Vehicle":                  true,
+	"accident.AccidentReport":       true,
+	"accident.WitnessStatement":     true,
+	"vehiclerepair.QuoteRequest":    true,
+	"vehiclerepair.RepairQuote":     true,
+	"vehiclerepair.RepairOrder":     true,
+	"vehiclerepair.QuoteCommitment": true,
+	"insurance.InsurancePolicy":     true,
+	"insurance.InsuranceClaim":      true,
+	"settlement.SettlementEntry":    true,
+	"settlement.NetObligation":      true,
+	"settlement.NettingRun":         true,
+}
+
+// classField - the $class field, escaped so CouchDB doesn't take it for an operator
+const classField = "\\$class"
+
+// defaultPageSize - page size of a query when none is given
+const defaultPageSize = 25
+
+// maxPageSize - maximum page size of a query
+const maxPageSize = 200
+
+// QueryRecord - single record of a query result
+type QueryRecord struct {
+	Key    string          `json:"key"`
+	Record json.RawMessage `json:"record"`
+}
+
+// QueryResult - page of records of a query
+type QueryResult struct {
+	Records             []QueryRecord `json:"records"`
+	FetchedRecordsCount int32         `json:"fetchedRecordsCount"`
+	Bookmark            string        `json:"bookmark"`
+}
+
+// queryAssets - Query assets of one class with a CouchDB selector
+func (t *InsuranceChaincode) queryAssets(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// simple data model arguments
+	// 0=class                  1=selector                                     2=sort                 3=fields                         4=pageSize  5=bookmark
+	// accident.AccidentReport  {"status":"NEW","location.latitude":{"$gt":40}}  [{"occuredAt":"desc"}]  ["accidentId","status","location"]  25
+
+	if len(args) < 2 || len(args) > 6 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 2 and maximum of 6")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	assetClass := args[0]
+	if !assetClasses[assetClass] {
+		return shim.Error("1st argument must be a known asset class, got " + assetClass)
+	}
+
+	// === Restrict selector to the asset class
+	var selector map[string]interface{}
+	if err := json.Unmarshal([]byte(args[1]), &selector); err != nil {
+		return shim.Error("2nd argument must be a JSON selector object: " + err.Error())
+	}
+	for _, key := range []string{"$class", classField} {
+		if value, ok := selector[key]; ok && value != assetClass {
+			return shim.Error("Selector can't query other classes than " + assetClass)
+		}
+		delete(selector, key)
+	}
+	selector[classField] = assetClass
+
+	query := map[string]interface{}{"selector": selector}
+
+	// === Add optional sort and fields
+	if len(args) > 2 && len(args[2]) > 0 {
+		var sort []interface{}
+		if err := json.Unmarshal([]byte(args[2]), &sort); err != nil {
+			return shim.Error("3rd argument must be a JSON sort array: " + err.Error())
+		}
+		query["sort"] = sort
+	}
+	if len(args) > 3 && len(args[3]) > 0 {
+		var fields []string
+		if err := json.Unmarshal([]byte(args[3]), &fields); err != nil {
+			return shim.Error("4th argument must be a JSON array of field names: " + err.Error())
+		}
+		query["fields"] = fields
+	}
+
+	pageSize := int32(defaultPageSize)
+	if len(args) > 4 && len(args[4]) > 0 {
+		size, err := strconv.ParseInt(args[4], 10, 32)
+		if err != nil || size <= 0 || size > maxPageSize {
+			return shim.Error(fmt.Sprintf("5th argument must be an integer between 1 and %d", maxPageSize))
+		}
+		pageSize = int32(size)
+	}
+
+	var bookmark string
+	if len(args) > 5 {
+		bookmark = args[5]
+	}
+
+	queryAsBytes, err := json.Marshal(query)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	result, err := getQueryResultPage(stub, string(queryAsBytes), pageSize, bookmark)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	resultAsBytes, err := json.Marshal(result)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return shim.Success(resultAsBytes)
+}
+
+// getQueryResultPage - Run a paginated CouchDB query and collect the records
+func getQueryResultPage(stub shim.ChaincodeStubInterface, query string, pageSize int32, bookmark string) (*QueryResult, error) {
+	fmt.Printf("- getQueryResultPage query: %s\n", query)
+
+	resultsIterator, metadata, err := stub.GetQueryResultWithPagination(query, pageSize, bookmark)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to query assets: %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	result := &QueryResult{Records: []QueryRecord{}}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+		result.Records = append(result.Records, QueryRecord{queryResponse.Key, json.RawMessage(queryResponse.Value)})
+	}
+
+	if metadata != nil {
+		result.FetchedRecordsCount = metadata.FetchedRecordsCount
+		result.Bookmark = metadata.Bookmark
+	}
+
+	return result, nil
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Registrant Personal Data Definitions - Personal data of registrants is kept in a private data collection
+// ============================================================================================================================
+
+// collectionRegistrant - private data collection with the personal data of registrants, see collections_config.json
+//
+// The blockToLive of the collection is 0, as personal data of active registrants must not expire. Member peers therefore
+// keep the private write sets of committed blocks in their private data store after the data is deleted from the
+// collection, which erasure receipts list as retained.
+const collectionRegistrant = "collectionRegistrant"
+
+// Places erased personal data may remain in, listed in the erasure receipt
+const (
+	retainedPrivateDataStore = "privateDataStore" // private write sets kept by member peers, never purged with blockToLive 0
+	retainedLedgerBlocks     = "ledgerBlocks"     // earlier public versions in the blocks, getAssetHistory doesn't serve them
+)
+
+// registrantPersonalFields - JSON fields of the public registrant which held personal data before the private collection
+var registrantPersonalFields = []string{"name", "initials", "address"}
+
+// registrantTransientKey - transient map key with the personal data of a registrant as JSON
+const registrantTransientKey = "registrant"
+
+// migrationTransientKey - transient map key with the master salt of migrated personal data
+const migrationTransientKey = "migrationSalt"
+
+// minSaltLength - minimum length of the salt of personal data, a short salt makes the public hash guessable
+const minSaltLength = 16
+
+// RegistrantPersonalData - private data type with the personal data of a registrant, stored under the registrant key
+type RegistrantPersonalData struct {
+	Class                string         `json:"$class"` // base.RegistrantPersonalData
+	IdentificationNumber string         `json:"identificationNumber"`
+	Name                 string         `json:"name"`
+	Initials             string         `json:"initials,omitempty"`
+	Address              AddressConcept `json:"address"`
+	Salt                 string         `json:"salt"`
+}
+
+// getRegistrantTransient - Get the personal data of a registrant from the transient map of the proposal
+//
+// Personal data passed as arguments would be recorded in the transaction, the transient map isn't.
+func getRegistrantTransient(stub shim.ChaincodeStubInterface, identificationNumber string) (*RegistrantPersonalData, error) {
+	transientMap, err := stub.GetTransient()
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get transient map: %s", err.Error())
+	}
+	personalAsBytes, found := transientMap[registrantTransientKey]
+	if !found || len(personalAsBytes) == 0 {
+		return nil, fmt.Errorf("Personal data of the registrant must be passed in the transient map as %s", registrantTransientKey)
+	}
+
+	var input struct {
+		Name         string `json:"name"`
+		Initials     string `json:"initials"`
+		AddressLine1 string `json:"addressLine1"`
+		AddressLine2 string `json:"addressLine2"`
+		AddressLine3 string `json:"addressLine3"`
+		Salt         string `json:"salt"`
+	}
+	if err = json.Unmarshal(personalAsBytes, &input); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal personal data of the registrant: %s", err.Error())
+	}
+
+	// === Check input variables ===
+	if len(input.Name) <= 0 {
+		return nil, fmt.Errorf("Transient name must be a non-empty string")
+	}
+	if len(input.AddressLine1) <= 0 {
+		return nil, fmt.Errorf("Transient addressLine1 must be a non-empty string")
+	}
+	if len(input.AddressLine2) <= 0 {
+		return nil, fmt.Errorf("Transient addressLine2 must be a non-empty string")
+	}
+	if len(input.Salt) < minSaltLength {
+		return nil, fmt.Errorf("Transient salt must be a string of at least %d characters", minSaltLength)
+	}
+
+	address := AddressConcept{"base.Address", input.AddressLine1, input.AddressLine2, input.AddressLine3}
+	return &RegistrantPersonalData{"base.RegistrantPersonalData", identificationNumber, input.Name, input.Initials, address, input.Salt}, nil
+}
+
+// putRegistrantPersonalData - Store the personal data of a registrant into the private data collection
+//
+// Returns the hex SHA-256 of the stored record, which is salted and kept on the public registrant.
+func putRegistrantPersonalData(stub shim.ChaincodeStubInterface, personalData *RegistrantPersonalData) (string, error) {
+	personalJSONasBytes, err := json.Marshal(personalData)
+	if err != nil {
+		return "", err
+	}
+
+	registrantRef := fmt.Sprintf("%s#%s", "base.Registrant", personalData.IdentificationNumber)
+	if err = stub.PutPrivateData(collectionRegistrant, registrantRef, personalJSONasBytes); err != nil {
+		return "", fmt.Errorf("Failed to put personal data of registrant: %s", err.Error())
+	}
+
+	hash := sha256.Sum256(personalJSONasBytes)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// withRegistrantPersonalData - Add the personal data to a public registrant record if the caller may read it
+//
+// Membership is decided by the collection, the peer refuses reads of callers whose organisation isn't a member and
+// of peers not holding the collection. Those callers get the public record with the pseudonymous ID and the hash.
+func withRegistrantPersonalData(stub shim.ChaincodeStubInterface, registrantAsBytes []byte) ([]byte, error) {
+	registrant := Registrant{}
+	if err := json.Unmarshal(registrantAsBytes, &registrant); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal registrant: %s", err.Error())
+	}
+
+	registrantRef := fmt.Sprintf("%s#%s", registrant.Class, registrant.IdentificationNumber)
+	personalAsBytes, err := stub.GetPrivateData(collectionRegistrant, registrantRef)
+	if err != nil || personalAsBytes == nil {
+		return registrantAsBytes, nil // no access to the collection
+	}
+
+	personalData := RegistrantPersonalData{}
+	if err = json.Unmarshal(personalAsBytes, &personalData); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal personal data of registrant: %s", err.Error())
+	}
+	registrant.Name = personalData.Name
+	registrant.Initials = personalData.Initials
+	registrant.Address = &personalData.Address
+
+	return json.Marshal(registrant)
+}
+
+// redactRegistrantVersion - Remove the personal fields from a public version of a registrant
+func redactRegistrantVersion(registrantAsBytes []byte) ([]byte, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(registrantAsBytes, &fields); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal registrant: %s", err.Error())
+	}
+	for _, field := range registrantPersonalFields {
+		delete(fields, field)
+	}
+	return json.Marshal(fields)
+}
+
+// hasPublicPersonalHistory - Check if any public version of a registrant held personal data
+func hasPublicPersonalHistory(stub shim.ChaincodeStubInterface, registrantRef string) (bool, error) {
+	resultsIterator, err := stub.GetHistoryForKey(registrantRef)
+	if err != nil {
+		return false, fmt.Errorf("Failed to get registrant history: %s", err.Error())
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		modification, err := resultsIterator.Next()
+		if err != nil {
+			return false, err
+		}
+		if modification.IsDelete {
+			continue
+		}
+
+		var fields map[string]json.RawMessage
+		if err = json.Unmarshal(modification.Value, &fields); err != nil {
+			return false, fmt.Errorf("Failed to unmarshal registrant version %s: %s", modification.TxId, err.Error())
+		}
+		for _, field := range registrantPersonalFields {
+			if value, found := fields[field]; found && string(value) != `""` && string(value) != "null" {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// forgetRegistrant - Erase the personal data of a registrant and keep its ID as tombstoned pseudonym
+//
+// References to the registrant, e.g. vehicle owners and policy holders, keep resolving to the tombstone. Personal data
+// written to the public state before it moved to the collection is cleared too, as are the medical records of the
+// accidents the registrant was involved in. Copies which can't be erased, i.e. earlier public versions in the blocks and
+// the private write sets on member peers, are listed as retained in the receipt.
+func (t *InsuranceChaincode) forgetRegistrant(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, a registrant may only erase its own personal data
+	// 0=identificationNumber  1=reason
+	// 170632064               Request of data subject
+
+	if len(args) < 1 || len(args) > 2 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 1 and maximum of 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	reason := ""
+	if len(args) > 1 {
+		reason = args[1]
+	}
+
+	registrantRef := fmt.Sprintf("%s#%s", "base.Registrant", args[0])
+	if !caller.Admin && caller.ParticipantRef != registrantRef {
+		return shim.Error("Only the registrant itself may erase its personal data: " + caller.ParticipantRef)
+	}
+
+	// === Check if Registrant participant exists
+	registrantAsBytes, err := stub.GetState(registrantRef)
+	if err != nil {
+		return shim.Error("Failed to get registrant: " + err.Error())
+	} else if registrantAsBytes == nil {
+		return shim.Error("This registrant doesn't exists: " + registrantRef)
+	}
+
+	registrant := Registrant{}
+	if err = json.Unmarshal(registrantAsBytes, &registrant); err != nil {
+		return shim.Error("Failed to unmarshal registrant: " + err.Error())
+	}
+	if registrant.ErasedAt != nil {
+		return shim.Error("Personal data of the registrant is already erased at " + registrant.ErasedAt.Format(time.RFC3339))
+	}
+
+	// === Delete the personal data from the collection and the public registrant
+	var erasedFrom []string
+	personalAsBytes, err := stub.GetPrivateData(collectionRegistrant, registrantRef)
+	if err != nil {
+		return shim.Error("Failed to get personal data of registrant: " + err.Error())
+	}
+	if personalAsBytes != nil || registrant.PersonalDataHash != "" {
+		if err = stub.DelPrivateData(collectionRegistrant, registrantRef); err != nil {
+			return shim.Error("Failed to delete personal data of registrant: " + err.Error())
+		}
+		erasedFrom = append(erasedFrom, collectionRegistrant)
+	}
+	if registrant.Name != "" || registrant.Initials != "" || registrant.Address != nil {
+		registrant.Name = ""
+		registrant.Initials = ""
+		registrant.Address = nil
+		erasedFrom = append(erasedFrom, "publicState")
+	}
+
+	// === Delete the medical records of the accidents the registrant was involved in, the reports keep the person unlinked
+	medicalRecords, err := forgetInvolvedRegistrant(stub, registrantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if medicalRecords > 0 {
+		erasedFrom = append(erasedFrom, collectionMedical)
+	}
+
+	// === Copies outside the reach of the chaincode stay, the receipt must not claim otherwise
+	retainedIn := []string{}
+	if personalAsBytes != nil || registrant.PersonalDataHash != "" || medicalRecords > 0 {
+		retainedIn = append(retainedIn, retainedPrivateDataStore)
+	}
+	publicHistory, err := hasPublicPersonalHistory(stub, registrantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	} else if publicHistory {
+		retainedIn = append(retainedIn, retainedLedgerBlocks)
+	}
+
+	erasedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	registrant.ErasedAt = &erasedAt
+
+	// === Save the tombstone to state
+	registrantJSONasBytes, err := json.Marshal(registrant)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(registrantRef, registrantJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit ErasureReceipt event
+	erasureReceipt := &ErasureReceiptEvent{registrantRef, erasedAt, stub.GetTxID(), erasedFrom, registrant.PersonalDataHash, reason, retainedIn}
+	eventJSONasBytes, err := json.Marshal(erasureReceipt)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("ErasureReceiptEvent", eventJSONasBytes)
+
+	fmt.Println("- Personal data of registrant successfully erased")
+	return shim.Success(eventJSONasBytes)
+}
+
+// migrateRegistrantPersonalData - Move the personal data of registrants in the public state to the private collection
+//
+// Registrants registered before the collection existed keep their name and address in the public state. The salt of each
+// migrated record is derived from the master salt in the transient map and the registrant key, so it isn't recorded in
+// the transaction. Earlier public versions stay in the ledger history, see forgetRegistrant.
+func (t *InsuranceChaincode) migrateRegistrantPersonalData(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// Migration has no arguments, the master salt is passed in the transient map
+
+	if len(args) != 0 {
+		return shim.Error("Incorrect number of arguments. Expecting none")
+	}
+
+	transientMap, err := stub.GetTransient()
+	if err != nil {
+		return shim.Error("Failed to get transient map: " + err.Error())
+	}
+	masterSalt, found := transientMap[migrationTransientKey]
+	if !found || len(masterSalt) < minSaltLength {
+		return shim.Error(fmt.Sprintf("Master salt of at least %d characters must be passed in the transient map as %s", minSaltLength, migrationTransientKey))
+	}
+
+	registrantObjClass := "base.Registrant"
+	resultsIterator, err := stub.GetStateByRange(registrantObjClass+"#", registrantObjClass+"$")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	var assetList []AssetEntry
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		registrant := Registrant{}
+		if err = json.Unmarshal(queryResponse.Value, &registrant); err != nil {
+			return shim.Error("Failed to unmarshal registrant: " + err.Error())
+		}
+		if registrant.ErasedAt != nil || (registrant.Name == "" && registrant.Initials == "" && registrant.Address == nil) {
+			continue
+		}
+
+		// === Store the personal data in the private collection
+		address := AddressConcept{"base.Address", "", "", ""}
+		if registrant.Address != nil {
+			address = *registrant.Address
+		}
+		saltHash := sha256.Sum256([]byte(string(masterSalt) + "|" + queryResponse.Key))
+		personalData := &RegistrantPersonalData{"base.RegistrantPersonalData", registrant.IdentificationNumber, registrant.Name, registrant.Initials, address, hex.EncodeToString(saltHash[:])}
+		registrant.PersonalDataHash, err = putRegistrantPersonalData(stub, personalData)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		// === Strip the personal data from the public registrant
+		registrant.Name = ""
+		registrant.Initials = ""
+		registrant.Address = nil
+		registrantJSONasBytes, err := json.Marshal(registrant)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.PutState(queryResponse.Key, registrantJSONasBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+		assetList = append(assetList, AssetEntry{registrantObjClass, registrant.IdentificationNumber})
+	}
+
+	assetsJSONasBytes, err := json.Marshal(assetList)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	fmt.Println("- Personal data of registrants successfully migrated")
+	return shim.Success(assetsJSONasBytes)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// registrantTransient - Personal data of the test registrant as passed in the transient map
+const registrantTransient = `{"name":"Smith","initials":"J.","addressLine1":"28 Clinton Ave","addressLine2":"Jersey City, NJ 07304","salt":"9c1d7a52e4b0f836"}`
+
+func TestRegisterRegistrant(t *testing.T) {
+	tests := []struct {
+		name      string
+		transient string
+		wantErr   bool
+	}{
+		{"personal data in transient map", registrantTransient, false},
+		{"without transient map", "", true},
+		{"short salt", `{"name":"Smith","addressLine1":"28 Clinton Ave","addressLine2":"Jersey City, NJ 07304","salt":"9c1d"}`, true},
+		{"without address", `{"name":"Smith","salt":"9c1d7a52e4b0f836"}`, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newTestStub(t, nil)
+			stub.TransientMap = map[string][]byte{registrantTransientKey: []byte(test.transient)}
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.registerRegistrant(stub, testCaller(""), []string{"170632064", "INDIVIDUAL"})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("registerRegistrant status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			// === The public registrant only holds the hash of the private record
+			registrant := Registrant{}
+			stub.get(t, "base.Registrant#170632064", &registrant)
+			personalAsBytes := stub.PvtState[collectionRegistrant]["base.Registrant#170632064"]
+			hash := sha256.Sum256(personalAsBytes)
+			if registrant.Name != "" || registrant.Address != nil || registrant.PersonalDataHash != hex.EncodeToString(hash[:]) {
+				t.Errorf("public registrant = %+v, want no personal data and the hash of the private record", registrant)
+			}
+		})
+	}
+}
+
+func TestReadRegistrant(t *testing.T) {
+	tests := []struct {
+		name     string
+		denied   bool
+		wantName string
+	}{
+		{"member of the collection", false, "Smith"},
+		{"outside the collection", true, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newTestStub(t, nil)
+			stub.TransientMap = map[string][]byte{registrantTransientKey: []byte(registrantTransient)}
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.registerRegistrant(stub, testCaller(""), []string{"170632064", "INDIVIDUAL"})
+			})
+			if response.Status != shim.OK {
+				t.Fatalf("registerRegistrant status = %d %s", response.Status, response.Message)
+			}
+
+			stub.deniedCollections[collectionRegistrant] = test.denied
+			response = stub.call(t, testTxTime, func() pb.Response {
+				return cc.readAssetData(stub, testCaller("base.Insurer#AXA Insurance"), []string{"base.Registrant", "170632064"})
+			})
+			if response.Status != shim.OK {
+				t.Fatalf("readAssetData status = %d %s", response.Status, response.Message)
+			}
+
+			registrant := Registrant{}
+			if err := json.Unmarshal(response.Payload, &registrant); err != nil {
+				t.Fatal(err)
+			}
+			if registrant.Name != test.wantName || (registrant.Address != nil) != (test.wantName != "") || registrant.PersonalDataHash == "" {
+				t.Errorf("registrant = %+v, want name %q", registrant, test.wantName)
+			}
+		})
+	}
+}
+
+func TestMigrateRegistrantPersonalData(t *testing.T) {
+	address := &AddressConcept{"base.Address", "28 Clinton Ave", "Jersey City, NJ 07304", ""}
+	cc, stub := newTestStub(t, map[string]interface{}{
+		"base.Registrant#170632064": &Registrant{Class: "base.Registrant", IdentificationNumber: "170632064", LegalEntity: "INDIVIDUAL", Name: "Smith", Initials: "J.", Address: address},
+		"base.Registrant#908123765": &Registrant{Class: "base.Registrant", IdentificationNumber: "908123765", LegalEntity: "LEASER", Name: "AutoLease"},
+		"base.Registrant#908123764": &Registrant{Class: "base.Registrant", IdentificationNumber: "908123764", LegalEntity: "INDIVIDUAL", PersonalDataHash: "3f2a"},
+		"base.Registrant#908123763": &Registrant{Class: "base.Registrant", IdentificationNumber: "908123763", LegalEntity: "INDIVIDUAL", ErasedAt: &testTxTime},
+	})
+
+	// === The master salt is required
+	response := stub.call(t, testTxTime, func() pb.Response {
+		return cc.migrateRegistrantPersonalData(stub, []string{})
+	})
+	if response.Status == shim.OK {
+		t.Fatal("migrateRegistrantPersonalData migrated without master salt")
+	}
+
+	stub.TransientMap = map[string][]byte{migrationTransientKey: []byte("4e8b1f0c7a2d9e65")}
+	response = stub.call(t, testTxTime, func() pb.Response {
+		return cc.migrateRegistrantPersonalData(stub, []string{})
+	})
+	if response.Status != shim.OK {
+		t.Fatalf("migrateRegistrantPersonalData status = %d %s", response.Status, response.Message)
+	}
+	var migrated []AssetEntry
+	if err := json.Unmarshal(response.Payload, &migrated); err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated) != 2 {
+		t.Fatalf("migrated %v, want the 2 registrants with public personal data", migrated)
+	}
+
+	for _, registrantRef := range []string{"base.Registrant#170632064", "base.Registrant#908123765"} {
+		registrant, personalData := Registrant{}, RegistrantPersonalData{}
+		stub.get(t, registrantRef, &registrant)
+		personalAsBytes := stub.PvtState[collectionRegistrant][registrantRef]
+		if err := json.Unmarshal(personalAsBytes, &personalData); err != nil {
+			t.Fatalf("%s: %s", registrantRef, err)
+		}
+		hash := sha256.Sum256(personalAsBytes)
+		if registrant.Name != "" || registrant.Initials != "" || registrant.Address != nil || registrant.PersonalDataHash != hex.EncodeToString(hash[:]) {
+			t.Errorf("%s: public registrant = %+v, want no personal data and the hash of the private record", registrantRef, registrant)
+		}
+		if personalData.Name == "" || len(personalData.Salt) < minSaltLength {
+			t.Errorf("%s: personal data = %+v, want the name and a derived salt", registrantRef, personalData)
+		}
+	}
+}
+
+func TestForgetRegistrant(t *testing.T) {
+	address := &AddressConcept{"base.Address", "28 Clinton Ave", "Jersey City, NJ 07304", ""}
+	tests := []struct {
+		name           string
+		registrant     *Registrant // registered through the collection when nil
+		caller         string
+		wantErr        bool
+		wantErasedFrom []string
+		wantRetainedIn []string
+	}{
+		{"registered through the collection", nil, "base.Registrant#170632064", false,
+			[]string{collectionRegistrant, collectionMedical}, []string{retainedPrivateDataStore}},
+		{"personal data in the public state", &Registrant{Class: "base.Registrant", IdentificationNumber: "170632064", LegalEntity: "INDIVIDUAL", Name: "Smith", Address: address}, "base.Registrant#170632064", false,
+			[]string{"publicState", collectionMedical}, []string{retainedPrivateDataStore, retainedLedgerBlocks}},
+		{"by admin", nil, "", false,
+			[]string{collectionRegistrant, collectionMedical}, []string{retainedPrivateDataStore}},
+		{"by other registrant", nil, "base.Registrant#908123765", true, nil, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newTestStub(t, map[string]interface{}{
+				"accident.AccidentReport#1534180781": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180781", OccuredAt: testTxTime, Status: "RESPONDING",
+					InvolvedPersons: []PersonConcept{
+						{"accident.Person", "1", "DRIVER", "base.Registrant#170632064", "", "9a0c", nil},
+						{"accident.Person", "2", "PEDESTRIAN", "", "Cyclist", "41be", nil},
+					}},
+			})
+			if test.registrant != nil {
+				stub.put(t, map[string]interface{}{"base.Registrant#170632064": test.registrant})
+			} else {
+				stub.TransientMap = map[string][]byte{registrantTransientKey: []byte(registrantTransient)}
+				response := stub.call(t, testTxTime, func() pb.Response {
+					return cc.registerRegistrant(stub, testCaller(""), []string{"170632064", "INDIVIDUAL"})
+				})
+				if response.Status != shim.OK {
+					t.Fatalf("registerRegistrant status = %d %s", response.Status, response.Message)
+				}
+			}
+			stub.call(t, testTxTime, func() pb.Response {
+				for _, personID := range []string{"1", "2"} {
+					if err := stub.PutPrivateData(collectionMedical, medicalRecordKey("1534180781", personID), []byte(`{"injurySeverity":"MINOR"}`)); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := putAssetIndexes(stub, "accident.AccidentReport", "1534180781", stub.State["accident.AccidentReport#1534180781"]); err != nil {
+					t.Fatal(err)
+				}
+				return shim.Success(nil)
+			})
+
+			caller := testCaller(test.caller)
+			caller.Admin = test.caller == ""
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.forgetRegistrant(stub, caller, []string{"170632064", "Request of data subject"})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("forgetRegistrant status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			erasureReceipt := ErasureReceiptEvent{}
+			if err := json.Unmarshal(response.Payload, &erasureReceipt); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(erasureReceipt.ErasedFrom, test.wantErasedFrom) || !reflect.DeepEqual(erasureReceipt.RetainedIn, test.wantRetainedIn) {
+				t.Errorf("receipt erased from %v retained in %v, want %v and %v", erasureReceipt.ErasedFrom, erasureReceipt.RetainedIn, test.wantErasedFrom, test.wantRetainedIn)
+			}
+
+			// === Personal and medical data of the registrant is gone, the other person keeps its medical record
+			registrant := Registrant{}
+			stub.get(t, "base.Registrant#170632064", &registrant)
+			if registrant.Name != "" || registrant.Address != nil || registrant.ErasedAt == nil {
+				t.Errorf("registrant = %+v, want a tombstone", registrant)
+			}
+			if stub.PvtState[collectionRegistrant]["base.Registrant#170632064"] != nil {
+				t.Error("personal data is still in the collection")
+			}
+			if stub.PvtState[collectionMedical][medicalRecordKey("1534180781", "1")] != nil || stub.PvtState[collectionMedical][medicalRecordKey("1534180781", "2")] == nil {
+				t.Error("medical record of the registrant is still in the collection, or the one of the other person is erased")
+			}
+
+			accidentReport := AccidentReport{}
+			stub.get(t, "accident.AccidentReport#1534180781", &accidentReport)
+			if person := accidentReport.InvolvedPersons[0]; person.Registrant != "" || person.MedicalDataHash != "9a0c" {
+				t.Errorf("involved person = %+v, want it unlinked with the hash of the erased record", person)
+			}
+			if reportIDs, _ := getIndexedAssetIDs(stub, reportPersonIndex, "170632064"); len(reportIDs) != 0 {
+				t.Errorf("reports of the registrant = %v, want none", reportIDs)
+			}
+
+			// === Personal data is erased once
+			response = stub.call(t, testTxTime, func() pb.Response {
+				return cc.forgetRegistrant(stub, caller, []string{"170632064"})
+			})
+			if response.Status == shim.OK {
+				t.Error("forgetRegistrant erased a tombstone")
+			}
+		})
+	}
+}
@@ -0,0 +1,641 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Repair Order Definitions - Repair work of an accepted quote from scheduling to invoice
+// ============================================================================================================================
+
+// repairOrderTransitions - allowed status transitions of a repair order
+var repairOrderTransitions = map[string][]string{
+	"SCHEDULED":   {"IN_PROGRESS"},
+	"IN_PROGRESS": {"COMPLETED"},
+	"COMPLETED":   {"INVOICED"},
+}
+
+// Supplement status values
+const (
+	supplementPending  = "PENDING"
+	supplementApproved = "APPROVED"
+	supplementRejected = "REJECTED"
+)
+
+// ActualCostConcept - actual cost type, reported against an estimate of the quote or an approved supplement
+type ActualCostConcept struct {
+	Class      string          `json:"$class"`               // vehiclerepair.ActualCost
+	Estimate   int             `json:"estimate,omitempty"`   // number of the estimate of the quote, starting at 1
+	Supplement int             `json:"supplement,omitempty"` // number of the supplement, starting at 1
+	Actual     EstimateConcept `json:"actual"`
+	Variance   Money           `json:"variance"` // actual total cost - estimated total cost
+}
+
+// SupplementConcept - supplement type, additional work for hidden damage which needs approval of the insurer
+type SupplementConcept struct {
+	Class     string          `json:"$class"` // vehiclerepair.Supplement
+	Number    int             `json:"number"`
+	Reason    string          `json:"reason"`
+	Estimate  EstimateConcept `json:"estimate"`
+	Status    string          `json:"status"` // This can be PENDING, APPROVED or REJECTED
+	FiledAt   time.Time       `json:"filedAt"`
+	DecidedBy string          `json:"decidedBy,omitempty"` // Insurer class name + # + tradeName
+	DecidedAt *time.Time      `json:"decidedAt,omitempty"`
+	Remarks   string          `json:"remarks,omitempty"`
+}
+
+// InvoiceConcept - invoice type, the actual costs of the estimates and approved supplements with tax
+type InvoiceConcept struct {
+	Class         string     `json:"$class"` // vehiclerepair.Invoice
+	InvoiceNumber string     `json:"invoiceNumber"`
+	IssuedAt      time.Time  `json:"issuedAt"`
+	TotalParts    Money      `json:"totalParts"`
+	TotalLabor    Money      `json:"totalLabor"`
+	TotalRefinish Money      `json:"totalRefinish"`
+	Tax           Percentage `json:"tax"` // tax rate of the quote in percent
+	TaxAmount     Money      `json:"taxAmount"`
+	Total         Money      `json:"total"`
+}
+
+// RepairOrder - asset type of repair order
+type RepairOrder struct {
+	Class            string              `json:"$class"` // vehiclerepair.RepairOrder
+	OrderID          string              `json:"orderId"`
+	RepairQuote      string              `json:"repairQuote"`      // Repair quote class name + # + quoteId
+	RepairShop       string              `json:"repairShop"`       // Repair shop class name + # + tradeName
+	VehicleInsurance string              `json:"vehicleInsurance"` // Insurance policy class name + # + policyId, its insurer approves supplements
+	Status           string              `json:"status"`           // This can be SCHEDULED, IN_PROGRESS, COMPLETED or INVOICED
+	ScheduledFor     time.Time           `json:"scheduledFor"`
+	StartedAt        *time.Time          `json:"startedAt,omitempty"`
+	CompletedAt      *time.Time          `json:"completedAt,omitempty"`
+	ActualCosts      []ActualCostConcept `json:"actualCosts,omitempty"`
+	Supplements      []SupplementConcept `json:"supplements,omitempty"`
+	Invoice          *InvoiceConcept     `json:"invoice,omitempty"`
+	InsuranceClaim   string              `json:"insuranceClaim,omitempty"` // Insurance claim class name + # + claimId, set when the claim is sent or on invoicing
+}
+
+// getRepairOrder - Get a repair order and its quote
+func getRepairOrder(stub shim.ChaincodeStubInterface, orderID string) (*RepairOrder, *RepairQuote, error) {
+	// === Check if RepairOrder asset exists
+	orderRef := fmt.Sprintf("%s#%s", "vehiclerepair.RepairOrder", orderID)
+	orderAsBytes, err := stub.GetState(orderRef)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get repair order: %s", err.Error())
+	} else if orderAsBytes == nil {
+		return nil, nil, fmt.Errorf("This repair order doesn't exists: %s", orderRef)
+	}
+
+	repairOrder := &RepairOrder{}
+	if err = json.Unmarshal(orderAsBytes, repairOrder); err != nil {
+		return nil, nil, fmt.Errorf("Failed to unmarshal repair order: %s", err.Error())
+	}
+
+	// === Get the quote of the order
+	quoteAsBytes, err := stub.GetState(repairOrder.RepairQuote)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Failed to get repair quote: %s", err.Error())
+	} else if quoteAsBytes == nil {
+		return nil, nil, fmt.Errorf("Repair quote of order doesn't exists: %s", repairOrder.RepairQuote)
+	}
+
+	repairQuote := &RepairQuote{}
+	if err = json.Unmarshal(quoteAsBytes, repairQuote); err != nil {
+		return nil, nil, fmt.Errorf("Failed to unmarshal repair quote: %s", err.Error())
+	}
+	return repairOrder, repairQuote, nil
+}
+
+// getRepairOrderForShop - Get a repair order and its quote, and check the repair shop carries it out
+func getRepairOrderForShop(stub shim.ChaincodeStubInterface, orderID string, shopRef string) (*RepairOrder, *RepairQuote, error) {
+	repairOrder, repairQuote, err := getRepairOrder(stub, orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if repairOrder.RepairShop != shopRef {
+		return nil, nil, fmt.Errorf("Only the repair shop of the order may update it: %s", shopRef)
+	}
+	return repairOrder, repairQuote, nil
+}
+
+// updateRepairOrder - Move a repair order to a new (or the same) status, store into state and emit RepairOrderUpdate event
+func updateRepairOrder(stub shim.ChaincodeStubInterface, repairOrder *RepairOrder, status string, reason string) pb.Response {
+	// === Check if status transition is allowed
+	if status != repairOrder.Status && !isAllowedTransition(repairOrderTransitions, repairOrder.Status, status) {
+		return shim.Error(fmt.Sprintf("Repair order can't move from %s to %s", repairOrder.Status, status))
+	}
+	repairOrder.Status = status
+
+	// === Save repair order to state ===
+	orderJSONasBytes, err := json.Marshal(repairOrder)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	orderRef := fmt.Sprintf("%s#%s", repairOrder.Class, repairOrder.OrderID)
+	err = stub.PutState(orderRef, orderJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit RepairOrderUpdate event ===
+	orderUpdate := &RepairOrderUpdateEvent{repairOrder.OrderID, repairOrder.RepairQuote, status, reason}
+	eventJSONasBytes, err := json.Marshal(orderUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("RepairOrderUpdateEvent", eventJSONasBytes)
+
+	fmt.Println("- Repair order successfully updated")
+	return shim.Success(eventJSONasBytes)
+}
+
+// linkRepairOrderClaim - Link a repair order to the claim paying its quote, unless it's linked already
+func linkRepairOrderClaim(stub shim.ChaincodeStubInterface, orderRef string, claimRef string) error {
+	orderAsBytes, err := stub.GetState(orderRef)
+	if err != nil {
+		return fmt.Errorf("Failed to get repair order: %s", err.Error())
+	} else if orderAsBytes == nil {
+		return fmt.Errorf("Repair order of quote doesn't exists: %s", orderRef)
+	}
+
+	repairOrder := &RepairOrder{}
+	if err = json.Unmarshal(orderAsBytes, repairOrder); err != nil {
+		return fmt.Errorf("Failed to unmarshal repair order: %s", err.Error())
+	}
+	if repairOrder.InsuranceClaim != "" {
+		return nil
+	}
+
+	// === Save repair order to state, the status is unchanged so no RepairOrderUpdate event is emitted
+	repairOrder.InsuranceClaim = claimRef
+	orderJSONasBytes, err := json.Marshal(repairOrder)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(orderRef, orderJSONasBytes)
+}
+
+// createRepairOrder - Schedule the repair of an accepted quote by the repair shop which offered it
+func (t *InsuranceChaincode) createRepairOrder(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=quoteId     1=scheduledFor
+	// 1534180999    2018-08-28T08:00:00.000Z
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	scheduledFor, err := time.Parse(time.RFC3339, args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a RFC3339 dateTime string")
+	}
+
+	// === Check if RepairQuote asset exists
+	quoteRef := fmt.Sprintf("%s#%s", "vehiclerepair.RepairQuote", args[0])
+	quoteAsBytes, err := stub.GetState(quoteRef)
+	if err != nil {
+		return shim.Error("Failed to get repair quote: " + err.Error())
+	} else if quoteAsBytes == nil {
+		return shim.Error("Given repair quote doesn't exists: " + quoteRef)
+	}
+
+	repairQuote := RepairQuote{}
+	if err = json.Unmarshal(quoteAsBytes, &repairQuote); err != nil {
+		return shim.Error("Failed to unmarshal repair quote: " + err.Error())
+	}
+
+	// === Only the shop of an accepted quote can schedule it, once
+	if repairQuote.Estimator != caller.ParticipantRef {
+		return shim.Error("Only the repair shop which offered the quote may schedule the repair: " + caller.ParticipantRef)
+	}
+	if repairQuote.Status != "ACCEPTED" {
+		return shim.Error("Given repair quote isn't accepted: " + quoteRef)
+	}
+	if repairQuote.RepairOrder != "" {
+		return shim.Error("Given repair quote is already scheduled in " + repairQuote.RepairOrder)
+	}
+
+	// === Get the policy of the quote request, its insurer approves supplements
+	requestAsBytes, err := stub.GetState(repairQuote.QuoteRequest)
+	if err != nil {
+		return shim.Error("Failed to get quote request: " + err.Error())
+	} else if requestAsBytes == nil {
+		return shim.Error("Quote request of repair quote doesn't exists: " + repairQuote.QuoteRequest)
+	}
+
+	quoteRequest := QuoteRequest{}
+	if err = json.Unmarshal(requestAsBytes, &quoteRequest); err != nil {
+		return shim.Error("Failed to unmarshal quote request: " + err.Error())
+	}
+	if quoteRequest.AwardedQuote != quoteRef {
+		return shim.Error("Given repair quote isn't awarded for its quote request: " + quoteRef)
+	}
+
+	// === Create repair order object
+	orderObjClass := "vehiclerepair.RepairOrder"
+	orderID, err := newAssetID(stub, orderObjClass, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	orderRef := fmt.Sprintf("%s#%s", orderObjClass, orderID)
+	repairOrder := &RepairOrder{orderObjClass, orderID, quoteRef, caller.ParticipantRef, quoteRequest.VehicleInsurance, "SCHEDULED", scheduledFor, nil, nil, nil, nil, nil, ""}
+
+	// === Link the quote to its order
+	repairQuote.RepairOrder = orderRef
+	quoteJSONasBytes, err := json.Marshal(repairQuote)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(quoteRef, quoteJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	return updateRepairOrder(stub, repairOrder, "SCHEDULED", "Repair scheduled for "+scheduledFor.Format(time.RFC3339))
+}
+
+// startRepair - Start the work of a scheduled repair order
+func (t *InsuranceChaincode) startRepair(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=orderId
+	// 1535011200-5f3e2a1b
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	repairOrder, _, err := getRepairOrderForShop(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	startedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	repairOrder.StartedAt = &startedAt
+	return updateRepairOrder(stub, repairOrder, "IN_PROGRESS", "Repair started")
+}
+
+// reportActualCosts - Report the actual costs of estimates and approved supplements of a repair order in progress
+func (t *InsuranceChaincode) reportActualCosts(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller, a reported line replaces the earlier report of that line
+	// 0=orderId              1=json{actualCosts[]}
+	// 1535011200-5f3e2a1b    [{"estimate":1,"type":"REPAIR","description":"Scratch removal","costOfLabor":120},{"supplement":1,...}]
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	repairOrder, repairQuote, err := getRepairOrderForShop(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if repairOrder.Status != "IN_PROGRESS" {
+		return shim.Error("Actual costs can only be reported while the repair is in progress, it is " + repairOrder.Status)
+	}
+
+	// === Unmarshal the referenced lines and their costs
+	var lines []struct {
+		Estimate   int `json:"estimate"`
+		Supplement int `json:"supplement"`
+	}
+	if err = json.Unmarshal([]byte(args[1]), &lines); err != nil {
+		return shim.Error("Failed to unmarshal actual cost array: " + err.Error())
+	}
+	actuals, err := parseEstimates([]byte(args[1]), repairQuote.Total.Currency)
+	if err != nil {
+		return shim.Error("Failed to unmarshal actual cost array: " + err.Error())
+	}
+
+	for i, line := range lines {
+		// === Find the estimated line
+		var estimated EstimateConcept
+		switch {
+		case line.Estimate > 0 && line.Supplement == 0:
+			if line.Estimate > len(repairQuote.Estimates) {
+				return shim.Error(fmt.Sprintf("Actual cost %d refers to unknown estimate %d", i+1, line.Estimate))
+			}
+			estimated = repairQuote.Estimates[line.Estimate-1]
+		case line.Supplement > 0 && line.Estimate == 0:
+			if line.Supplement > len(repairOrder.Supplements) || repairOrder.Supplements[line.Supplement-1].Status != supplementApproved {
+				return shim.Error(fmt.Sprintf("Actual cost %d refers to supplement %d which isn't approved", i+1, line.Supplement))
+			}
+			estimated = repairOrder.Supplements[line.Supplement-1].Estimate
+		default:
+			return shim.Error(fmt.Sprintf("Actual cost %d must refer to either an estimate or a supplement", i+1))
+		}
+
+		variance, err := actuals[i].TotalCost.Sub(estimated.TotalCost)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		actualCost := ActualCostConcept{"vehiclerepair.ActualCost", line.Estimate, line.Supplement, actuals[i], variance}
+
+		// === Replace an earlier report of the line
+		replaced := false
+		for j, reported := range repairOrder.ActualCosts {
+			if reported.Estimate == line.Estimate && reported.Supplement == line.Supplement {
+				repairOrder.ActualCosts[j] = actualCost
+				replaced = true
+			}
+		}
+		if !replaced {
+			repairOrder.ActualCosts = append(repairOrder.ActualCosts, actualCost)
+		}
+	}
+
+	return updateRepairOrder(stub, repairOrder, repairOrder.Status, fmt.Sprintf("Actual costs reported for %d lines", len(lines)))
+}
+
+// fileSupplement - File additional work for hidden damage, which needs approval of the insurer
+func (t *InsuranceChaincode) fileSupplement(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=orderId              1=reason                          2=json{estimate}
+	// 1535011200-5f3e2a1b    Bent frame behind rear bumper     {"type":"REPAIR","description":"Frame straightening","costOfLabor":450}
+
+	if len(args) != 3 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 3")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+
+	repairOrder, repairQuote, err := getRepairOrderForShop(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if repairOrder.Status != "IN_PROGRESS" {
+		return shim.Error("Supplements can only be filed while the repair is in progress, it is " + repairOrder.Status)
+	}
+
+	estimates, err := parseEstimates([]byte("["+args[2]+"]"), repairQuote.Total.Currency)
+	if err != nil {
+		return shim.Error("Failed to unmarshal supplement estimate: " + err.Error())
+	}
+
+	filedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	number := len(repairOrder.Supplements) + 1
+	supplement := SupplementConcept{"vehiclerepair.Supplement", number, args[1], estimates[0], supplementPending, filedAt, "", nil, ""}
+	repairOrder.Supplements = append(repairOrder.Supplements, supplement)
+
+	return updateRepairOrder(stub, repairOrder, repairOrder.Status, fmt.Sprintf("Supplement %d filed: %s", number, args[1]))
+}
+
+// decideSupplement - Approve or reject a supplement by the insurer of the policy the repair was requested for
+func (t *InsuranceChaincode) decideSupplement(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the insurer is the caller
+	// 0=orderId              1=supplement  2=decision  3=remarks
+	// 1535011200-5f3e2a1b    1             APPROVED    Confirmed by photos
+
+	if len(args) != 4 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 4")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	number, err := strconv.Atoi(args[1])
+	if err != nil {
+		return shim.Error("2nd argument must be a valid integer")
+	}
+	decision := strings.ToUpper(args[2])
+	if decision != supplementApproved && decision != supplementRejected {
+		return shim.Error("3rd argument must be APPROVED or REJECTED")
+	}
+
+	repairOrder, _, err := getRepairOrder(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check if the caller insures the vehicle of the order
+	policyAsBytes, err := stub.GetState(repairOrder.VehicleInsurance)
+	if err != nil {
+		return shim.Error("Failed to get insurance policy: " + err.Error())
+	} else if policyAsBytes == nil {
+		return shim.Error("Insurance policy of repair order doesn't exists: " + repairOrder.VehicleInsurance)
+	}
+
+	insurancePolicy := InsurancePolicy{}
+	if err = json.Unmarshal(policyAsBytes, &insurancePolicy); err != nil {
+		return shim.Error("Failed to unmarshal insurance policy: " + err.Error())
+	}
+	if insurancePolicy.IssuedBy != caller.ParticipantRef {
+		return shim.Error("Only the insurer of the vehicle may decide on supplements: " + caller.ParticipantRef)
+	}
+
+	// === Check if supplement is pending
+	if number < 1 || number > len(repairOrder.Supplements) {
+		return shim.Error(fmt.Sprintf("Repair order has no supplement %d", number))
+	}
+	supplement := &repairOrder.Supplements[number-1]
+	if supplement.Status != supplementPending {
+		return shim.Error(fmt.Sprintf("Supplement %d is already %s", number, supplement.Status))
+	}
+
+	decidedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	supplement.Status = decision
+	supplement.DecidedBy = caller.ParticipantRef
+	supplement.DecidedAt = &decidedAt
+	supplement.Remarks = args[3]
+
+	return updateRepairOrder(stub, repairOrder, repairOrder.Status, fmt.Sprintf("Supplement %d %s", number, strings.ToLower(decision)))
+}
+
+// completeRepair - Complete a repair order once all work is reported and no supplement is pending
+func (t *InsuranceChaincode) completeRepair(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=orderId
+	// 1535011200-5f3e2a1b
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	repairOrder, repairQuote, err := getRepairOrderForShop(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check all estimates and approved supplements have actual costs
+	if _, err = invoiceLines(repairOrder, repairQuote); err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, supplement := range repairOrder.Supplements {
+		if supplement.Status == supplementPending {
+			return shim.Error(fmt.Sprintf("Supplement %d is still pending approval", supplement.Number))
+		}
+	}
+
+	completedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	repairOrder.CompletedAt = &completedAt
+	return updateRepairOrder(stub, repairOrder, "COMPLETED", "Repair completed")
+}
+
+// invoiceLines - Get the actual costs of all estimates and approved supplements, fails if one wasn't reported
+func invoiceLines(repairOrder *RepairOrder, repairQuote *RepairQuote) ([]EstimateConcept, error) {
+	reported := make(map[string]EstimateConcept)
+	for _, actualCost := range repairOrder.ActualCosts {
+		reported[fmt.Sprintf("%d/%d", actualCost.Estimate, actualCost.Supplement)] = actualCost.Actual
+	}
+
+	var lines []EstimateConcept
+	for i := range repairQuote.Estimates {
+		actual, found := reported[fmt.Sprintf("%d/%d", i+1, 0)]
+		if !found {
+			return nil, fmt.Errorf("Actual cost of estimate %d isn't reported", i+1)
+		}
+		lines = append(lines, actual)
+	}
+	for _, supplement := range repairOrder.Supplements {
+		if supplement.Status != supplementApproved {
+			continue
+		}
+		actual, found := reported[fmt.Sprintf("%d/%d", 0, supplement.Number)]
+		if !found {
+			return nil, fmt.Errorf("Actual cost of supplement %d isn't reported", supplement.Number)
+		}
+		lines = append(lines, actual)
+	}
+	return lines, nil
+}
+
+// invoiceRepair - Invoice a completed repair order and link the invoice to the insurance claim of the quote
+func (t *InsuranceChaincode) invoiceRepair(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=orderId              1=invoiceNumber
+	// 1535011200-5f3e2a1b    INV-2018-0815
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	repairOrder, repairQuote, err := getRepairOrderForShop(stub, args[0], caller.ParticipantRef)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !isAllowedTransition(repairOrderTransitions, repairOrder.Status, "INVOICED") {
+		return shim.Error(fmt.Sprintf("Repair order can't move from %s to %s", repairOrder.Status, "INVOICED"))
+	}
+
+	lines, err := invoiceLines(repairOrder, repairQuote)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Calculate totals, tax is rounded half away from zero once over the sum of all lines
+	currency := repairQuote.Total.Currency
+	totalParts := Money{0, currency}
+	totalLabor := Money{0, currency}
+	totalRefinish := Money{0, currency}
+	totalLines := Money{0, currency}
+	for _, line := range lines {
+		if totalParts, err = totalParts.Add(line.CostOfParts); err != nil {
+			return shim.Error(err.Error())
+		}
+		if totalLabor, err = totalLabor.Add(line.CostOfLabor); err != nil {
+			return shim.Error(err.Error())
+		}
+		if totalRefinish, err = totalRefinish.Add(line.CostOfRefinish); err != nil {
+			return shim.Error(err.Error())
+		}
+		if totalLines, err = totalLines.Add(line.TotalCost); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	taxAmount, err := totalLines.Percent(repairQuote.Tax)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	total, err := totalLines.Add(taxAmount)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	issuedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	repairOrder.Invoice = &InvoiceConcept{"vehiclerepair.Invoice", args[1], issuedAt, totalParts, totalLabor, totalRefinish, repairQuote.Tax, taxAmount, total}
+
+	// === Link the order and the claim paying the quote to each other
+	orderRef := fmt.Sprintf("%s#%s", repairOrder.Class, repairOrder.OrderID)
+	claimRecords, err := getIndexedAssets(stub, assetIDFromRef(repairOrder.VehicleInsurance), claimClaimantIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, claimRecord := range claimRecords {
+		insuranceClaim := &InsuranceClaim{}
+		if err = json.Unmarshal(claimRecord.Record, insuranceClaim); err != nil {
+			return shim.Error(fmt.Sprintf("Failed to unmarshal insurance claim %s: %s", claimRecord.Key, err.Error()))
+		}
+		if insuranceClaim.CostOfRepair != repairOrder.RepairQuote || insuranceClaim.Status == "DECLINED" {
+			continue
+		}
+
+		insuranceClaim.RepairOrder = orderRef
+		if err = putClaim(stub, insuranceClaim); err != nil {
+			return shim.Error(err.Error())
+		}
+		repairOrder.InsuranceClaim = claimRecord.Key
+		break
+	}
+
+	return updateRepairOrder(stub, repairOrder, "INVOICED", fmt.Sprintf("Invoice %s over %s", args[1], total))
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// repairStep - Step of carrying out a repair order
+type repairStep struct {
+	name       string
+	caller     *Caller
+	function   func(shim.ChaincodeStubInterface, *Caller, []string) pb.Response
+	args       []string
+	wantErr    bool
+	wantStatus string // of the order after the step
+}
+
+// createTestRepairOrder - Schedule the repair of the test quote by its repair shop and get the order ID
+func createTestRepairOrder(t *testing.T, cc *InsuranceChaincode, stub *testStub) string {
+	response := stub.call(t, testTxTime, func() pb.Response {
+		return cc.createRepairOrder(stub, testCaller("base.RepairShop#Joe's Garage"), []string{"1534180999", "2018-08-28T08:00:00Z"})
+	})
+	if response.Status != shim.OK {
+		t.Fatalf("createRepairOrder status = %d %s", response.Status, response.Message)
+	}
+
+	orderUpdate := RepairOrderUpdateEvent{}
+	if err := json.Unmarshal(response.Payload, &orderUpdate); err != nil {
+		t.Fatal(err)
+	}
+	return orderUpdate.OrderID
+}
+
+// runRepairSteps - Run the steps on a repair order and check its status after each step
+func runRepairSteps(t *testing.T, stub *testStub, orderID string, steps []repairStep) {
+	for _, step := range steps {
+		response := stub.call(t, testTxTime, func() pb.Response {
+			return step.function(stub, step.caller, step.args)
+		})
+		if (response.Status != shim.OK) != step.wantErr {
+			t.Fatalf("%s: status = %d %s, want error %t", step.name, response.Status, response.Message, step.wantErr)
+		}
+
+		repairOrder := RepairOrder{}
+		stub.get(t, "vehiclerepair.RepairOrder#"+orderID, &repairOrder)
+		if repairOrder.Status != step.wantStatus {
+			t.Fatalf("%s: order status = %s, want %s", step.name, repairOrder.Status, step.wantStatus)
+		}
+	}
+}
+
+// invoiceTestRepair - Carry out and invoice the test repair order without supplements
+func invoiceTestRepair(t *testing.T, cc *InsuranceChaincode, stub *testStub, orderID string) {
+	shop := testCaller("base.RepairShop#Joe's Garage")
+	runRepairSteps(t, stub, orderID, []repairStep{
+		{"start", shop, cc.startRepair, []string{orderID}, false, "IN_PROGRESS"},
+		{"report actual costs", shop, cc.reportActualCosts, []string{orderID, `[{"estimate":1,"type":"REPAIR","description":"Scratch removal","costOfLabor":120}]`}, false, "IN_PROGRESS"},
+		{"complete", shop, cc.completeRepair, []string{orderID}, false, "COMPLETED"},
+		{"invoice", shop, cc.invoiceRepair, []string{orderID, "INV-2018-0815"}, false, "INVOICED"},
+	})
+}
+
+func TestRepairOrderLifecycle(t *testing.T) {
+	cc, stub := newClaimStub(t)
+	shop, otherShop := testCaller("base.RepairShop#Joe's Garage"), testCaller("base.RepairShop#Other Garage")
+	insurer, otherInsurer := testCaller("base.Insurer#Allsecur Insurance"), testCaller("base.Insurer#AXA Insurance")
+
+	// === Only the shop of the accepted quote schedules it, once
+	response := stub.call(t, testTxTime, func() pb.Response {
+		return cc.createRepairOrder(stub, otherShop, []string{"1534180999", "2018-08-28T08:00:00Z"})
+	})
+	if response.Status == shim.OK {
+		t.Error("createRepairOrder scheduled the quote of another repair shop")
+	}
+	orderID := createTestRepairOrder(t, cc, stub)
+	response = stub.call(t, testTxTime, func() pb.Response {
+		return cc.createRepairOrder(stub, shop, []string{"1534180999", "2018-08-28T08:00:00Z"})
+	})
+	if response.Status == shim.OK {
+		t.Error("createRepairOrder scheduled a quote twice")
+	}
+
+	supplement := `{"type":"REPAIR","description":"Frame straightening","costOfLabor":450}`
+	runRepairSteps(t, stub, orderID, []repairStep{
+		{"complete before start", shop, cc.completeRepair, []string{orderID}, true, "SCHEDULED"},
+		{"started by other shop", otherShop, cc.startRepair, []string{orderID}, true, "SCHEDULED"},
+		{"start", shop, cc.startRepair, []string{orderID}, false, "IN_PROGRESS"},
+		{"file supplement", shop, cc.fileSupplement, []string{orderID, "Bent frame behind rear bumper", supplement}, false, "IN_PROGRESS"},
+		{"decided by other insurer", otherInsurer, cc.decideSupplement, []string{orderID, "1", "APPROVED", "Confirmed by photos"}, true, "IN_PROGRESS"},
+		{"report estimate", shop, cc.reportActualCosts, []string{orderID, `[{"estimate":1,"type":"REPAIR","description":"Scratch removal","costOfLabor":130}]`}, false, "IN_PROGRESS"},
+		{"complete with pending supplement", shop, cc.completeRepair, []string{orderID}, true, "IN_PROGRESS"},
+		{"approve supplement", insurer, cc.decideSupplement, []string{orderID, "1", "approved", "Confirmed by photos"}, false, "IN_PROGRESS"},
+		{"decide supplement twice", insurer, cc.decideSupplement, []string{orderID, "1", "REJECTED", "Changed our mind"}, true, "IN_PROGRESS"},
+		{"complete without supplement costs", shop, cc.completeRepair, []string{orderID}, true, "IN_PROGRESS"},
+		{"report supplement", shop, cc.reportActualCosts, []string{orderID, `[{"supplement":1,"type":"REPAIR","description":"Frame straightening","costOfLabor":400}]`}, false, "IN_PROGRESS"},
+		{"invoice before completion", shop, cc.invoiceRepair, []string{orderID, "INV-2018-0815"}, true, "IN_PROGRESS"},
+		{"complete", shop, cc.completeRepair, []string{orderID}, false, "COMPLETED"},
+		{"invoice", shop, cc.invoiceRepair, []string{orderID, "INV-2018-0815"}, false, "INVOICED"},
+		{"invoice twice", shop, cc.invoiceRepair, []string{orderID, "INV-2018-0816"}, true, "INVOICED"},
+	})
+
+	// === The invoice is over the actual costs of the estimate and the approved supplement
+	repairOrder := RepairOrder{}
+	stub.get(t, "vehiclerepair.RepairOrder#"+orderID, &repairOrder)
+	if repairOrder.Invoice == nil || repairOrder.Invoice.Total != (Money{53000, "USD"}) {
+		t.Errorf("invoice = %+v, want a total of 530.00 USD", repairOrder.Invoice)
+	}
+	if variance := repairOrder.ActualCosts[0].Variance; variance != (Money{1000, "USD"}) {
+		t.Errorf("variance of the estimate = %s, want 10.00 USD", variance)
+	}
+}
+
+func TestRepairOrderClaimLink(t *testing.T) {
+	tests := []struct {
+		name               string
+		claimBeforeOrder   bool
+		claimBeforeInvoice bool
+	}{
+		{"claim sent before the repair is scheduled", true, true},
+		{"claim sent before invoicing", false, true},
+		{"claim sent after invoicing", false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newClaimStub(t)
+			claimRef := ""
+			if test.claimBeforeOrder {
+				claimRef = sendTestClaim(t, cc, stub)
+			}
+			orderID := createTestRepairOrder(t, cc, stub)
+			if !test.claimBeforeOrder && test.claimBeforeInvoice {
+				claimRef = sendTestClaim(t, cc, stub)
+			}
+			invoiceTestRepair(t, cc, stub, orderID)
+			if !test.claimBeforeInvoice {
+				claimRef = sendTestClaim(t, cc, stub)
+			}
+
+			orderRef := "vehiclerepair.RepairOrder#" + orderID
+			repairOrder, insuranceClaim := RepairOrder{}, InsuranceClaim{}
+			stub.get(t, orderRef, &repairOrder)
+			stub.get(t, claimRef, &insuranceClaim)
+			if repairOrder.InsuranceClaim != claimRef || insuranceClaim.RepairOrder != orderRef {
+				t.Errorf("order links claim %q and claim links order %q, want %s and %s", repairOrder.InsuranceClaim, insuranceClaim.RepairOrder, claimRef, orderRef)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Quote Routing Definitions - Repair shops eligible to quote for an accident
+// ============================================================================================================================
+
+// anyMake - related ID in the shop~make index of repair shops without supported makes, which repair all makes
+const anyMake = "*"
+
+// maxServiceRadiusKm - largest distance to accidents a repair shop may quote for
+const maxServiceRadiusKm = 500
+
+// repairShopMakeKeys - Get the related IDs of a repair shop in the shop~make index, shops without location aren't routed to
+func repairShopMakeKeys(shop *RepairShop) []string {
+	if shop.Location == nil {
+		return nil
+	}
+	if len(shop.Makes) == 0 {
+		return []string{anyMake}
+	}
+	var keys []string
+	for _, vehicleMake := range shop.Makes {
+		keys = append(keys, strings.ToUpper(vehicleMake))
+	}
+	return keys
+}
+
+// parseServiceArea - Parse the location, service radius and supported makes of a repair shop
+func parseServiceArea(longitudeArg string, latitudeArg string, radiusArg string, makesArg string) (*LocationConcept, float64, []string, error) {
+	longitude, err := strconv.ParseFloat(longitudeArg, 64)
+	if err != nil || !(longitude >= -180 && longitude <= 180) {
+		return nil, 0, nil, fmt.Errorf("Longitude must be a floating point string between -180 and 180, got %s", longitudeArg)
+	}
+	latitude, err := strconv.ParseFloat(latitudeArg, 64)
+	if err != nil || !(latitude >= -90 && latitude <= 90) {
+		return nil, 0, nil, fmt.Errorf("Latitude must be a floating point string between -90 and 90, got %s", latitudeArg)
+	}
+	serviceRadius, err := strconv.ParseFloat(radiusArg, 64)
+	if err != nil || !(serviceRadius > 0 && serviceRadius <= maxServiceRadiusKm) {
+		return nil, 0, nil, fmt.Errorf("Service radius must be a floating point string above 0 and up to %d km, got %s", maxServiceRadiusKm, radiusArg)
+	}
+
+	var makes []string
+	for _, vehicleMake := range strings.Split(makesArg, ",") {
+		if vehicleMake = strings.TrimSpace(vehicleMake); len(vehicleMake) > 0 {
+			makes = append(makes, strings.ToUpper(vehicleMake))
+		}
+	}
+	return &LocationConcept{"accident.Location", longitude, latitude, ""}, serviceRadius, makes, nil
+}
+
+// eligibleRepairShops - Get the repair shops which repair a make and whose service radius covers a location, nearest first
+func eligibleRepairShops(stub shim.ChaincodeStubInterface, location LocationConcept, vehicleMake string) ([]string, error) {
+	type eligibleShop struct {
+		ref            string
+		distanceMeters float64
+	}
+	var eligible []eligibleShop
+	seen := make(map[string]bool)
+
+	for _, makeKey := range []string{strings.ToUpper(vehicleMake), anyMake} {
+		shopRecords, err := getIndexedAssets(stub, makeKey, shopMakeIndex)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, shopRecord := range shopRecords {
+			if seen[shopRecord.Key] {
+				continue
+			}
+			seen[shopRecord.Key] = true
+
+			shop := RepairShop{}
+			if err = json.Unmarshal(shopRecord.Record, &shop); err != nil {
+				return nil, fmt.Errorf("Failed to unmarshal repair shop %s: %s", shopRecord.Key, err.Error())
+			}
+			if shop.Location == nil {
+				continue // stale entry of a shop which removed its location
+			}
+			distance := haversineMeters(location, *shop.Location)
+			if distance <= shop.ServiceRadiusKm*1000 {
+				eligible = append(eligible, eligibleShop{shopRecord.Key, distance})
+			}
+		}
+	}
+
+	sort.Slice(eligible, func(i, j int) bool {
+		if eligible[i].distanceMeters != eligible[j].distanceMeters {
+			return eligible[i].distanceMeters < eligible[j].distanceMeters
+		}
+		return eligible[i].ref < eligible[j].ref
+	})
+
+	shopRefs := []string{}
+	for _, shop := range eligible {
+		shopRefs = append(shopRefs, shop.ref)
+	}
+	return shopRefs, nil
+}
+
+// repairShopsLocated - Check if any repair shop is in the shop~make index, requests stay unrouted until shops are located
+func repairShopsLocated(stub shim.ChaincodeStubInterface) (bool, error) {
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(shopMakeIndex, []string{})
+	if err != nil {
+		return false, fmt.Errorf("Failed to query index %s: %s", shopMakeIndex, err.Error())
+	}
+	defer resultsIterator.Close()
+
+	return resultsIterator.HasNext(), nil
+}
+
+// acceptsShop - Check if a repair shop may quote for the request, unrouted requests accept any shop
+func (r *QuoteRequest) acceptsShop(shopRef string) bool {
+	if r.EligibleShops == nil {
+		return true
+	}
+	for _, eligibleShop := range r.EligibleShops {
+		if eligibleShop == shopRef {
+			return true
+		}
+	}
+	return false
+}
+
+// updateRepairShop - Set the location, service radius and supported makes of a repair shop and route quote requests to it
+func (t *InsuranceChaincode) updateRepairShop(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the makes replace the supported makes, all makes if empty
+	// 0=tradeName           1=longitude  2=latitude  3=serviceRadiusKm  4=makes
+	// USA Automotive NYC    -73.984511   40.718092   25                 BMW,Mini
+
+	if len(args) != 4 && len(args) != 5 {
+		return shim.Error("Incorrect number of arguments. Expecting 4 or 5")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	makesArg := ""
+	if len(args) > 4 {
+		makesArg = args[4]
+	}
+	location, serviceRadius, makes, err := parseServiceArea(args[1], args[2], args[3], makesArg)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check if RepairShop participant exists
+	shopObjClass := "base.RepairShop"
+	shopRef := fmt.Sprintf("%s#%s", shopObjClass, args[0])
+	shopAsBytes, err := stub.GetState(shopRef)
+	if err != nil {
+		return shim.Error("Failed to get repair shop: " + err.Error())
+	} else if shopAsBytes == nil {
+		return shim.Error("This repair shop doesn't exists: " + shopRef)
+	}
+
+	// === Only the repair shop itself or an admin of its organisation may update it
+	if caller.ParticipantRef != shopRef {
+		if !caller.Admin {
+			return shim.Error("Only the repair shop itself may update its service area: " + caller.ParticipantRef)
+		}
+		shopMSPID, err := getParticipantMSP(stub, shopObjClass, args[0])
+		if err != nil {
+			return shim.Error(err.Error())
+		} else if shopMSPID != caller.MSPID {
+			return shim.Error(fmt.Sprintf("Repair shop %s doesn't belong to organisation %s", shopRef, caller.MSPID))
+		}
+	}
+
+	// === Unmarshal the repair shop to an object
+	shop := RepairShop{}
+	if err = json.Unmarshal(shopAsBytes, &shop); err != nil {
+		return shim.Error("Failed to unmarshal repair shop: " + err.Error())
+	}
+
+	// === Drop the make index entries of the old service area
+	if err = deleteAssetIndexes(stub, shopObjClass, args[0], shopAsBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	shop.Location = location
+	shop.ServiceRadiusKm = serviceRadius
+	shop.Makes = makes
+
+	// === Marshal the repair shop
+	shopJSONasBytes, err := json.Marshal(shop)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save repair shop to state
+	err = stub.PutState(shopRef, shopJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Maintain make indexes
+	if err = putAssetIndexes(stub, shopObjClass, args[0], shopJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit RepairShopUpdate event
+	shopUpdate := &RepairShopUpdateEvent{shop.TradeName, *location, serviceRadius, makes}
+	eventJSONasBytes, err := json.Marshal(shopUpdate)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("RepairShopUpdateEvent", eventJSONasBytes)
+
+	fmt.Println("- Repair shop successfully updated")
+	return shim.Success(eventJSONasBytes)
+}
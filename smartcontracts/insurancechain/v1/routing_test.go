@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestParseServiceArea(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		wantMakes []string
+		wantErr   bool
+	}{
+		{"all makes", []string{"-73.984511", "40.718092", "25", ""}, nil, false},
+		{"makes in upper case", []string{"-73.984511", "40.718092", "25", " bmw, ,Mini"}, []string{"BMW", "MINI"}, false},
+		{"range limits", []string{"-180", "90", "500", ""}, nil, false},
+		{"longitude out of range", []string{"-180.5", "40.718092", "25", ""}, nil, true},
+		{"latitude out of range", []string{"-73.984511", "90.1", "25", ""}, nil, true},
+		{"latitude not a number", []string{"-73.984511", "NaN", "25", ""}, nil, true},
+		{"zero radius", []string{"-73.984511", "40.718092", "0", ""}, nil, true},
+		{"radius over the limit", []string{"-73.984511", "40.718092", "500.1", ""}, nil, true},
+	}
+
+	for _, test := range tests {
+		location, serviceRadius, makes, err := parseServiceArea(test.args[0], test.args[1], test.args[2], test.args[3])
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: parseServiceArea error = %v, want error %t", test.name, err, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+		if location == nil || serviceRadius <= 0 || !reflect.DeepEqual(makes, test.wantMakes) {
+			t.Errorf("%s: parseServiceArea = %v, %f, %v, want makes %v", test.name, location, serviceRadius, makes, test.wantMakes)
+		}
+	}
+}
+
+// newRoutingStub - Get the claim stub with two repair shops registered before routing, without location
+func newRoutingStub(t *testing.T) (*InsuranceChaincode, *testStub) {
+	cc, stub := newClaimStub(t)
+	stub.put(t, map[string]interface{}{
+		"base.RepairShop#Joe's Garage": &RepairShop{Class: "base.RepairShop", CompanyAbstract: CompanyAbstract{"Joe's Garage", AddressConcept{}}},
+		"base.RepairShop#Other Garage": &RepairShop{Class: "base.RepairShop", CompanyAbstract: CompanyAbstract{"Other Garage", AddressConcept{}}},
+	})
+	stub.call(t, testTxTime, func() pb.Response {
+		for _, shopID := range []string{"Joe's Garage", "Other Garage"} {
+			if err := bindParticipant(stub, "base.RepairShop", shopID, "Org1MSP"); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return shim.Success(nil)
+	})
+	return cc, stub
+}
+
+// updateTestShop - Set the service area of a repair shop by the shop itself
+func updateTestShop(t *testing.T, cc *InsuranceChaincode, stub *testStub, shopID string, args ...string) {
+	response := stub.call(t, testTxTime, func() pb.Response {
+		return cc.updateRepairShop(stub, testCaller("base.RepairShop#"+shopID), append([]string{shopID}, args...))
+	})
+	if response.Status != shim.OK {
+		t.Fatalf("updateRepairShop status = %d %s", response.Status, response.Message)
+	}
+}
+
+// requestTestQuote - Request a quote for the damage of the claimant's Nissan in New York
+func requestTestQuote(t *testing.T, cc *InsuranceChaincode, stub *testStub) pb.Response {
+	return stub.call(t, testTxTime, func() pb.Response {
+		return cc.requestQuote(stub, testCaller("base.Insurer#Allsecur Insurance"), []string{"1534180781", "USA-AX203-3459802", "Scratched rear bumper"})
+	})
+}
+
+func TestUpdateRepairShop(t *testing.T) {
+	tests := []struct {
+		name    string
+		caller  *Caller
+		args    []string
+		wantErr bool
+	}{
+		{"by the shop", testCaller("base.RepairShop#Joe's Garage"), []string{"Joe's Garage", "-73.984511", "40.718092", "25", "Nissan"}, false},
+		{"by an admin of its organisation", &Caller{"Org1MSP", "admin", true, "", "", ""}, []string{"Joe's Garage", "-73.984511", "40.718092", "25"}, false},
+		{"by an admin of another organisation", &Caller{"Org2MSP", "admin", true, "", "", ""}, []string{"Joe's Garage", "-73.984511", "40.718092", "25"}, true},
+		{"by another shop", testCaller("base.RepairShop#Other Garage"), []string{"Joe's Garage", "-73.984511", "40.718092", "25"}, true},
+		{"unknown shop", testCaller("base.RepairShop#Joe's Garage"), []string{"Jim's Garage", "-73.984511", "40.718092", "25"}, true},
+		{"latitude out of range", testCaller("base.RepairShop#Joe's Garage"), []string{"Joe's Garage", "40.718092", "-173.984511", "25"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newRoutingStub(t)
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.updateRepairShop(stub, test.caller, test.args)
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("updateRepairShop status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+
+			shop := RepairShop{}
+			stub.get(t, "base.RepairShop#Joe's Garage", &shop)
+			if located := shop.Location != nil; located == test.wantErr {
+				t.Errorf("shop located = %t, want %t", located, !test.wantErr)
+			}
+		})
+	}
+}
+
+func TestUpdateRepairShopIndex(t *testing.T) {
+	cc, stub := newRoutingStub(t)
+	makeIndex := func(makeKey string) []string {
+		shopIDs, err := getIndexedAssetIDs(stub, shopMakeIndex, makeKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return shopIDs
+	}
+
+	updateTestShop(t, cc, stub, "Joe's Garage", "-73.984511", "40.718092", "25", "nissan,Ford")
+	if got := makeIndex("NISSAN"); !reflect.DeepEqual(got, []string{"Joe's Garage"}) {
+		t.Errorf("shops of NISSAN = %v, want [Joe's Garage]", got)
+	}
+
+	// === Changing the makes drops the entries of the old ones
+	updateTestShop(t, cc, stub, "Joe's Garage", "-73.984511", "40.718092", "25", "BMW")
+	if got := makeIndex("NISSAN"); len(got) != 0 {
+		t.Errorf("shops of NISSAN = %v, want none after changing the makes", got)
+	}
+	if got := makeIndex("BMW"); !reflect.DeepEqual(got, []string{"Joe's Garage"}) {
+		t.Errorf("shops of BMW = %v, want [Joe's Garage]", got)
+	}
+
+	updateTestShop(t, cc, stub, "Joe's Garage", "-73.984511", "40.718092", "25")
+	if got, all := makeIndex("BMW"), makeIndex(anyMake); len(got) != 0 || !reflect.DeepEqual(all, []string{"Joe's Garage"}) {
+		t.Errorf("shops of BMW = %v and of all makes = %v, want only an entry for all makes", got, all)
+	}
+}
+
+func TestRequestQuoteRouting(t *testing.T) {
+	tests := []struct {
+		name      string
+		shops     [][]string // service areas set with updateRepairShop
+		want      []string
+		wantErr   bool
+		wantOffer map[string]bool // shops offering a quote, and if they may
+	}{
+		{"no shop located", nil, nil, false, map[string]bool{"Joe's Garage": true, "Other Garage": true}},
+		{"shops near the accident repairing the make, nearest first", [][]string{
+			{"Joe's Garage", "-73.984511", "40.718092", "25", "Nissan"},
+			{"Other Garage", "-73.940000", "40.850000", "5"},
+		}, []string{"base.RepairShop#Other Garage", "base.RepairShop#Joe's Garage"}, false, map[string]bool{"Joe's Garage": true}},
+		{"shop not repairing the make", [][]string{
+			{"Joe's Garage", "-73.984511", "40.718092", "25", "Nissan"},
+			{"Other Garage", "-73.940000", "40.850000", "5", "BMW"},
+		}, []string{"base.RepairShop#Joe's Garage"}, false, map[string]bool{"Other Garage": false}},
+		{"shop too far from the accident", [][]string{
+			{"Joe's Garage", "-73.984511", "40.718092", "10"},
+		}, nil, true, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newRoutingStub(t)
+			for _, shop := range test.shops {
+				updateTestShop(t, cc, stub, shop[0], shop[1:]...)
+			}
+
+			response := requestTestQuote(t, cc, stub)
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("requestQuote status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			requestForQuote := RequestForQuoteEvent{}
+			if err := json.Unmarshal(response.Payload, &requestForQuote); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(requestForQuote.EligibleShops, test.want) {
+				t.Errorf("eligible shops = %v, want %v", requestForQuote.EligibleShops, test.want)
+			}
+
+			for shopID, wantOffered := range test.wantOffer {
+				response = stub.call(t, testTxTime, func() pb.Response {
+					return cc.offerQuote(stub, testCaller("base.RepairShop#"+shopID), []string{requestForQuote.RequestID, `[{"type":"REPAIR","description":"Scratch removal","costOfLabor":120}]`, "0"})
+				})
+				if offered := response.Status == shim.OK; offered != wantOffered {
+					t.Errorf("offerQuote by %s = %d %s, want offered %t", shopID, response.Status, response.Message, wantOffered)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Sealed Bid Definitions - Repair shops commit to a hidden quote and reveal it once bidding is closed
+// ============================================================================================================================
+
+// Bidding modes of a quote request
+const (
+	biddingOpen   = "OPEN"
+	biddingSealed = "SEALED"
+)
+
+// Commitment status values
+const (
+	commitmentCommitted = "COMMITTED"
+	commitmentRevealed  = "REVEALED"
+)
+
+// QuoteCommitment - asset type of a sealed repair quote, only the hash of the quote is public until it is revealed
+type QuoteCommitment struct {
+	Class        string     `json:"$class"` // vehiclerepair.QuoteCommitment
+	CommitmentID string     `json:"commitmentId"`
+	QuoteRequest string     `json:"quoteRequest"` // Quote request class name + # + requestId
+	Estimator    string     `json:"estimator"`    // Repair shop class name + # + tradeName
+	Hash         string     `json:"hash"`         // hex SHA-256 of the sealed quote, see sealedQuoteHash
+	CommittedAt  time.Time  `json:"committedAt"`
+	Status       string     `json:"status"` // This can be COMMITTED or REVEALED
+	RevealedAt   *time.Time `json:"revealedAt,omitempty"`
+	RepairQuote  string     `json:"repairQuote,omitempty"` // Repair quote class name + # + quoteId, set on reveal
+}
+
+// commitmentID - Get the commitment ID of a repair shop for a quote request, a shop has one commitment per request
+func commitmentID(requestID string, shopRef string) string {
+	hash := sha256.Sum256([]byte(shopRef))
+	return fmt.Sprintf("%s-%s", requestID, hex.EncodeToString(hash[:4]))
+}
+
+// sealedQuoteHash - Get the hash a repair shop commits to for a sealed quote
+//
+// The hash is the hex SHA-256 of requestId|shopRef|estimates|tax|currency|salt, with the estimates and tax exactly as
+// they are passed to revealQuote and the currency in upper case. The shop reference binds the hash to the committing
+// shop, so another shop can't copy a commitment and reveal the quote once it is public.
+func sealedQuoteHash(requestID string, shopRef string, estimates string, tax string, currency string, salt string) string {
+	hash := sha256.Sum256([]byte(strings.Join([]string{requestID, shopRef, estimates, tax, currency, salt}, "|")))
+	return hex.EncodeToString(hash[:])
+}
+
+// getSealedQuoteRequest - Get a quote request taking sealed bids which isn't awarded yet
+func getSealedQuoteRequest(stub shim.ChaincodeStubInterface, requestID string) (*QuoteRequest, error) {
+	// === Check if QuoteRequest asset exists
+	requestRef := fmt.Sprintf("%s#%s", "vehiclerepair.QuoteRequest", requestID)
+	requestAsBytes, err := stub.GetState(requestRef)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get quote request: %s", err.Error())
+	} else if requestAsBytes == nil {
+		return nil, fmt.Errorf("Given quote request doesn't exists: %s", requestRef)
+	}
+
+	quoteRequest := &QuoteRequest{}
+	if err = json.Unmarshal(requestAsBytes, quoteRequest); err != nil {
+		return nil, fmt.Errorf("Failed to unmarshal quote request: %s", err.Error())
+	}
+
+	if quoteRequest.BiddingMode != biddingSealed {
+		return nil, fmt.Errorf("Quote request takes open bids, offer the quote with offerQuote: %s", requestRef)
+	}
+	if quoteRequest.AwardedQuote != "" {
+		return nil, fmt.Errorf("Quote request is already awarded to %s", quoteRequest.AwardedQuote)
+	}
+	return quoteRequest, nil
+}
+
+// commitQuote - Commit to a sealed repair quote during the bidding window, a new commitment replaces the earlier one
+func (t *InsuranceChaincode) commitQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=requestId  1=hash
+	// 1534180781   9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	hash := strings.ToLower(args[1])
+	if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+		return shim.Error("2nd argument must be a hex SHA-256 hash")
+	}
+
+	quoteRequest, err := getSealedQuoteRequest(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !quoteRequest.acceptsShop(caller.ParticipantRef) {
+		return shim.Error("Repair shop isn't eligible to quote for the request: " + caller.ParticipantRef)
+	}
+
+	// === Check if the bidding window is open
+	committedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if !committedAt.Before(*quoteRequest.BiddingClosesAt) {
+		return shim.Error("Bidding window closed at " + quoteRequest.BiddingClosesAt.Format(time.RFC3339))
+	}
+
+	// === Create or replace commitment of the repair shop
+	commitmentObjClass := "vehiclerepair.QuoteCommitment"
+	requestRef := fmt.Sprintf("%s#%s", quoteRequest.Class, quoteRequest.RequestID)
+	commitment := &QuoteCommitment{commitmentObjClass, commitmentID(quoteRequest.RequestID, caller.ParticipantRef), requestRef, caller.ParticipantRef, hash, committedAt, commitmentCommitted, nil, ""}
+
+	commitmentJSONasBytes, err := json.Marshal(commitment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	commitmentRef := fmt.Sprintf("%s#%s", commitmentObjClass, commitment.CommitmentID)
+	err = stub.PutState(commitmentRef, commitmentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit QuoteCommitted event
+	quoteCommitted := &QuoteCommittedEvent{quoteRequest.RequestID, commitment.CommitmentID, caller.ParticipantRef, committedAt}
+	eventJSONasBytes, err := json.Marshal(quoteCommitted)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("QuoteCommittedEvent", eventJSONasBytes)
+
+	fmt.Println("- Sealed repair quote successfully committed")
+	return shim.Success(eventJSONasBytes)
+}
+
+// revealQuote - Reveal a committed repair quote during the reveal window, it becomes an offered quote of the request
+func (t *InsuranceChaincode) revealQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the repair shop is the caller
+	// 0=requestId  1=json{estimates[]}                                           2=tax (%)  3=salt              4=currency
+	// 1534180781   [{"type":"REPAIR","description":"Scratch removal","costOfLabor":100}]  11         b8f1c2d9e0a7f3c4    USD
+
+	if len(args) < 4 || len(args) > 5 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 4 and maximum of 5")
+	}
+
+	// === Check input variables
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+	if len(args[2]) <= 0 {
+		return shim.Error("3rd argument must be a non-empty string")
+	}
+	if len(args[3]) <= 0 {
+		return shim.Error("4th argument must be a non-empty string")
+	}
+
+	tax, err := ParsePercentage(args[2])
+	if err != nil {
+		return shim.Error("3rd argument must be a decimal string with at most 4 decimals")
+	} else if tax < 0 || tax >= 100*percentageScale {
+		return shim.Error("3rd argument must be between 0 and 100")
+	}
+
+	currency := defaultCurrency
+	if len(args) > 4 && len(args[4]) > 0 {
+		currency = strings.ToUpper(args[4])
+		if _, err = currencyExponent(currency); err != nil {
+			return shim.Error("5th argument must be a supported ISO 4217 currency code")
+		}
+	}
+
+	quoteRequest, err := getSealedQuoteRequest(stub, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Check if the reveal window is open
+	revealedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if revealedAt.Before(*quoteRequest.BiddingClosesAt) {
+		return shim.Error("Sealed quotes can be revealed from " + quoteRequest.BiddingClosesAt.Format(time.RFC3339))
+	}
+	if !revealedAt.Before(*quoteRequest.RevealClosesAt) {
+		return shim.Error("Reveal window closed at " + quoteRequest.RevealClosesAt.Format(time.RFC3339))
+	}
+
+	// === Check if QuoteCommitment asset exists
+	commitmentRef := fmt.Sprintf("%s#%s", "vehiclerepair.QuoteCommitment", commitmentID(quoteRequest.RequestID, caller.ParticipantRef))
+	commitmentAsBytes, err := stub.GetState(commitmentRef)
+	if err != nil {
+		return shim.Error("Failed to get quote commitment: " + err.Error())
+	} else if commitmentAsBytes == nil {
+		return shim.Error("Repair shop didn't commit to a quote for this request: " + caller.ParticipantRef)
+	}
+
+	commitment := QuoteCommitment{}
+	if err = json.Unmarshal(commitmentAsBytes, &commitment); err != nil {
+		return shim.Error("Failed to unmarshal quote commitment: " + err.Error())
+	}
+	if commitment.Status != commitmentCommitted {
+		return shim.Error("Sealed quote is already revealed as " + commitment.RepairQuote)
+	}
+
+	// === Verify the reveal against the commitment
+	if sealedQuoteHash(quoteRequest.RequestID, caller.ParticipantRef, args[1], args[2], currency, args[3]) != commitment.Hash {
+		return shim.Error("Revealed quote doesn't match the committed hash")
+	}
+
+	// === Revealed quotes can't be rejected, so the first reveal sets the currency all quotes are compared in
+	quoteRecords, err := getIndexedAssets(stub, quoteRequest.RequestID, quoteRequestIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	for _, quoteRecord := range quoteRecords {
+		revealedQuote := RepairQuote{}
+		if err = json.Unmarshal(quoteRecord.Record, &revealedQuote); err != nil {
+			return shim.Error(fmt.Sprintf("Failed to unmarshal repair quote %s: %s", quoteRecord.Key, err.Error()))
+		}
+		if revealedQuote.Total.Currency != currency {
+			return shim.Error(fmt.Sprintf("Sealed quotes of the request are revealed in %s, a quote in %s can't be compared", revealedQuote.Total.Currency, currency))
+		}
+	}
+
+	estimates, err := parseEstimates([]byte(args[1]), currency)
+	if err != nil {
+		return shim.Error("Failed to unmarshal estimate array: " + err.Error())
+	}
+
+	// === Create the revealed quote as offer of the request
+	repairQuote, totalEstimates, err := newRepairQuote(stub, commitment.QuoteRequest, caller.ParticipantRef, estimates, tax, currency)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	commitment.Status = commitmentRevealed
+	commitment.RevealedAt = &revealedAt
+	commitment.RepairQuote = fmt.Sprintf("%s#%s", repairQuote.Class, repairQuote.QuoteID)
+	commitmentJSONasBytes, err := json.Marshal(commitment)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	err = stub.PutState(commitmentRef, commitmentJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit NewQuoteOffer event
+	newQuoteOffer := &NewQuoteOfferEvent{quoteRequest.RequestID, repairQuote.QuoteID, totalEstimates}
+	eventJSONasBytes, err := json.Marshal(newQuoteOffer)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("NewQuoteOfferEvent", eventJSONasBytes)
+
+	fmt.Println("- Sealed repair quote successfully revealed")
+	return shim.Success(eventJSONasBytes)
+}
+
+// awardSealedQuote - Award the revealed quote with the lowest total once the reveal window is closed
+//
+// Quotes rejected by the requester don't take part. On equal totals the shop which committed first wins.
+func (t *InsuranceChaincode) awardSealedQuote(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments
+	// 0=requestId
+	// 1534180781
+
+	if len(args) != 1 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 1")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+
+	quoteRequest, err := getOpenQuoteRequest(stub, caller, args[0])
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if quoteRequest.BiddingMode != biddingSealed {
+		return shim.Error("Quote request takes open bids, award a quote with acceptQuote")
+	}
+
+	// === Check if the reveal window is closed
+	txTime, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if txTime.Before(*quoteRequest.RevealClosesAt) {
+		return shim.Error("Reveal window is open until " + quoteRequest.RevealClosesAt.Format(time.RFC3339))
+	}
+
+	// === Find the best revealed quote
+	quoteRecords, err := getIndexedAssets(stub, quoteRequest.RequestID, quoteRequestIndex)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	var best *RepairQuote
+	var bestCommittedAt time.Time
+	revealed := 0
+	for _, quoteRecord := range quoteRecords {
+		repairQuote := &RepairQuote{}
+		if err = json.Unmarshal(quoteRecord.Record, repairQuote); err != nil {
+			return shim.Error(fmt.Sprintf("Failed to unmarshal repair quote %s: %s", quoteRecord.Key, err.Error()))
+		}
+		if repairQuote.Status != "OFFERED" {
+			continue
+		}
+		revealed++
+
+		// === Commitment time breaks ties
+		commitmentRef := fmt.Sprintf("%s#%s", "vehiclerepair.QuoteCommitment", commitmentID(quoteRequest.RequestID, repairQuote.Estimator))
+		commitmentAsBytes, err := stub.GetState(commitmentRef)
+		if err != nil {
+			return shim.Error("Failed to get quote commitment: " + err.Error())
+		} else if commitmentAsBytes == nil {
+			return shim.Error("Commitment of revealed quote doesn't exists: " + commitmentRef)
+		}
+		commitment := QuoteCommitment{}
+		if err = json.Unmarshal(commitmentAsBytes, &commitment); err != nil {
+			return shim.Error("Failed to unmarshal quote commitment: " + err.Error())
+		}
+
+		if best == nil {
+			best, bestCommittedAt = repairQuote, commitment.CommittedAt
+			continue
+		}
+		if repairQuote.Total.Currency != best.Total.Currency {
+			return shim.Error(fmt.Sprintf("Revealed quotes in %s and %s can't be compared", best.Total.Currency, repairQuote.Total.Currency))
+		}
+		if repairQuote.Total.MinorUnits < best.Total.MinorUnits ||
+			(repairQuote.Total.MinorUnits == best.Total.MinorUnits && commitment.CommittedAt.Before(bestCommittedAt)) {
+			best, bestCommittedAt = repairQuote, commitment.CommittedAt
+		}
+	}
+	if best == nil {
+		return shim.Error("No sealed quote was revealed for this request")
+	}
+
+	return t.awardQuote(stub, quoteRequest, best, fmt.Sprintf("Best of %d revealed sealed quotes", revealed))
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// Sealed bid windows of the test quote request
+var (
+	sealedRequestedAt   = time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	sealedBiddingCloses = sealedRequestedAt.Add(24 * time.Hour)
+	sealedRevealCloses  = sealedRequestedAt.Add(48 * time.Hour)
+)
+
+// newSealedBidStub - Get a mock stub with a sealed quote request and the policy it is requested for
+func newSealedBidStub(t *testing.T) (*InsuranceChaincode, *testStub) {
+	return newTestStub(t, map[string]interface{}{
+		"insurance.InsurancePolicy#USA-AX203-3459802": &InsurancePolicy{Class: "insurance.InsurancePolicy", PolicyID: "USA-AX203-3459802", PolicyHolder: "base.Registrant#908123765", IssuedBy: "base.Insurer#Allsecur Insurance"},
+		"vehiclerepair.QuoteRequest#1534180781": &QuoteRequest{Class: "vehiclerepair.QuoteRequest", RequestID: "1534180781", VehicleInsurance: "insurance.InsurancePolicy#USA-AX203-3459802",
+			BiddingMode: biddingSealed, BiddingClosesAt: &sealedBiddingCloses, RevealClosesAt: &sealedRevealCloses},
+	})
+}
+
+func TestSealedQuoteHash(t *testing.T) {
+	base := []string{"1534180781", "base.RepairShop#USA Automotive NYC", `[{"type":"REPAIR","costOfLabor":100}]`, "11", "USD", "b8f1c2d9e0a7f3c4"}
+	preimage := sha256.Sum256([]byte(`1534180781|base.RepairShop#USA Automotive NYC|[{"type":"REPAIR","costOfLabor":100}]|11|USD|b8f1c2d9e0a7f3c4`))
+	want := hex.EncodeToString(preimage[:])
+	if got := sealedQuoteHash(base[0], base[1], base[2], base[3], base[4], base[5]); got != want {
+		t.Fatalf("sealedQuoteHash = %s, want %s", got, want)
+	}
+
+	// === Every part of the preimage changes the hash
+	changed := []string{"1534180782", "base.RepairShop#USA Automotive JC", `[{"type":"REPAIR","costOfLabor":100.0}]`, "11.0", "EUR", "b8f1c2d9e0a7f3c5"}
+	for i := range base {
+		args := append([]string{}, base...)
+		args[i] = changed[i]
+		if got := sealedQuoteHash(args[0], args[1], args[2], args[3], args[4], args[5]); got == want {
+			t.Errorf("sealedQuoteHash doesn't depend on part %d (%s)", i+1, changed[i])
+		}
+	}
+}
+
+func TestRevealQuote(t *testing.T) {
+	estimates := `[{"type":"REPAIR","description":"Scratch removal","costOfLabor":100}]`
+	nycHash := sealedQuoteHash("1534180781", "base.RepairShop#USA Automotive NYC", estimates, "11", "USD", "b8f1c2d9e0a7f3c4")
+
+	tests := []struct {
+		name       string
+		committer  string
+		hash       string
+		revealer   string
+		revealedAt time.Time
+		args       []string
+		wantErr    bool
+	}{
+		{"matching reveal", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedBiddingCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4"}, false},
+		{"currency in lower case", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedBiddingCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4", "usd"}, false},
+		{"wrong salt", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedBiddingCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c5"}, true},
+		{"tax written differently", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedBiddingCloses, []string{"1534180781", estimates, "11.0", "b8f1c2d9e0a7f3c4"}, true},
+		{"other currency", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedBiddingCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4", "EUR"}, true},
+		{"copied commitment of other shop", "USA Automotive JC", nycHash, "USA Automotive JC", sealedBiddingCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4"}, true},
+		{"shop without commitment", "USA Automotive NYC", nycHash, "USA Automotive JC", sealedBiddingCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4"}, true},
+		{"before bidding closes", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedBiddingCloses.Add(-time.Second), []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4"}, true},
+		{"after reveal closes", "USA Automotive NYC", nycHash, "USA Automotive NYC", sealedRevealCloses, []string{"1534180781", estimates, "11", "b8f1c2d9e0a7f3c4"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newSealedBidStub(t)
+
+			response := stub.call(t, sealedRequestedAt.Add(time.Hour), func() pb.Response {
+				return cc.commitQuote(stub, testCaller("base.RepairShop#"+test.committer), []string{"1534180781", test.hash})
+			})
+			if response.Status != shim.OK {
+				t.Fatalf("commitQuote: %s", response.Message)
+			}
+
+			response = stub.call(t, test.revealedAt, func() pb.Response {
+				return cc.revealQuote(stub, testCaller("base.RepairShop#"+test.revealer), test.args)
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Errorf("revealQuote status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAwardSealedQuote(t *testing.T) {
+	type bid struct {
+		shop        string
+		costOfLabor string
+		currency    string
+		committedAt time.Duration // after the request, a shop committing twice replaces its commitment
+	}
+	tests := []struct {
+		name    string
+		bids    []bid
+		want    string
+		wantErr bool
+	}{
+		{"lowest total wins", []bid{{"A", "120", "USD", time.Hour}, {"B", "90", "USD", 2 * time.Hour}, {"C", "100", "USD", 3 * time.Hour}}, "B", false},
+		{"equal totals go to the first commitment", []bid{{"B", "100", "USD", 2 * time.Hour}, {"A", "100", "USD", 3 * time.Hour}, {"C", "100", "USD", time.Hour}}, "C", false},
+		{"recommitting gives up the earlier time", []bid{{"A", "100", "USD", time.Hour}, {"B", "100", "USD", 2 * time.Hour}, {"A", "100", "USD", 3 * time.Hour}}, "B", false},
+		{"single revealed quote", []bid{{"A", "500", "USD", time.Hour}}, "A", false},
+		{"no revealed quote", nil, "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newSealedBidStub(t)
+
+			// === Commit in the given order, reveal the last commitment of each shop
+			reveals := map[string][]string{}
+			var revealOrder []string
+			for i, b := range test.bids {
+				estimates := fmt.Sprintf(`[{"type":"REPAIR","costOfLabor":%s}]`, b.costOfLabor)
+				salt := fmt.Sprintf("salt-%s-%d", b.shop, i)
+				hash := sealedQuoteHash("1534180781", "base.RepairShop#"+b.shop, estimates, "10", b.currency, salt)
+
+				response := stub.call(t, sealedRequestedAt.Add(b.committedAt), func() pb.Response {
+					return cc.commitQuote(stub, testCaller("base.RepairShop#"+b.shop), []string{"1534180781", hash})
+				})
+				if response.Status != shim.OK {
+					t.Fatalf("commitQuote: %s", response.Message)
+				}
+
+				if _, found := reveals[b.shop]; !found {
+					revealOrder = append(revealOrder, b.shop)
+				}
+				reveals[b.shop] = []string{"1534180781", estimates, "10", salt, b.currency}
+			}
+			// Reveal in reverse order, so the reveal time doesn't break ties
+			for i := len(revealOrder) - 1; i >= 0; i-- {
+				shop := revealOrder[i]
+				response := stub.call(t, sealedBiddingCloses.Add(time.Duration(len(revealOrder)-i)*time.Minute), func() pb.Response {
+					return cc.revealQuote(stub, testCaller("base.RepairShop#"+shop), reveals[shop])
+				})
+				if response.Status != shim.OK {
+					t.Fatalf("revealQuote: %s", response.Message)
+				}
+			}
+
+			response := stub.call(t, sealedRevealCloses, func() pb.Response {
+				return cc.awardSealedQuote(stub, testCaller("base.Insurer#Allsecur Insurance"), []string{"1534180781"})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("awardSealedQuote status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			quoteRequest, repairQuote := QuoteRequest{}, RepairQuote{}
+			stub.get(t, "vehiclerepair.QuoteRequest#1534180781", &quoteRequest)
+			stub.get(t, quoteRequest.AwardedQuote, &repairQuote)
+			if got := assetIDFromRef(repairQuote.Estimator); got != test.want {
+				t.Errorf("awarded to %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRevealQuoteCurrency(t *testing.T) {
+	cc, stub := newSealedBidStub(t)
+	estimates := `[{"type":"REPAIR","costOfLabor":100}]`
+	bids := []struct {
+		shop     string
+		currency string
+		wantErr  bool
+	}{
+		{"USA Automotive NYC", "USD", false},
+		{"USA Automotive JC", "EUR", true},
+		{"USA Automotive BK", "usd", false},
+	}
+
+	for _, b := range bids {
+		hash := sealedQuoteHash("1534180781", "base.RepairShop#"+b.shop, estimates, "10", strings.ToUpper(b.currency), "salt-"+b.shop)
+		response := stub.call(t, sealedRequestedAt.Add(time.Hour), func() pb.Response {
+			return cc.commitQuote(stub, testCaller("base.RepairShop#"+b.shop), []string{"1534180781", hash})
+		})
+		if response.Status != shim.OK {
+			t.Fatalf("commitQuote: %s", response.Message)
+		}
+	}
+
+	// === The first reveal sets the currency, a quote in another currency isn't revealed
+	for _, b := range bids {
+		response := stub.call(t, sealedBiddingCloses, func() pb.Response {
+			return cc.revealQuote(stub, testCaller("base.RepairShop#"+b.shop), []string{"1534180781", estimates, "10", "salt-" + b.shop, b.currency})
+		})
+		if (response.Status != shim.OK) != b.wantErr {
+			t.Errorf("revealQuote of %s in %s: status = %d %s, want error %t", b.shop, b.currency, response.Status, response.Message, b.wantErr)
+		}
+	}
+
+	response := stub.call(t, sealedRevealCloses, func() pb.Response {
+		return cc.awardSealedQuote(stub, testCaller("base.Insurer#Allsecur Insurance"), []string{"1534180781"})
+	})
+	if response.Status != shim.OK {
+		t.Fatalf("awardSealedQuote status = %d %s", response.Status, response.Message)
+	}
+}
@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Settlement Definitions - Payables between insurers of resolved claims and their netting
+// ============================================================================================================================
+
+// openSettlementIndex - composite key of the settlement entries not netted yet, with the attributes [entry ID]
+const openSettlementIndex = "settlement~open"
+
+// Settlement status values
+const (
+	settlementOpen      = "OPEN"
+	settlementNetted    = "NETTED"
+	obligationPending   = "PENDING"
+	obligationConfirmed = "CONFIRMED"
+)
+
+// SettlementEntry - asset type of the amount the insurer of the defendant owes the insurer of the claimant for a claim
+type SettlementEntry struct {
+	Class      string    `json:"$class"`  // settlement.SettlementEntry
+	EntryID    string    `json:"entryId"` // ID of the resolved claim
+	Claim      string    `json:"claim"`   // Insurance claim class name + # + claimId
+	Payer      string    `json:"payer"`   // Insurer class name + # + tradeName
+	Payee      string    `json:"payee"`   // Insurer class name + # + tradeName
+	Amount     Money     `json:"amount"`
+	ResolvedAt time.Time `json:"resolvedAt"`
+	Status     string    `json:"status"`               // This can be OPEN or NETTED
+	NettingRun string    `json:"nettingRun,omitempty"` // Netting run class name + # + runId
+}
+
+// NetObligation - asset type of the net amount one insurer owes another after a netting run
+type NetObligation struct {
+	Class            string     `json:"$class"` // settlement.NetObligation
+	ObligationID     string     `json:"obligationId"`
+	NettingRun       string     `json:"nettingRun"` // Netting run class name + # + runId
+	Payer            string     `json:"payer"`      // Insurer class name + # + tradeName
+	Payee            string     `json:"payee"`      // Insurer class name + # + tradeName
+	Amount           Money      `json:"amount"`
+	Entries          []string   `json:"entries"` // Settlement entry class name + # + entryId, in both directions
+	Status           string     `json:"status"`  // This can be PENDING or CONFIRMED
+	ConfirmedAt      *time.Time `json:"confirmedAt,omitempty"`
+	PaymentReference string     `json:"paymentReference,omitempty"`
+}
+
+// NettingRun - asset type of a netting run over the open settlement entries up to the end of a period
+type NettingRun struct {
+	Class       string    `json:"$class"` // settlement.NettingRun
+	RunID       string    `json:"runId"`
+	PeriodEnd   time.Time `json:"periodEnd"`
+	RunAt       time.Time `json:"runAt"`
+	EntryCount  int       `json:"entryCount"`
+	Obligations []string  `json:"obligations"` // Net obligation class name + # + obligationId
+}
+
+// nettingGroup - settlement entries between a pair of insurers in one currency
+type nettingGroup struct {
+	first   string // the insurer ordered first, a positive balance is owed by it
+	second  string
+	balance Money
+	entries []string
+}
+
+// recordSettlement - Record the payout of a resolved claim as payable from the insurer of the defendant to the insurer of the claimant
+func recordSettlement(stub shim.ChaincodeStubInterface, insuranceClaim *InsuranceClaim) error {
+	var insurers [2]string
+	for i, policyRef := range []string{insuranceClaim.Defendant, insuranceClaim.Claimant} {
+		policyAsBytes, err := stub.GetState(policyRef)
+		if err != nil {
+			return fmt.Errorf("Failed to get insurance policy: %s", err.Error())
+		} else if policyAsBytes == nil {
+			return fmt.Errorf("Insurance policy of claim doesn't exists: %s", policyRef)
+		}
+
+		insurancePolicy := InsurancePolicy{}
+		if err = json.Unmarshal(policyAsBytes, &insurancePolicy); err != nil {
+			return fmt.Errorf("Failed to unmarshal insurance policy: %s", err.Error())
+		}
+		insurers[i] = insurancePolicy.IssuedBy
+	}
+
+	// === Nothing moves between insurers when both parties have the same insurer
+	payer, payee := insurers[0], insurers[1]
+	if payer == payee {
+		return nil
+	}
+
+	// === Claims accepted before the payout calculation are owed in full
+	var amount Money
+	if insuranceClaim.Payout != nil {
+		amount = insuranceClaim.Payout.PayoutAmount
+	} else {
+		repairTotal, err := getClaimRepairTotal(stub, insuranceClaim)
+		if err != nil {
+			return err
+		}
+		amount = repairTotal
+	}
+	if amount.IsZero() {
+		return nil
+	}
+
+	resolvedAt, err := getTxTime(stub)
+	if err != nil {
+		return err
+	}
+
+	entryObjClass := "settlement.SettlementEntry"
+	claimRef := fmt.Sprintf("%s#%s", insuranceClaim.Class, insuranceClaim.ClaimID)
+	settlementEntry := &SettlementEntry{entryObjClass, insuranceClaim.ClaimID, claimRef, payer, payee, amount, resolvedAt, settlementOpen, ""}
+	entryJSONasBytes, err := json.Marshal(settlementEntry)
+	if err != nil {
+		return err
+	}
+
+	// === Save settlement entry to state and mark it open for netting
+	entryRef := fmt.Sprintf("%s#%s", entryObjClass, settlementEntry.EntryID)
+	if err = stub.PutState(entryRef, entryJSONasBytes); err != nil {
+		return err
+	}
+	openKey, err := stub.CreateCompositeKey(openSettlementIndex, []string{settlementEntry.EntryID})
+	if err != nil {
+		return err
+	}
+	return stub.PutState(openKey, []byte{0x00})
+}
+
+// runNetting - Net the open settlement entries up to the end of a period into one obligation per insurer pair and currency
+func (t *InsuranceChaincode) runNetting(stub shim.ChaincodeStubInterface, args []string) pb.Response {
+	// simple data model arguments
+	// 0=periodEnd
+	// 2018-09-30T23:59:59.999Z
+
+	if len(args) > 1 {
+		return shim.Error("Incorrect number of arguments. Expecting maximum of 1")
+	}
+
+	runAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	periodEnd := runAt
+	if len(args) > 0 && len(args[0]) > 0 {
+		if periodEnd, err = time.Parse(time.RFC3339, args[0]); err != nil {
+			return shim.Error("1st argument must be a RFC3339 dateTime string")
+		}
+		if periodEnd.After(runAt) {
+			return shim.Error("1st argument must not be in the future")
+		}
+	}
+
+	runObjClass := "settlement.NettingRun"
+	runID, err := newAssetID(stub, runObjClass, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	runRef := fmt.Sprintf("%s#%s", runObjClass, runID)
+
+	// === Collect the open entries of the period per insurer pair and currency
+	resultsIterator, err := stub.GetStateByPartialCompositeKey(openSettlementIndex, []string{})
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	defer resultsIterator.Close()
+
+	groups := map[string]*nettingGroup{}
+	var entries []*SettlementEntry
+	var openKeys []string
+	for resultsIterator.HasNext() {
+		indexEntry, err := resultsIterator.Next()
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		_, keyParts, err := stub.SplitCompositeKey(indexEntry.Key)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+
+		entryRef := fmt.Sprintf("%s#%s", "settlement.SettlementEntry", keyParts[0])
+		entryAsBytes, err := stub.GetState(entryRef)
+		if err != nil {
+			return shim.Error("Failed to get settlement entry: " + err.Error())
+		} else if entryAsBytes == nil {
+			return shim.Error("Open settlement entry doesn't exists: " + entryRef)
+		}
+
+		settlementEntry := &SettlementEntry{}
+		if err = json.Unmarshal(entryAsBytes, settlementEntry); err != nil {
+			return shim.Error("Failed to unmarshal settlement entry: " + err.Error())
+		}
+		if settlementEntry.ResolvedAt.After(periodEnd) {
+			continue
+		}
+
+		first, second, amount := settlementEntry.Payer, settlementEntry.Payee, settlementEntry.Amount
+		if first > second {
+			first, second = second, first
+			amount.MinorUnits = -amount.MinorUnits
+		}
+		groupKey := first + "|" + second + "|" + amount.Currency
+		group, found := groups[groupKey]
+		if !found {
+			group = &nettingGroup{first, second, Money{0, amount.Currency}, nil}
+			groups[groupKey] = group
+		}
+		if group.balance, err = group.balance.Add(amount); err != nil {
+			return shim.Error(err.Error())
+		}
+		group.entries = append(group.entries, entryRef)
+
+		entries = append(entries, settlementEntry)
+		openKeys = append(openKeys, indexEntry.Key)
+	}
+
+	if len(entries) == 0 {
+		return shim.Error("There are no open settlement entries up to " + periodEnd.Format(time.RFC3339))
+	}
+
+	// === Create one obligation per group in a fixed order, so all endorsing peers write the same IDs
+	groupKeys := make([]string, 0, len(groups))
+	for groupKey := range groups {
+		groupKeys = append(groupKeys, groupKey)
+	}
+	sort.Strings(groupKeys)
+
+	obligationObjClass := "settlement.NetObligation"
+	nettingRun := &NettingRun{runObjClass, runID, periodEnd, runAt, len(entries), []string{}}
+	for _, groupKey := range groupKeys {
+		group := groups[groupKey]
+		// Balanced pairs owe nothing, their entries are netted without an obligation
+		if group.balance.IsZero() {
+			continue
+		}
+
+		payer, payee, amount := group.first, group.second, group.balance
+		if amount.MinorUnits < 0 {
+			payer, payee = payee, payer
+			amount.MinorUnits = -amount.MinorUnits
+		}
+
+		obligationID := fmt.Sprintf("%s-%d", runID, len(nettingRun.Obligations)+1)
+		netObligation := &NetObligation{obligationObjClass, obligationID, runRef, payer, payee, amount, group.entries, obligationPending, nil, ""}
+		obligationJSONasBytes, err := json.Marshal(netObligation)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		obligationRef := fmt.Sprintf("%s#%s", obligationObjClass, obligationID)
+		if err = stub.PutState(obligationRef, obligationJSONasBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+		nettingRun.Obligations = append(nettingRun.Obligations, obligationRef)
+	}
+
+	// === Close the netted entries
+	for i, settlementEntry := range entries {
+		settlementEntry.Status = settlementNetted
+		settlementEntry.NettingRun = runRef
+		entryJSONasBytes, err := json.Marshal(settlementEntry)
+		if err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.PutState(fmt.Sprintf("%s#%s", settlementEntry.Class, settlementEntry.EntryID), entryJSONasBytes); err != nil {
+			return shim.Error(err.Error())
+		}
+		if err = stub.DelState(openKeys[i]); err != nil {
+			return shim.Error(err.Error())
+		}
+	}
+
+	// === Save netting run to state ===
+	runJSONasBytes, err := json.Marshal(nettingRun)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(runRef, runJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit NettingCompleted event ===
+	nettingCompleted := &NettingCompletedEvent{runID, periodEnd, len(entries), nettingRun.Obligations}
+	eventJSONasBytes, err := json.Marshal(nettingCompleted)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("NettingCompletedEvent", eventJSONasBytes)
+
+	fmt.Println("- Netting run successfully completed")
+	return shim.Success(eventJSONasBytes)
+}
+
+// confirmSettlement - Confirm the payment of a net obligation by the paying insurer
+func (t *InsuranceChaincode) confirmSettlement(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the paying insurer is the caller
+	// 0=obligationId          1=paymentReference
+	// 1538351999-1a2b3c4d-1   SWIFT MT103 20180930-0042
+
+	if len(args) != 2 {
+		return shim.Error("Incorrect number of arguments. Expecting exactly 2")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	// === Check if NetObligation asset exists
+	obligationRef := fmt.Sprintf("%s#%s", "settlement.NetObligation", args[0])
+	obligationAsBytes, err := stub.GetState(obligationRef)
+	if err != nil {
+		return shim.Error("Failed to get net obligation: " + err.Error())
+	} else if obligationAsBytes == nil {
+		return shim.Error("This net obligation doesn't exists: " + obligationRef)
+	}
+
+	netObligation := NetObligation{}
+	if err = json.Unmarshal(obligationAsBytes, &netObligation); err != nil {
+		return shim.Error("Failed to unmarshal net obligation: " + err.Error())
+	}
+
+	if netObligation.Payer != caller.ParticipantRef {
+		return shim.Error("Only the paying insurer may confirm the settlement: " + caller.ParticipantRef)
+	}
+	if netObligation.Status != obligationPending {
+		return shim.Error("Net obligation is already " + netObligation.Status)
+	}
+
+	confirmedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	netObligation.Status = obligationConfirmed
+	netObligation.ConfirmedAt = &confirmedAt
+	netObligation.PaymentReference = args[1]
+
+	// === Save net obligation to state ===
+	obligationJSONasBytes, err := json.Marshal(netObligation)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	if err = stub.PutState(obligationRef, obligationJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit SettlementConfirmed event ===
+	settlementConfirmed := &SettlementConfirmedEvent{netObligation.ObligationID, netObligation.Payer, netObligation.Payee, netObligation.Amount, netObligation.PaymentReference}
+	eventJSONasBytes, err := json.Marshal(settlementConfirmed)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("SettlementConfirmedEvent", eventJSONasBytes)
+
+	fmt.Println("- Settlement successfully confirmed")
+	return shim.Success(eventJSONasBytes)
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// nettingTxTime - time of the netting runs, after the periods netted
+var nettingTxTime = time.Date(2018, 10, 1, 6, 0, 0, 0, time.UTC)
+
+// putOpenSettlementEntry - Store an open settlement entry the way recordSettlement does
+func putOpenSettlementEntry(t *testing.T, stub shim.ChaincodeStubInterface, entryID string, payer string, payee string, amount Money, resolvedAt string) {
+	resolvedTime, err := time.Parse(time.RFC3339, resolvedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settlementEntry := &SettlementEntry{"settlement.SettlementEntry", entryID, "insurance.InsuranceClaim#" + entryID, "base.Insurer#" + payer, "base.Insurer#" + payee, amount, resolvedTime, settlementOpen, ""}
+	entryJSONasBytes, err := json.Marshal(settlementEntry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stub.PutState("settlement.SettlementEntry#"+entryID, entryJSONasBytes); err != nil {
+		t.Fatal(err)
+	}
+	openKey, err := stub.CreateCompositeKey(openSettlementIndex, []string{entryID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = stub.PutState(openKey, []byte{0x00}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunNetting(t *testing.T) {
+	type entry struct {
+		payer, payee string
+		amount       Money
+		resolvedAt   string
+	}
+	type obligation struct {
+		payer, payee string
+		amount       string
+		entries      int
+	}
+	tests := []struct {
+		name        string
+		entries     []entry
+		periodEnd   string
+		wantErr     bool
+		wantCount   int
+		obligations []obligation
+	}{
+		{
+			name:        "single entry",
+			entries:     []entry{{"A", "B", Money{10000, "USD"}, "2018-09-01T10:00:00Z"}},
+			wantCount:   1,
+			obligations: []obligation{{"A", "B", "100.00 USD", 1}},
+		},
+		{
+			name:        "opposite entries net to the larger side",
+			entries:     []entry{{"A", "B", Money{10000, "USD"}, "2018-09-01T10:00:00Z"}, {"B", "A", Money{3000, "USD"}, "2018-09-02T10:00:00Z"}},
+			wantCount:   2,
+			obligations: []obligation{{"A", "B", "70.00 USD", 2}},
+		},
+		{
+			name:        "payer follows the sign of the balance",
+			entries:     []entry{{"A", "B", Money{3000, "USD"}, "2018-09-01T10:00:00Z"}, {"B", "A", Money{10000, "USD"}, "2018-09-02T10:00:00Z"}},
+			wantCount:   2,
+			obligations: []obligation{{"B", "A", "70.00 USD", 2}},
+		},
+		{
+			name:      "balanced pair has no obligation",
+			entries:   []entry{{"A", "B", Money{5000, "USD"}, "2018-09-01T10:00:00Z"}, {"B", "A", Money{5000, "USD"}, "2018-09-02T10:00:00Z"}},
+			wantCount: 2,
+		},
+		{
+			name:        "currencies are netted separately in order",
+			entries:     []entry{{"A", "B", Money{10000, "USD"}, "2018-09-01T10:00:00Z"}, {"B", "A", Money{5000, "EUR"}, "2018-09-02T10:00:00Z"}},
+			wantCount:   2,
+			obligations: []obligation{{"B", "A", "50.00 EUR", 1}, {"A", "B", "100.00 USD", 1}},
+		},
+		{
+			name:        "pairs are ordered by insurer",
+			entries:     []entry{{"C", "A", Money{1000, "USD"}, "2018-09-01T10:00:00Z"}, {"A", "B", Money{2000, "USD"}, "2018-09-02T10:00:00Z"}},
+			wantCount:   2,
+			obligations: []obligation{{"A", "B", "20.00 USD", 1}, {"C", "A", "10.00 USD", 1}},
+		},
+		{
+			name:        "entries after the period stay open",
+			entries:     []entry{{"A", "B", Money{10000, "USD"}, "2018-09-01T10:00:00Z"}, {"A", "B", Money{5000, "USD"}, "2018-10-01T10:00:00Z"}},
+			periodEnd:   "2018-09-30T23:59:59Z",
+			wantCount:   1,
+			obligations: []obligation{{"A", "B", "100.00 USD", 1}},
+		},
+		{
+			name:      "no entries in the period",
+			entries:   []entry{{"A", "B", Money{10000, "USD"}, "2018-10-01T10:00:00Z"}},
+			periodEnd: "2018-09-30T23:59:59Z",
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newTestStub(t, nil)
+			stub.call(t, testTxTime, func() pb.Response {
+				for i, e := range test.entries {
+					putOpenSettlementEntry(t, stub, fmt.Sprintf("claim%d", i+1), e.payer, e.payee, e.amount, e.resolvedAt)
+				}
+				return shim.Success(nil)
+			})
+
+			response := stub.call(t, nettingTxTime, func() pb.Response {
+				return cc.runNetting(stub, []string{test.periodEnd})
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("runNetting status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			nettingCompleted := NettingCompletedEvent{}
+			if err := json.Unmarshal(response.Payload, &nettingCompleted); err != nil {
+				t.Fatal(err)
+			}
+			if nettingCompleted.EntryCount != test.wantCount {
+				t.Errorf("entry count = %d, want %d", nettingCompleted.EntryCount, test.wantCount)
+			}
+			if len(nettingCompleted.Obligations) != len(test.obligations) {
+				t.Fatalf("obligations = %v, want %d", nettingCompleted.Obligations, len(test.obligations))
+			}
+
+			for i, want := range test.obligations {
+				netObligation := NetObligation{}
+				if err := json.Unmarshal(stub.State[nettingCompleted.Obligations[i]], &netObligation); err != nil {
+					t.Fatal(err)
+				}
+				got := obligation{assetIDFromRef(netObligation.Payer), assetIDFromRef(netObligation.Payee), netObligation.Amount.String(), len(netObligation.Entries)}
+				if got != want {
+					t.Errorf("obligation %d = %+v, want %+v", i+1, got, want)
+				}
+			}
+
+			// === Netted entries are closed, later ones stay open for the next run
+			iterator, err := stub.GetStateByPartialCompositeKey(openSettlementIndex, []string{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer iterator.Close()
+			open := 0
+			for ; iterator.HasNext(); open++ {
+				iterator.Next()
+			}
+			if open != len(test.entries)-test.wantCount {
+				t.Errorf("open entries = %d, want %d", open, len(test.entries)-test.wantCount)
+			}
+		})
+	}
+}
+
+func TestConfirmSettlement(t *testing.T) {
+	cc, stub := newTestStub(t, nil)
+	stub.call(t, testTxTime, func() pb.Response {
+		putOpenSettlementEntry(t, stub, "claim1", "AXA Insurance", "Allsecur Insurance", Money{13060, "USD"}, "2018-09-10T00:00:00Z")
+		return shim.Success(nil)
+	})
+	response := stub.call(t, nettingTxTime, func() pb.Response {
+		return cc.runNetting(stub, []string{"2018-09-30T23:59:59Z"})
+	})
+	nettingCompleted := NettingCompletedEvent{}
+	if err := json.Unmarshal(response.Payload, &nettingCompleted); err != nil || len(nettingCompleted.Obligations) != 1 {
+		t.Fatalf("runNetting = %s %v", response.Message, err)
+	}
+	obligationID := assetIDFromRef(nettingCompleted.Obligations[0])
+
+	steps := []struct {
+		name    string
+		insurer string
+		args    []string
+		wantErr bool
+	}{
+		{"payee can't confirm", "Allsecur Insurance", []string{obligationID, "SWIFT MT103 20180930-0042"}, true},
+		{"unknown obligation", "AXA Insurance", []string{obligationID + "-9", "SWIFT MT103 20180930-0042"}, true},
+		{"without payment reference", "AXA Insurance", []string{obligationID, ""}, true},
+		{"payer confirms", "AXA Insurance", []string{obligationID, "SWIFT MT103 20180930-0042"}, false},
+		{"confirmed only once", "AXA Insurance", []string{obligationID, "SWIFT MT103 20180930-0043"}, true},
+	}
+
+	for _, step := range steps {
+		response := stub.call(t, nettingTxTime, func() pb.Response {
+			return cc.confirmSettlement(stub, testCaller("base.Insurer#"+step.insurer), step.args)
+		})
+		if (response.Status != shim.OK) != step.wantErr {
+			t.Fatalf("%s: confirmSettlement status = %d %s, want error %t", step.name, response.Status, response.Message, step.wantErr)
+		}
+	}
+
+	netObligation := NetObligation{}
+	stub.get(t, nettingCompleted.Obligations[0], &netObligation)
+	if netObligation.Status != obligationConfirmed || netObligation.PaymentReference != "SWIFT MT103 20180930-0042" || netObligation.ConfirmedAt == nil {
+		t.Errorf("net obligation = %+v, want confirmed with the first payment reference", netObligation)
+	}
+}
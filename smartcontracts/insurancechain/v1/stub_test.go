@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/hyperledger/fabric/protos/ledger/queryresult"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Test Stub - Mock stub shared by the tests of functions working on the ledger state
+// ============================================================================================================================
+
+// testTxTime - time of the transactions setting up the test state
+var testTxTime = time.Date(2018, 8, 24, 18, 0, 0, 0, time.UTC)
+
+// testStub - Mock stub of the shim, completed with deleting private data, the history of keys and with collections the
+// caller isn't member of
+type testStub struct {
+	*shim.MockStub
+	deniedCollections map[string]bool
+	history           map[string][]*queryresult.KeyModification
+	txCount           int
+}
+
+// newTestStub - Get the chaincode and a mock stub holding the given assets
+func newTestStub(t *testing.T, assets map[string]interface{}) (*InsuranceChaincode, *testStub) {
+	cc := new(InsuranceChaincode)
+	stub := &testStub{shim.NewMockStub("insurancechain", cc), map[string]bool{}, map[string][]*queryresult.KeyModification{}, 0}
+	stub.put(t, assets)
+	return cc, stub
+}
+
+// GetPrivateData - Get private data, reads of denied collections fail like on peers of organisations outside the collection
+func (stub *testStub) GetPrivateData(collection string, key string) ([]byte, error) {
+	if stub.deniedCollections[collection] {
+		return nil, fmt.Errorf("tx creator does not have read access permission on privatedata in chaincodeName:insurancechain collectionName: %s", collection)
+	}
+	return stub.MockStub.GetPrivateData(collection, key)
+}
+
+// DelPrivateData - Delete private data, which the shim's mock stub doesn't implement
+func (stub *testStub) DelPrivateData(collection string, key string) error {
+	if stub.TxID == "" {
+		return fmt.Errorf("cannot DelPrivateData without a transaction")
+	}
+	delete(stub.PvtState[collection], key)
+	return nil
+}
+
+// PutState - Put a value and record it in the history of the key
+func (stub *testStub) PutState(key string, value []byte) error {
+	stub.history[key] = append(stub.history[key], &queryresult.KeyModification{TxId: stub.TxID, Value: value, Timestamp: stub.TxTimestamp})
+	return stub.MockStub.PutState(key, value)
+}
+
+// DelState - Delete a value and record the deletion in the history of the key
+func (stub *testStub) DelState(key string) error {
+	stub.history[key] = append(stub.history[key], &queryresult.KeyModification{TxId: stub.TxID, Timestamp: stub.TxTimestamp, IsDelete: true})
+	return stub.MockStub.DelState(key)
+}
+
+// GetHistoryForKey - Get the recorded history of a key, which the shim's mock stub doesn't implement
+func (stub *testStub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	return &testHistoryIterator{stub.history[key], 0}, nil
+}
+
+// testHistoryIterator - Iterator over the recorded history of a key, oldest first
+type testHistoryIterator struct {
+	modifications []*queryresult.KeyModification
+	next          int
+}
+
+// HasNext - Check if a further modification is recorded
+func (iterator *testHistoryIterator) HasNext() bool {
+	return iterator.next < len(iterator.modifications)
+}
+
+// Next - Get the next modification
+func (iterator *testHistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if !iterator.HasNext() {
+		return nil, fmt.Errorf("no further modification")
+	}
+	iterator.next++
+	return iterator.modifications[iterator.next-1], nil
+}
+
+// Close - Close the iterator
+func (iterator *testHistoryIterator) Close() error {
+	return nil
+}
+
+// call - Run a chaincode function in a new mock transaction at the given time, dropping the events of earlier transactions
+func (stub *testStub) call(t *testing.T, txTime time.Time, function func() pb.Response) pb.Response {
+	for len(stub.ChaincodeEventsChannel) > 0 {
+		<-stub.ChaincodeEventsChannel
+	}
+	stub.txCount++
+	txID := fmt.Sprintf("tx%d", stub.txCount)
+	stub.MockTransactionStart(txID)
+	defer stub.MockTransactionEnd(txID)
+
+	timestamp, err := ptypes.TimestampProto(txTime)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub.TxTimestamp = timestamp
+	return function()
+}
+
+// put - Store assets as JSON under their references
+func (stub *testStub) put(t *testing.T, assets map[string]interface{}) {
+	stub.call(t, testTxTime, func() pb.Response {
+		for assetRef, asset := range assets {
+			assetJSONasBytes, err := json.Marshal(asset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = stub.PutState(assetRef, assetJSONasBytes); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return shim.Success(nil)
+	})
+}
+
+// get - Unmarshal the asset stored under a reference
+func (stub *testStub) get(t *testing.T, assetRef string, asset interface{}) {
+	assetAsBytes := stub.State[assetRef]
+	if assetAsBytes == nil {
+		t.Fatalf("asset %s doesn't exists", assetRef)
+	}
+	if err := json.Unmarshal(assetAsBytes, asset); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// lastEvent - Get the name and payload of the event of the last transaction, the last one set is emitted
+func (stub *testStub) lastEvent(t *testing.T) (string, []byte) {
+	var event *pb.ChaincodeEvent
+	for len(stub.ChaincodeEventsChannel) > 0 {
+		event = <-stub.ChaincodeEventsChannel
+	}
+	if event == nil {
+		t.Fatal("no event set")
+	}
+	return event.EventName, event.Payload
+}
+
+// testCaller - Get a caller acting as the participant with the given reference
+func testCaller(participantRef string) *Caller {
+	participantClass := strings.SplitN(participantRef, "#", 2)[0]
+	participantID := assetIDFromRef(participantRef)
+	return &Caller{"Org1MSP", participantID, false, participantClass, participantID, participantRef}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ============================================================================================================================
+// Coverage Definitions - Validity period and territory of insurance policies
+// ============================================================================================================================
+
+// geoPoint - point of a boundary polygon
+type geoPoint struct {
+	Longitude float64
+	Latitude  float64
+}
+
+// countryBoundary - outline of a country, made of one ring per mainland, exclave or island group
+type countryBoundary struct {
+	Code  string // ISO 3166-1 alpha-2
+	Rings [][]geoPoint
+}
+
+// countriesAt - Get the codes of the countries containing a location, more than one on a simplified shared border
+func countriesAt(longitude float64, latitude float64) []string {
+	var codes []string
+	for _, country := range countryBoundaries {
+		for _, ring := range country.Rings {
+			if ringContains(ring, longitude, latitude) {
+				codes = append(codes, country.Code)
+				break
+			}
+		}
+	}
+	return codes
+}
+
+// boundaryCountryCodes - Get the codes of the countries in the boundary dataset
+func boundaryCountryCodes() []string {
+	codes := make([]string, 0, len(countryBoundaries))
+	for _, country := range countryBoundaries {
+		codes = append(codes, country.Code)
+	}
+	return codes
+}
+
+// parseTerritory - Parse a comma separated list of country codes, only countries of the boundary dataset can be covered
+func parseTerritory(value string) ([]string, error) {
+	var territory []string
+	for _, code := range strings.Split(value, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		known := false
+		for _, country := range countryBoundaries {
+			if country.Code == code {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("Country code %q isn't in the boundary dataset (%s)", code, strings.Join(boundaryCountryCodes(), ","))
+		}
+		territory = append(territory, code)
+	}
+	return territory, nil
+}
+
+// ringContains - Check if a location lies inside a polygon ring using the even-odd rule
+func ringContains(ring []geoPoint, longitude float64, latitude float64) bool {
+	inside := false
+	for i, j := 0, len(ring)-1; i < len(ring); j, i = i, i+1 {
+		a, b := ring[i], ring[j]
+		if (a.Latitude > latitude) != (b.Latitude > latitude) {
+			crossing := a.Longitude + (latitude-a.Latitude)*(b.Longitude-a.Longitude)/(b.Latitude-a.Latitude)
+			if longitude < crossing {
+				inside = !inside
+			}
+		}
+	}
+	return inside
+}
+
+// checkPolicyCoverage - Check if an accident falls inside the validity period and coverage territory of an uncancelled policy
+func checkPolicyCoverage(insurancePolicy *InsurancePolicy, accidentReport *AccidentReport) error {
+	policyRef := fmt.Sprintf("%s#%s", "insurance.InsurancePolicy", insurancePolicy.PolicyID)
+
+	// === Rule 1: the accident occured during the policy period
+	if accidentReport.OccuredAt.Before(insurancePolicy.ValidFrom) || accidentReport.OccuredAt.After(insurancePolicy.ValidTo) {
+		return fmt.Errorf("Policy period rule failed for %s: accident occured at %s, policy is valid from %s to %s",
+			policyRef, accidentReport.OccuredAt.Format(time.RFC3339), insurancePolicy.ValidFrom.Format(time.RFC3339), insurancePolicy.ValidTo.Format(time.RFC3339))
+	}
+	if insurancePolicy.policyStatusAt(accidentReport.OccuredAt) == policyCancelled {
+		return fmt.Errorf("Policy status rule failed for %s: accident occured at %s, policy is cancelled from %s (%s)",
+			policyRef, accidentReport.OccuredAt.Format(time.RFC3339), insurancePolicy.CancelledAt.Format(time.RFC3339), insurancePolicy.CancelReason)
+	}
+
+	// === Rule 2: the accident location is in a country of the coverage territory
+	location := accidentReport.Location
+	countries := countriesAt(location.Longitude, location.Latitude)
+	if len(countries) == 0 {
+		return fmt.Errorf("Coverage territory rule failed for %s: accident location (longitude %f, latitude %f) isn't inside any country of the boundary dataset (%s)",
+			policyRef, location.Longitude, location.Latitude, strings.Join(boundaryCountryCodes(), ","))
+	}
+
+	for _, country := range countries {
+		for _, covered := range insurancePolicy.Territory {
+			if strings.EqualFold(strings.TrimSpace(covered), country) {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("Coverage territory rule failed for %s: accident location (longitude %f, latitude %f) is in %s, territory is %s",
+		policyRef, location.Longitude, location.Latitude, strings.Join(countries, "/"), strings.Join(insurancePolicy.Territory, ","))
+}
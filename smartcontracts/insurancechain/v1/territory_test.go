@@ -0,0 +1,161 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+func TestRingContains(t *testing.T) {
+	square := []geoPoint{{0, 0}, {10, 0}, {10, 10}, {0, 10}}
+	// U shape open to the north, the notch between longitude 4 and 6 is outside
+	notched := []geoPoint{{0, 0}, {10, 0}, {10, 10}, {6, 10}, {6, 4}, {4, 4}, {4, 10}, {0, 10}}
+	// ring crossing into negative coordinates
+	western := []geoPoint{{-74.5, 40.0}, {-73.5, 40.0}, {-73.5, 41.0}, {-74.5, 41.0}}
+
+	tests := []struct {
+		name      string
+		ring      []geoPoint
+		longitude float64
+		latitude  float64
+		want      bool
+	}{
+		{"center of square", square, 5, 5, true},
+		{"east of square", square, 11, 5, false},
+		{"north of square", square, 5, 10.5, false},
+		{"south west corner outside", square, -0.1, -0.1, false},
+		{"left arm of U", notched, 2, 8, true},
+		{"notch of U", notched, 5, 8, false},
+		{"below notch of U", notched, 5, 2, true},
+		{"right arm of U", notched, 8, 8, true},
+		{"western hemisphere inside", western, -73.936206, 40.849496, true},
+		{"western hemisphere outside", western, -72.9, 40.8, false},
+	}
+
+	for _, test := range tests {
+		if got := ringContains(test.ring, test.longitude, test.latitude); got != test.want {
+			t.Errorf("%s: ringContains(%f, %f) = %t, want %t", test.name, test.longitude, test.latitude, got, test.want)
+		}
+	}
+}
+
+func TestCountriesAt(t *testing.T) {
+	tests := []struct {
+		name      string
+		longitude float64
+		latitude  float64
+		want      []string
+	}{
+		{"New York", -73.936206, 40.849496, []string{"US"}},
+		{"Toronto", -79.38, 43.65, []string{"CA"}},
+		{"Mexico City", -99.13, 19.43, []string{"MX"}},
+		{"Anchorage", -149.90, 61.22, []string{"US"}},
+		{"Paris outside the dataset", 2.3522, 48.8566, nil},
+		{"mid Atlantic", -40.0, 35.0, nil},
+	}
+
+	for _, test := range tests {
+		if got := countriesAt(test.longitude, test.latitude); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: countriesAt(%f, %f) = %v, want %v", test.name, test.longitude, test.latitude, got, test.want)
+		}
+	}
+}
+
+func TestCheckPolicyCoverage(t *testing.T) {
+	validFrom := time.Date(2018, 8, 1, 0, 0, 0, 0, time.UTC)
+	validTo := time.Date(2020, 8, 1, 0, 0, 0, 0, time.UTC)
+	cancelledAt := time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC)
+	occuredAt := time.Date(2018, 8, 24, 17, 39, 20, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		territory   []string
+		cancelledAt *time.Time
+		occuredAt   time.Time
+		longitude   float64
+		latitude    float64
+		wantErr     bool
+	}{
+		{"covered country", []string{"US", "CA"}, nil, occuredAt, -73.936206, 40.849496, false},
+		{"territory codes are trimmed and case insensitive", []string{" us"}, nil, occuredAt, -73.936206, 40.849496, false},
+		{"known country outside territory", []string{"CA", "MX"}, nil, occuredAt, -73.936206, 40.849496, true},
+		{"location outside the dataset", []string{"US"}, nil, occuredAt, 2.3522, 48.8566, true},
+		{"before policy period", []string{"US"}, nil, validFrom.Add(-time.Hour), -73.936206, 40.849496, true},
+		{"after policy period", []string{"US"}, nil, validTo.Add(time.Hour), -73.936206, 40.849496, true},
+		{"before cancellation", []string{"US"}, &cancelledAt, occuredAt, -73.936206, 40.849496, false},
+		{"after cancellation", []string{"US"}, &cancelledAt, cancelledAt, -73.936206, 40.849496, true},
+	}
+
+	for _, test := range tests {
+		insurancePolicy := &InsurancePolicy{PolicyID: "USA-AX203-3459802", ValidFrom: validFrom, ValidTo: validTo, Territory: test.territory, CancelledAt: test.cancelledAt}
+		accidentReport := &AccidentReport{OccuredAt: test.occuredAt, Location: LocationConcept{Longitude: test.longitude, Latitude: test.latitude}}
+		if err := checkPolicyCoverage(insurancePolicy, accidentReport); (err != nil) != test.wantErr {
+			t.Errorf("%s: checkPolicyCoverage error = %v, want error %t", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestParseTerritory(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    []string
+		wantErr bool
+	}{
+		{"US,CA,MX", []string{"US", "CA", "MX"}, false},
+		{" us, ca", []string{"US", "CA"}, false},
+		{"US,NL", nil, true},
+		{"USA", nil, true},
+		{"US,", nil, true},
+	}
+
+	for _, test := range tests {
+		got, err := parseTerritory(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseTerritory(%q) error = %v, want error %t", test.value, err, test.wantErr)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseTerritory(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
+
+func TestIssuePolicyTerritory(t *testing.T) {
+	coverages := `[{"type":"THIRD_PARTY_LIABILITY","perEventLimit":1000000}]`
+	tests := []struct {
+		territory string
+		want      []string
+		wantErr   bool
+	}{
+		{"US,CA,MX", []string{"US", "CA", "MX"}, false},
+		{"us", []string{"US"}, false},
+		{"US,NL", nil, true},
+	}
+
+	for _, test := range tests {
+		cc, stub := newTestStub(t, map[string]interface{}{
+			"base.Vehicle#JN6ND01S3GX194659": &Vehicle{Class: "base.Vehicle", RegistrationNumber: "JN6ND01S3GX194659", Owner: "base.Registrant#908123764"},
+			"base.Registrant#908123764":      &Registrant{Class: "base.Registrant", IdentificationNumber: "908123764", LegalEntity: "INDIVIDUAL"},
+		})
+		args := []string{"State of New York", "2018-08-01T00:00:00.000Z", "2020-08-01T00:00:00.000Z", "JN6ND01S3GX194659", "USA", "AX203", "3459802", "AF", "BMW", test.territory, "908123764", coverages}
+		response := stub.call(t, testTxTime, func() pb.Response {
+			return cc.issuePolicy(stub, testCaller("base.Insurer#Allsecur Insurance"), args)
+		})
+		if (response.Status != shim.OK) != test.wantErr {
+			t.Errorf("%s: issuePolicy status = %d %s, want error %t", test.territory, response.Status, response.Message, test.wantErr)
+			continue
+		}
+		if test.wantErr {
+			continue
+		}
+
+		insurancePolicy := InsurancePolicy{}
+		stub.get(t, "insurance.InsurancePolicy#USA-AX203-3459802", &insurancePolicy)
+		if !reflect.DeepEqual(insurancePolicy.Territory, test.want) {
+			t.Errorf("%s: territory = %v, want %v", test.territory, insurancePolicy.Territory, test.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/lib/cid"
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// ============================================================================================================================
+// Witness Statement Definitions - Statements of witnesses taken by the responding emergency services
+// ============================================================================================================================
+
+// WitnessStatement - asset type of witness statement
+type WitnessStatement struct {
+	Class          string    `json:"$class"` // accident.WitnessStatement
+	StatementID    string    `json:"statementId"`
+	AccidentReport string    `json:"accidentReport"` // Accident report class name + # + accidentId
+	Statement      string    `json:"statement"`
+	TakenAt        time.Time `json:"takenAt"`
+	RecordedAt     time.Time `json:"recordedAt"`
+	RecordedBy     string    `json:"recordedBy"`             // Emergency Services class name + # + tradeName
+	Officer        string    `json:"officer"`                // client identity of the recording officer
+	OfficerName    string    `json:"officerName,omitempty"`  // common name of the certificate of the recording officer
+	DocumentHash   string    `json:"documentHash,omitempty"` // hex SHA-256 of the signed original document
+}
+
+// addWitnessStatement - Record the statement of a witness of an accident by the responding ERS
+func (t *InsuranceChaincode) addWitnessStatement(stub shim.ChaincodeStubInterface, caller *Caller, args []string) pb.Response {
+	// simple data model arguments, the responding ERS is the caller
+	// 0=accidentId  1=statement                                  2=takenAt                 3=documentHash
+	// 1534180781    Blue car ran the red light at 60 mph approx  2018-08-03T10:45:00.000Z  9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08
+
+	if len(args) < 2 || len(args) > 4 {
+		return shim.Error("Incorrect number of arguments. Expecting minimum of 2 and maximum of 4")
+	}
+
+	// === Check input variables ===
+	if len(args[0]) <= 0 {
+		return shim.Error("1st argument must be a non-empty string")
+	}
+	if len(args[1]) <= 0 {
+		return shim.Error("2nd argument must be a non-empty string")
+	}
+
+	accidentID := args[0]
+	statement := args[1]
+
+	recordedAt, err := getTxTime(stub)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Parse takenAt dateTime format, statements are taken before they are recorded
+	takenAt := recordedAt
+	if len(args) > 2 && len(args[2]) > 0 {
+		takenAt, err = time.Parse(time.RFC3339, args[2])
+		if err != nil {
+			return shim.Error("3rd argument must be a RFC3339 dateTime string")
+		} else if takenAt.After(recordedAt) {
+			return shim.Error("3rd argument must not be in the future")
+		}
+	}
+
+	var documentHash string
+	if len(args) > 3 && len(args[3]) > 0 {
+		documentHash = strings.ToLower(args[3])
+		if decoded, err := hex.DecodeString(documentHash); err != nil || len(decoded) != sha256.Size {
+			return shim.Error("4th argument must be a hex SHA-256 hash")
+		}
+	}
+
+	// === Check if AccidentReport asset exists
+	accidentRef := fmt.Sprintf("%s#%s", "accident.AccidentReport", accidentID)
+	reportAsBytes, err := stub.GetState(accidentRef)
+	if err != nil {
+		return shim.Error("Failed to get accident report: " + err.Error())
+	} else if reportAsBytes == nil {
+		return shim.Error("This accident report doesn't exists: " + accidentRef)
+	}
+
+	// === Unmarshal the report to an object
+	accidentReport := AccidentReport{}
+	if err = json.Unmarshal(reportAsBytes, &accidentReport); err != nil {
+		return shim.Error("Failed to unmarshal accident report: " + err.Error())
+	}
+
+	// === Only the responding ERS takes statements, and only until the report is resolved
+	if accidentReport.RespondingERS != caller.ParticipantRef {
+		return shim.Error("Only the responding Emergency Services may add witness statements: " + caller.ParticipantRef)
+	}
+	if accidentReport.Status == "RESOLVED" {
+		return shim.Error("Accident report is already resolved: " + accidentRef)
+	}
+	if takenAt.Before(accidentReport.OccuredAt) {
+		return shim.Error("3rd argument must not be before the accident occured")
+	}
+
+	// === Identities which are not X.509 based (e.g. Idemix) have no certificate
+	var officerName string
+	cert, err := cid.GetX509Certificate(stub)
+	if err == nil && cert != nil {
+		officerName = cert.Subject.CommonName
+	}
+
+	// === Create witness statement object
+	statementObjClass := "accident.WitnessStatement"
+	statementID, err := newAssetID(stub, statementObjClass, "")
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	witnessStatement := &WitnessStatement{statementObjClass, statementID, accidentRef, statement, takenAt, recordedAt, caller.ParticipantRef, caller.ID, officerName, documentHash}
+
+	// === Marshal witness statement
+	statementJSONasBytes, err := json.Marshal(witnessStatement)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Save witness statement to state
+	statementRef := fmt.Sprintf("%s#%s", statementObjClass, statementID)
+	err = stub.PutState(statementRef, statementJSONasBytes)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Maintain relationship indexes
+	if err = putAssetIndexes(stub, statementObjClass, statementID, statementJSONasBytes); err != nil {
+		return shim.Error(err.Error())
+	}
+
+	// === Emit WitnessStatementAdded event
+	statementAdded := &WitnessStatementAddedEvent{statementID, accidentID, caller.ParticipantRef, takenAt, documentHash}
+	eventJSONasBytes, err := json.Marshal(statementAdded)
+	if err != nil {
+		return shim.Error(err.Error())
+	}
+	stub.SetEvent("WitnessStatementAddedEvent", eventJSONasBytes)
+
+	fmt.Println("- Witness statement successfully added")
+	return shim.Success(eventJSONasBytes)
+}
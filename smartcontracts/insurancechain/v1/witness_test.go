@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/core/chaincode/shim"
+	pb "github.com/hyperledger/fabric/protos/peer"
+)
+
+// newWitnessStub - Get a mock stub with an accident the NYPD responds to and a resolved accident it responded to
+func newWitnessStub(t *testing.T) (*InsuranceChaincode, *testStub) {
+	occuredAt := testTxTime.Add(-time.Hour)
+	return newTestStub(t, map[string]interface{}{
+		"accident.AccidentReport#1534180781": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180781", OccuredAt: occuredAt, Status: "RESPONDING",
+			RespondingERS: "base.EmergencyServices#NYPD 34th Precinct"},
+		"accident.AccidentReport#1534180782": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180782", OccuredAt: occuredAt, Status: "RESOLVED",
+			RespondingERS: "base.EmergencyServices#NYPD 34th Precinct"},
+	})
+}
+
+func TestAddWitnessStatement(t *testing.T) {
+	documentHash := "9F86D081884C7D659A2FEAA0C55AD015A3BF4F1B2B0B822CD15D6C15B0F00A08"
+	tests := []struct {
+		name        string
+		caller      string
+		args        []string
+		wantErr     bool
+		wantTakenAt time.Time
+	}{
+		{"statement only", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180781", "Blue car ran the red light"}, false, testTxTime},
+		{"taken earlier with document", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180781", "Blue car ran the red light", "2018-08-24T17:30:00Z", documentHash}, false, testTxTime.Add(-30 * time.Minute)},
+		{"taken in the future", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180781", "Blue car ran the red light", "2018-08-24T18:30:00Z"}, true, time.Time{}},
+		{"taken before the accident", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180781", "Blue car ran the red light", "2018-08-24T16:30:00Z"}, true, time.Time{}},
+		{"document hash too short", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180781", "Blue car ran the red light", "", "9f86d081"}, true, time.Time{}},
+		{"no statement", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180781", ""}, true, time.Time{}},
+		{"by other emergency services", "base.EmergencyServices#FDNY Engine 67", []string{"1534180781", "Blue car ran the red light"}, true, time.Time{}},
+		{"resolved accident", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180782", "Blue car ran the red light"}, true, time.Time{}},
+		{"unknown accident", "base.EmergencyServices#NYPD 34th Precinct", []string{"1534180783", "Blue car ran the red light"}, true, time.Time{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cc, stub := newWitnessStub(t)
+			response := stub.call(t, testTxTime, func() pb.Response {
+				return cc.addWitnessStatement(stub, testCaller(test.caller), test.args)
+			})
+			if (response.Status != shim.OK) != test.wantErr {
+				t.Fatalf("addWitnessStatement status = %d %s, want error %t", response.Status, response.Message, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+
+			statementAdded := WitnessStatementAddedEvent{}
+			if err := json.Unmarshal(response.Payload, &statementAdded); err != nil {
+				t.Fatal(err)
+			}
+			witnessStatement := WitnessStatement{}
+			stub.get(t, "accident.WitnessStatement#"+statementAdded.StatementID, &witnessStatement)
+			if !witnessStatement.TakenAt.Equal(test.wantTakenAt) || !witnessStatement.RecordedAt.Equal(testTxTime) {
+				t.Errorf("statement taken at %s recorded at %s, want %s and %s", witnessStatement.TakenAt, witnessStatement.RecordedAt, test.wantTakenAt, testTxTime)
+			}
+			if witnessStatement.AccidentReport != "accident.AccidentReport#1534180781" || witnessStatement.RecordedBy != test.caller {
+				t.Errorf("statement of %s recorded by %s, want the accident and %s", witnessStatement.AccidentReport, witnessStatement.RecordedBy, test.caller)
+			}
+			if len(test.args) > 3 && witnessStatement.DocumentHash != "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08" {
+				t.Errorf("document hash = %s, want it in lower case", witnessStatement.DocumentHash)
+			}
+		})
+	}
+}
+
+func TestGetStatementsForAccident(t *testing.T) {
+	cc, stub := newWitnessStub(t)
+	stub.put(t, map[string]interface{}{
+		"accident.AccidentReport#1534180783": &AccidentReport{Class: "accident.AccidentReport", AccidentID: "1534180783", OccuredAt: testTxTime.Add(-time.Hour), Status: "RESPONDING",
+			RespondingERS: "base.EmergencyServices#NYPD 34th Precinct"},
+	})
+	ers := testCaller("base.EmergencyServices#NYPD 34th Precinct")
+	for _, args := range [][]string{
+		{"1534180781", "Blue car ran the red light"},
+		{"1534180783", "Truck was parked in the second row"},
+		{"1534180781", "Driver of the blue car was on the phone"},
+	} {
+		response := stub.call(t, testTxTime, func() pb.Response {
+			return cc.addWitnessStatement(stub, ers, args)
+		})
+		if response.Status != shim.OK {
+			t.Fatalf("addWitnessStatement status = %d %s", response.Status, response.Message)
+		}
+	}
+
+	tests := []struct {
+		accidentID string
+		want       int
+	}{
+		{"1534180781", 2},
+		{"1534180783", 1},
+		{"1534180782", 0},
+	}
+
+	for _, test := range tests {
+		response := cc.getStatementsForAccident(stub, []string{test.accidentID})
+		if response.Status != shim.OK {
+			t.Fatalf("getStatementsForAccident status = %d %s", response.Status, response.Message)
+		}
+
+		var records []QueryRecord
+		if err := json.Unmarshal(response.Payload, &records); err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != test.want {
+			t.Errorf("statements of accident %s = %d, want %d", test.accidentID, len(records), test.want)
+		}
+		for _, record := range records {
+			witnessStatement := WitnessStatement{}
+			if err := json.Unmarshal(record.Record, &witnessStatement); err != nil {
+				t.Fatal(err)
+			}
+			if witnessStatement.AccidentReport != "accident.AccidentReport#"+test.accidentID {
+				t.Errorf("statement %s of accident %s is of %s", witnessStatement.StatementID, test.accidentID, witnessStatement.AccidentReport)
+			}
+		}
+	}
+}